@@ -0,0 +1,132 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var cacheAgeDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "scrape", "cache_age_seconds"),
+	"elasticsearch_exporter: Age of the cached metrics of a collector with a refresh interval.",
+	[]string{"collector"},
+	nil,
+)
+
+// cachedCollector polls a collector in the background and serves the metrics
+// of its last successful update on scrape.
+type cachedCollector struct {
+	name      string
+	collector Collector
+	interval  time.Duration
+	logger    log.Logger
+	// supported reports whether the collector supports the Elasticsearch
+	// version, it is not polled otherwise
+	supported func() bool
+
+	mu          sync.RWMutex
+	metrics     []prometheus.Metric
+	err         error
+	lastSuccess time.Time
+}
+
+func newCachedCollector(name string, c Collector, interval time.Duration, logger log.Logger) *cachedCollector {
+	return &cachedCollector{
+		name:      name,
+		collector: c,
+		interval:  interval,
+		logger:    logger,
+	}
+}
+
+// run refreshes the cached metrics every interval until ctx is cancelled.
+func (c *cachedCollector) run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		c.refresh(ctx)
+		select {
+		case <-ctx.Done():
+			_ = level.Debug(c.logger).Log(
+				"msg", "context cancelled, exiting refresh loop",
+				"name", c.name,
+				"err", ctx.Err(),
+			)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *cachedCollector) refresh(ctx context.Context) {
+	if c.supported != nil && !c.supported() {
+		return
+	}
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	var metrics []prometheus.Metric
+	go func() {
+		for m := range ch {
+			metrics = append(metrics, m)
+		}
+		close(done)
+	}()
+	err := c.collector.Update(ctx, ch)
+	close(ch)
+	<-done
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+	if err != nil {
+		_ = level.Warn(c.logger).Log("msg", "failed to refresh collector", "name", c.name, "err", err)
+		return
+	}
+	c.metrics = metrics
+	c.lastSuccess = time.Now()
+}
+
+// reset drops the cached metrics, which are not sent until the next
+// successful refresh.
+func (c *cachedCollector) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.metrics = nil
+	c.err = nil
+	c.lastSuccess = time.Time{}
+}
+
+// Update sends the cached metrics and their age. After a failed refresh the
+// metrics of the last successful one are sent along with the error.
+func (c *cachedCollector) Update(_ context.Context, ch chan<- prometheus.Metric) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.lastSuccess.IsZero() {
+		if c.err != nil {
+			return c.err
+		}
+		return ErrNoData
+	}
+	for _, m := range c.metrics {
+		ch <- m
+	}
+	ch <- prometheus.MustNewConstMetric(cacheAgeDesc, prometheus.GaugeValue, time.Since(c.lastSuccess).Seconds(), c.name)
+	return c.err
+}
@@ -0,0 +1,113 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var testDesc = prometheus.NewDesc("test_value", "Test value.", nil, nil)
+
+// fakeCollector sends its value and counts its updates.
+type fakeCollector struct {
+	value   float64
+	err     error
+	updates int
+}
+
+func (f *fakeCollector) Update(_ context.Context, ch chan<- prometheus.Metric) error {
+	f.updates++
+	if f.err != nil {
+		return f.err
+	}
+	ch <- prometheus.MustNewConstMetric(testDesc, prometheus.GaugeValue, f.value)
+	return nil
+}
+
+func collectCached(t *testing.T, c *cachedCollector) ([]prometheus.Metric, error) {
+	t.Helper()
+	ch := make(chan prometheus.Metric, 10)
+	err := c.Update(context.Background(), ch)
+	close(ch)
+	var metrics []prometheus.Metric
+	for m := range ch {
+		metrics = append(metrics, m)
+	}
+	return metrics, err
+}
+
+func TestCachedCollector(t *testing.T) {
+	f := &fakeCollector{value: 1}
+	c := newCachedCollector("fake", f, time.Hour, log.NewNopLogger())
+
+	if _, err := collectCached(t, c); err != ErrNoData {
+		t.Fatalf("expected ErrNoData before the first refresh, got %v", err)
+	}
+
+	c.refresh(context.Background())
+	for i := 0; i < 2; i++ {
+		metrics, err := collectCached(t, c)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		// the test value and the cache age
+		if len(metrics) != 2 {
+			t.Fatalf("expected 2 metrics, got %d", len(metrics))
+		}
+	}
+	if f.updates != 1 {
+		t.Errorf("expected scrapes to be served from cache, got %d updates", f.updates)
+	}
+
+	f.err = errors.New("boom")
+	c.refresh(context.Background())
+	metrics, err := collectCached(t, c)
+	if err != f.err {
+		t.Errorf("expected refresh error, got %v", err)
+	}
+	if len(metrics) != 2 {
+		t.Errorf("expected stale metrics after failed refresh, got %d", len(metrics))
+	}
+}
+
+func TestCachedCollectorRun(t *testing.T) {
+	f := &fakeCollector{value: 1}
+	c := newCachedCollector("fake", f, time.Hour, log.NewNopLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := collectCached(t, c); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("collector was not refreshed on start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+}
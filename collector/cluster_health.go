@@ -14,18 +14,23 @@
 package collector
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
-	"path"
 
 	"github.com/go-kit/log"
-	"github.com/go-kit/log/level"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/esclient"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+func init() {
+	registerCollector("cluster-health", defaultEnabled, func(logger log.Logger, u *url.URL, hc *http.Client, m *config.Module) (Collector, error) {
+		return NewClusterHealth(logger, hc, u), nil
+	})
+}
+
 var (
 	colors                     = []string{"green", "yellow", "red"}
 	defaultClusterHealthLabels = []string{"cluster"}
@@ -47,11 +52,7 @@ type clusterHealthStatusMetric struct {
 // ClusterHealth type defines the collector struct
 type ClusterHealth struct {
 	logger log.Logger
-	client *http.Client
-	url    *url.URL
-
-	up                              prometheus.Gauge
-	totalScrapes, jsonParseFailures prometheus.Counter
+	client *esclient.Client
 
 	metrics      []*clusterHealthMetric
 	statusMetric *clusterHealthStatusMetric
@@ -63,21 +64,7 @@ func NewClusterHealth(logger log.Logger, client *http.Client, url *url.URL) *Clu
 
 	return &ClusterHealth{
 		logger: logger,
-		client: client,
-		url:    url,
-
-		up: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: prometheus.BuildFQName(namespace, subsystem, "up"),
-			Help: "Was the last scrape of the Elasticsearch cluster health endpoint successful.",
-		}),
-		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: prometheus.BuildFQName(namespace, subsystem, "total_scrapes"),
-			Help: "Current total Elasticsearch cluster health scrapes.",
-		}),
-		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: prometheus.BuildFQName(namespace, subsystem, "json_parse_failures"),
-			Help: "Number of errors while parsing JSON.",
-		}),
+		client: esclient.New(logger, client, url),
 
 		metrics: []*clusterHealthMetric{
 			{
@@ -219,77 +206,18 @@ func NewClusterHealth(logger log.Logger, client *http.Client, url *url.URL) *Clu
 	}
 }
 
-// Describe set Prometheus metrics descriptions.
-func (c *ClusterHealth) Describe(ch chan<- *prometheus.Desc) {
-	for _, metric := range c.metrics {
-		ch <- metric.Desc
-	}
-	ch <- c.statusMetric.Desc
-
-	ch <- c.up.Desc()
-	ch <- c.totalScrapes.Desc()
-	ch <- c.jsonParseFailures.Desc()
-}
-
-func (c *ClusterHealth) fetchAndDecodeClusterHealth() (clusterHealthResponse, error) {
+func (c *ClusterHealth) fetchAndDecodeClusterHealth(ctx context.Context) (clusterHealthResponse, error) {
 	var chr clusterHealthResponse
-
-	u := *c.url
-	u.Path = path.Join(u.Path, "/_cluster/health")
-	res, err := c.client.Get(u.String())
-	if err != nil {
-		return chr, fmt.Errorf("failed to get cluster health from %s://%s:%s%s: %s",
-			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
-	}
-
-	defer func() {
-		err = res.Body.Close()
-		if err != nil {
-			_ = level.Warn(c.logger).Log(
-				"msg", "failed to close http.Client",
-				"err", err,
-			)
-		}
-	}()
-
-	if res.StatusCode != http.StatusOK {
-		return chr, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
-	}
-
-	bts, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		c.jsonParseFailures.Inc()
-		return chr, err
-	}
-
-	if err := json.Unmarshal(bts, &chr); err != nil {
-		c.jsonParseFailures.Inc()
-		return chr, err
-	}
-
-	return chr, nil
+	err := c.client.Get(ctx, "/_cluster/health", nil, &chr)
+	return chr, err
 }
 
-// Collect collects ClusterHealth metrics.
-func (c *ClusterHealth) Collect(ch chan<- prometheus.Metric) {
-	var err error
-	c.totalScrapes.Inc()
-	defer func() {
-		ch <- c.up
-		ch <- c.totalScrapes
-		ch <- c.jsonParseFailures
-	}()
-
-	clusterHealthResp, err := c.fetchAndDecodeClusterHealth()
+// Update collects ClusterHealth metrics.
+func (c *ClusterHealth) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	clusterHealthResp, err := c.fetchAndDecodeClusterHealth(ctx)
 	if err != nil {
-		c.up.Set(0)
-		_ = level.Warn(c.logger).Log(
-			"msg", "failed to fetch and decode cluster health",
-			"err", err,
-		)
-		return
+		return fmt.Errorf("failed to fetch and decode cluster health: %w", err)
 	}
-	c.up.Set(1)
 
 	for _, metric := range c.metrics {
 		ch <- prometheus.MustNewConstMetric(
@@ -308,4 +236,6 @@ func (c *ClusterHealth) Collect(ch chan<- prometheus.Metric) {
 			clusterHealthResp.ClusterName, color,
 		)
 	}
+
+	return nil
 }
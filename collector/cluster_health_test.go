@@ -14,6 +14,7 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -44,7 +45,7 @@ func TestClusterHealth(t *testing.T) {
 			t.Fatalf("Failed to parse URL: %s", err)
 		}
 		c := NewClusterHealth(log.NewNopLogger(), http.DefaultClient, u)
-		chr, err := c.fetchAndDecodeClusterHealth()
+		chr, err := c.fetchAndDecodeClusterHealth(context.Background())
 		if err != nil {
 			t.Fatalf("Failed to fetch or decode cluster health: %s", err)
 		}
@@ -15,31 +15,31 @@ package collector
 
 import (
 	"context"
-	"encoding/json"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 
 	"github.com/blang/semver/v4"
 	"github.com/go-kit/log"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/esclient"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 func init() {
-	registerCollector("cluster-info", defaultEnabled, NewClusterInfo)
+	registerCollector("cluster-info", defaultEnabled, func(logger log.Logger, u *url.URL, hc *http.Client, m *config.Module) (Collector, error) {
+		return NewClusterInfo(logger, u, hc)
+	})
 }
 
 type ClusterInfoCollector struct {
 	logger log.Logger
-	u      *url.URL
-	hc     *http.Client
+	client *esclient.Client
 }
 
 func NewClusterInfo(logger log.Logger, u *url.URL, hc *http.Client) (Collector, error) {
 	return &ClusterInfoCollector{
 		logger: logger,
-		u:      u,
-		hc:     hc,
+		client: esclient.New(logger, hc, u),
 	}, nil
 }
 
@@ -50,6 +50,7 @@ var clusterInfoDesc = map[string]*prometheus.Desc{
 		[]string{
 			"cluster",
 			"cluster_uuid",
+			"distribution",
 			"build_date",
 			"build_hash",
 			"version",
@@ -70,6 +71,7 @@ type ClusterInfoResponse struct {
 
 // VersionInfo is the version info retrievable from the / endpoint, embedded in ClusterInfoResponse
 type VersionInfo struct {
+	Distribution  string         `json:"distribution"`
 	Number        semver.Version `json:"number"`
 	BuildHash     string         `json:"build_hash"`
 	BuildDate     string         `json:"build_date"`
@@ -78,18 +80,8 @@ type VersionInfo struct {
 }
 
 func (c *ClusterInfoCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
-	resp, err := c.hc.Get(c.u.String())
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	b, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
 	var info ClusterInfoResponse
-	err = json.Unmarshal(b, &info)
-	if err != nil {
+	if err := c.client.Get(ctx, "/", nil, &info); err != nil {
 		return err
 	}
 
@@ -99,6 +91,7 @@ func (c *ClusterInfoCollector) Update(ctx context.Context, ch chan<- prometheus.
 		1,
 		info.ClusterName,
 		info.ClusterUUID,
+		distributionName(info.Version.Distribution),
 		info.Version.BuildDate,
 		info.Version.BuildHash,
 		info.Version.Number.String(),
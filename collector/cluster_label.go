@@ -0,0 +1,65 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sync"
+
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/clusterinfo"
+)
+
+// unknownCluster is the cluster label until the cluster info has been received.
+const unknownCluster = "unknown_cluster"
+
+// defaultClusterLabels are the labels of the metrics without further labels.
+var defaultClusterLabels = []string{"cluster"}
+
+// clusterInfoConsumer is implemented by collectors which label their metrics
+// with the cluster. ElasticsearchCollector passes the cluster info it receives
+// from the clusterinfo.Retriever to its collectors.
+type clusterInfoConsumer interface {
+	SetClusterInfo(ci *clusterinfo.Response)
+}
+
+// clusterLabel holds the cluster info of a collector for the cluster label of
+// its metrics. Collectors embed it to implement clusterInfoConsumer.
+type clusterLabel struct {
+	mu   sync.RWMutex
+	info *clusterinfo.Response
+}
+
+// SetClusterInfo updates the cluster info, a nil cluster info is ignored.
+func (c *clusterLabel) SetClusterInfo(ci *clusterinfo.Response) {
+	if ci == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.info = ci
+}
+
+// clusterInfo returns the last cluster info, nil until it has been set.
+func (c *clusterLabel) clusterInfo() *clusterinfo.Response {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.info
+}
+
+// clusterName returns the cluster label of the metrics.
+func (c *clusterLabel) clusterName() string {
+	if ci := c.clusterInfo(); ci != nil {
+		return ci.ClusterName
+	}
+	return unknownCluster
+}
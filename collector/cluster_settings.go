@@ -14,117 +14,58 @@
 package collector
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
-	"path"
 	"strconv"
 
 	"github.com/go-kit/log"
-	"github.com/go-kit/log/level"
 	"github.com/imdario/mergo"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/esclient"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+func init() {
+	registerCollector("cluster-settings", defaultDisabled, func(logger log.Logger, u *url.URL, hc *http.Client, m *config.Module) (Collector, error) {
+		return NewClusterSettings(logger, hc, u), nil
+	})
+}
+
 // ClusterSettings information struct
 type ClusterSettings struct {
 	logger log.Logger
-	client *http.Client
-	url    *url.URL
+	client *esclient.Client
+	clusterLabel
 
-	up                              prometheus.Gauge
-	shardAllocationEnabled          prometheus.Gauge
-	maxShardsPerNode                prometheus.Gauge
-	totalScrapes, jsonParseFailures prometheus.Counter
+	shardAllocationEnabled *prometheus.Desc
+	maxShardsPerNode       *prometheus.Desc
 }
 
 // NewClusterSettings defines Cluster Settings Prometheus metrics
 func NewClusterSettings(logger log.Logger, client *http.Client, url *url.URL) *ClusterSettings {
 	return &ClusterSettings{
 		logger: logger,
-		client: client,
-		url:    url,
-
-		up: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: prometheus.BuildFQName(namespace, "clustersettings_stats", "up"),
-			Help: "Was the last scrape of the Elasticsearch cluster settings endpoint successful.",
-		}),
-		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: prometheus.BuildFQName(namespace, "clustersettings_stats", "total_scrapes"),
-			Help: "Current total Elasticsearch cluster settings scrapes.",
-		}),
-		shardAllocationEnabled: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: prometheus.BuildFQName(namespace, "clustersettings_stats", "shard_allocation_enabled"),
-			Help: "Current mode of cluster wide shard routing allocation settings.",
-		}),
-		maxShardsPerNode: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: prometheus.BuildFQName(namespace, "clustersettings_stats", "max_shards_per_node"),
-			Help: "Current maximum number of shards per node setting.",
-		}),
-		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: prometheus.BuildFQName(namespace, "clustersettings_stats", "json_parse_failures"),
-			Help: "Number of errors while parsing JSON.",
-		}),
+		client: esclient.New(logger, client, url),
+
+		shardAllocationEnabled: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "clustersettings_stats", "shard_allocation_enabled"),
+			"Current mode of cluster wide shard routing allocation settings.",
+			defaultClusterLabels, nil,
+		),
+		maxShardsPerNode: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "clustersettings_stats", "max_shards_per_node"),
+			"Current maximum number of shards per node setting.",
+			defaultClusterLabels, nil,
+		),
 	}
 }
 
-// Describe add Snapshots metrics descriptions
-func (cs *ClusterSettings) Describe(ch chan<- *prometheus.Desc) {
-	ch <- cs.up.Desc()
-	ch <- cs.totalScrapes.Desc()
-	ch <- cs.shardAllocationEnabled.Desc()
-	ch <- cs.maxShardsPerNode.Desc()
-	ch <- cs.jsonParseFailures.Desc()
-}
-
-func (cs *ClusterSettings) getAndParseURL(u *url.URL, data interface{}) error {
-	res, err := cs.client.Get(u.String())
-	if err != nil {
-		return fmt.Errorf("failed to get from %s://%s:%s%s: %s",
-			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
-	}
-
-	defer func() {
-		err = res.Body.Close()
-		if err != nil {
-			_ = level.Warn(cs.logger).Log(
-				"msg", "failed to close http.Client",
-				"err", err,
-			)
-		}
-	}()
-
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
-	}
-
-	bts, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		cs.jsonParseFailures.Inc()
-		return err
-	}
-
-	if err := json.Unmarshal(bts, data); err != nil {
-		cs.jsonParseFailures.Inc()
-		return err
-	}
-
-	return nil
-}
-
-func (cs *ClusterSettings) fetchAndDecodeClusterSettingsStats() (ClusterSettingsResponse, error) {
-
-	u := *cs.url
-	u.Path = path.Join(u.Path, "/_cluster/settings")
-	q := u.Query()
-	q.Set("include_defaults", "true")
-	u.RawQuery = q.Encode()
-	u.RawPath = q.Encode()
+func (cs *ClusterSettings) fetchAndDecodeClusterSettingsStats(ctx context.Context) (ClusterSettingsResponse, error) {
 	var csfr ClusterSettingsFullResponse
 	var csr ClusterSettingsResponse
-	err := cs.getAndParseURL(&u, &csfr)
+	err := cs.client.Get(ctx, "/_cluster/settings", url.Values{"include_defaults": {"true"}}, &csfr)
 	if err != nil {
 		return csr, err
 	}
@@ -141,29 +82,12 @@ func (cs *ClusterSettings) fetchAndDecodeClusterSettingsStats() (ClusterSettings
 	return csr, err
 }
 
-// Collect gets cluster settings  metric values
-func (cs *ClusterSettings) Collect(ch chan<- prometheus.Metric) {
-
-	cs.totalScrapes.Inc()
-	defer func() {
-		ch <- cs.up
-		ch <- cs.totalScrapes
-		ch <- cs.jsonParseFailures
-		ch <- cs.shardAllocationEnabled
-		ch <- cs.maxShardsPerNode
-	}()
-
-	csr, err := cs.fetchAndDecodeClusterSettingsStats()
+// Update gets cluster settings  metric values
+func (cs *ClusterSettings) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	csr, err := cs.fetchAndDecodeClusterSettingsStats(ctx)
 	if err != nil {
-		cs.shardAllocationEnabled.Set(0)
-		cs.up.Set(0)
-		_ = level.Warn(cs.logger).Log(
-			"msg", "failed to fetch and decode cluster settings stats",
-			"err", err,
-		)
-		return
+		return fmt.Errorf("failed to fetch and decode cluster settings stats: %w", err)
 	}
-	cs.up.Set(1)
 
 	shardAllocationMap := map[string]int{
 		"all":           0,
@@ -172,12 +96,24 @@ func (cs *ClusterSettings) Collect(ch chan<- prometheus.Metric) {
 		"none":          3,
 	}
 
-	cs.shardAllocationEnabled.Set(float64(shardAllocationMap[csr.Cluster.Routing.Allocation.Enabled]))
+	ch <- prometheus.MustNewConstMetric(
+		cs.shardAllocationEnabled,
+		prometheus.GaugeValue,
+		float64(shardAllocationMap[csr.Cluster.Routing.Allocation.Enabled]),
+		cs.clusterName(),
+	)
 
 	if maxShardsPerNodeString, ok := csr.Cluster.MaxShardsPerNode.(string); ok {
 		maxShardsPerNode, err := strconv.ParseInt(maxShardsPerNodeString, 10, 64)
 		if err == nil {
-			cs.maxShardsPerNode.Set(float64(maxShardsPerNode))
+			ch <- prometheus.MustNewConstMetric(
+				cs.maxShardsPerNode,
+				prometheus.GaugeValue,
+				float64(maxShardsPerNode),
+				cs.clusterName(),
+			)
 		}
 	}
+
+	return nil
 }
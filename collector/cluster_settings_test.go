@@ -14,6 +14,7 @@
 package collector
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -45,7 +46,7 @@ func TestClusterSettingsStats(t *testing.T) {
 				t.Fatalf("Failed to parse URL: %s", err)
 			}
 			c := NewClusterSettings(log.NewNopLogger(), http.DefaultClient, u)
-			nsr, err := c.fetchAndDecodeClusterSettingsStats()
+			nsr, err := c.fetchAndDecodeClusterSettingsStats(context.Background())
 			if err != nil {
 				t.Fatalf("Failed to fetch or decode cluster settings stats: %s", err)
 			}
@@ -84,7 +85,7 @@ func TestClusterMaxShardsPerNode(t *testing.T) {
 				t.Fatalf("Failed to parse URL: %s", err)
 			}
 			c := NewClusterSettings(log.NewNopLogger(), http.DefaultClient, u)
-			nsr, err := c.fetchAndDecodeClusterSettingsStats()
+			nsr, err := c.fetchAndDecodeClusterSettingsStats(context.Background())
 			if err != nil {
 				t.Fatalf("Failed to fetch or decode cluster settings stats: %s", err)
 			}
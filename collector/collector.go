@@ -20,11 +20,14 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/clusterinfo"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
 	"github.com/prometheus/client_golang/prometheus"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
@@ -33,17 +36,18 @@ const (
 	// Namespace defines the common namespace to be used by all metrics.
 	namespace = "elasticsearch"
 
-	defaultEnabled = true
-	// defaultDisabled = false
+	defaultEnabled  = true
+	defaultDisabled = false
 )
 
-type factoryFunc func(logger log.Logger, u *url.URL, hc *http.Client) (Collector, error)
+type factoryFunc func(logger log.Logger, u *url.URL, hc *http.Client, m *config.Module) (Collector, error)
 
 var (
 	factories              = make(map[string]factoryFunc)
 	initiatedCollectorsMtx = sync.Mutex{}
 	initiatedCollectors    = make(map[string]Collector)
 	collectorState         = make(map[string]*bool)
+	collectorInterval      = make(map[string]*time.Duration)
 	forcedCollectors       = map[string]bool{} // collectors which have been explicitly enabled or disabled
 )
 
@@ -84,6 +88,10 @@ func registerCollector(name string, isDefaultEnabled bool, createFunc factoryFun
 	flag := kingpin.Flag(flagName, flagHelp).Default(defaultValue).Action(collectorFlagAction(name)).Bool()
 	collectorState[name] = flag
 
+	intervalFlagName := fmt.Sprintf("collector.%s.refresh-interval", name)
+	intervalFlagHelp := fmt.Sprintf("Poll the %s collector in the background at this interval and serve its last result on scrape (default: on scrape).", name)
+	collectorInterval[name] = kingpin.Flag(intervalFlagName, intervalFlagHelp).Default("0s").Duration()
+
 	// Register the create function for this collector
 	factories[name] = createFunc
 }
@@ -93,13 +101,39 @@ type ElasticsearchCollector struct {
 	logger     log.Logger
 	esURL      *url.URL
 	httpClient *http.Client
+
+	module *config.Module
+
+	// ctx bounds the requests of a scrape, see WithContext
+	ctx context.Context
+
+	// collectorStates overrides the collector command line flags when set
+	collectorStates map[string]bool
+
+	// cached are the collectors polled in the background, see Run
+	cached map[string]*cachedCollector
+
+	// base provides the collectors, see WithCollectorsOf
+	base *ElasticsearchCollector
+
+	// version is the Elasticsearch version of the target, see SetClusterInfo
+	version *clusterVersion
+
+	// clusterInfo receives the cluster info updates, see WithClusterInfo
+	clusterInfo *clusterinfo.Subscription
+	// clusterUUID is the UUID of the last cluster info, it is only accessed by
+	// SetClusterInfo
+	clusterUUID string
+
+	// statuses are the outcomes of the collector executions, see Statuses
+	statuses *collectorStatuses
 }
 
 type Option func(*ElasticsearchCollector) error
 
 // NewElasticsearchCollector creates a new ElasticsearchCollector
 func NewElasticsearchCollector(logger log.Logger, filters []string, options ...Option) (*ElasticsearchCollector, error) {
-	e := &ElasticsearchCollector{logger: logger}
+	e := &ElasticsearchCollector{logger: logger, module: &config.DefaultModule}
 	// Apply options to customize the collector
 	for _, o := range options {
 		if err := o(e); err != nil {
@@ -107,13 +141,20 @@ func NewElasticsearchCollector(logger log.Logger, filters []string, options ...O
 		}
 	}
 
+	if e.base != nil {
+		e.version = e.base.version
+		e.statuses = e.base.statuses
+	} else {
+		e.version = &clusterVersion{}
+		e.statuses = newCollectorStatuses()
+	}
+
 	f := make(map[string]bool)
 	for _, filter := range filters {
-		enabled, exist := collectorState[filter]
-		if !exist {
+		if _, exist := factories[filter]; !exist {
 			return nil, fmt.Errorf("missing collector: %s", filter)
 		}
-		if !*enabled {
+		if !e.isEnabled(filter) {
 			return nil, fmt.Errorf("disabled collector: %s", filter)
 		}
 		f[filter] = true
@@ -121,27 +162,62 @@ func NewElasticsearchCollector(logger log.Logger, filters []string, options ...O
 	collectors := make(map[string]Collector)
 	initiatedCollectorsMtx.Lock()
 	defer initiatedCollectorsMtx.Unlock()
-	for key, enabled := range collectorState {
-		if !*enabled || (len(f) > 0 && !f[key]) {
+	for key := range factories {
+		if !e.isEnabled(key) || (len(f) > 0 && !f[key]) {
 			continue
 		}
-		if collector, ok := initiatedCollectors[key]; ok {
+		if e.base != nil {
+			if collector, ok := e.base.Collectors[key]; ok {
+				collectors[key] = collector
+			}
+			continue
+		}
+		// collectors created from explicit states belong to a different target
+		// and must not share the instances created from the command line flags
+		if collector, ok := initiatedCollectors[key]; ok && e.collectorStates == nil {
 			collectors[key] = collector
 		} else {
-			collector, err := factories[key](log.With(logger, "collector", key), e.esURL, e.httpClient)
+			collector, err := factories[key](log.With(logger, "collector", key), e.esURL, e.httpClient, e.module)
 			if err != nil {
 				return nil, err
 			}
 			collectors[key] = collector
-			initiatedCollectors[key] = collector
+			if e.collectorStates == nil {
+				initiatedCollectors[key] = collector
+			}
 		}
 	}
 
 	e.Collectors = collectors
+	if e.base != nil {
+		// the cached collectors are polled by base
+		e.cached = make(map[string]*cachedCollector)
+		for name, c := range e.base.cached {
+			if _, ok := collectors[name]; ok {
+				e.cached[name] = c
+			}
+		}
+		return e, nil
+	}
+	for name, c := range e.cached {
+		if collector, ok := collectors[name]; ok {
+			c.collector = collector
+			c.supported = e.supportsFunc(name)
+		} else {
+			delete(e.cached, name)
+		}
+	}
 
 	return e, nil
 }
 
+func (e *ElasticsearchCollector) isEnabled(name string) bool {
+	if e.collectorStates != nil {
+		return e.collectorStates[name]
+	}
+	return *collectorState[name]
+}
+
 func WithElasticsearchURL(esURL *url.URL) Option {
 	return func(e *ElasticsearchCollector) error {
 		e.esURL = esURL
@@ -156,27 +232,211 @@ func WithHTTPClient(hc *http.Client) Option {
 	}
 }
 
+// WithModule enables exactly the collectors of the module, ignoring the
+// --collector.<name> flags, and passes the module options to them. The
+// collectors are created for this ElasticsearchCollector only, which allows to
+// scrape targets other than es.uri.
+func WithModule(m *config.Module) Option {
+	return func(e *ElasticsearchCollector) error {
+		e.module = m
+		e.collectorStates = make(map[string]bool)
+		for _, name := range m.Collectors {
+			e.collectorStates[name] = true
+		}
+		return nil
+	}
+}
+
+// WithCollectorsOf reuses the collectors of base, including those polled in the
+// background, instead of creating new ones. Together with filters, it selects a
+// subset of the collectors of base, e.g. for a single scrape.
+func WithCollectorsOf(base *ElasticsearchCollector) Option {
+	return func(e *ElasticsearchCollector) error {
+		e.esURL = base.esURL
+		e.httpClient = base.httpClient
+		e.module = base.module
+		e.collectorStates = base.collectorStates
+		e.base = base
+		return nil
+	}
+}
+
+// WithContext returns a copy of the collector which passes ctx to the collectors
+// on Collect, so that their Elasticsearch requests are cancelled when ctx is
+// done, e.g. when the scrape timeout of Prometheus is about to expire.
+func (e *ElasticsearchCollector) WithContext(ctx context.Context) *ElasticsearchCollector {
+	c := *e
+	c.ctx = ctx
+	return &c
+}
+
+// WithRefreshIntervals polls the named collectors in the background at the
+// given intervals, once Run has been called. Scrapes are served from the result
+// of the last poll.
+func WithRefreshIntervals(intervals map[string]time.Duration) Option {
+	return func(e *ElasticsearchCollector) error {
+		e.cached = make(map[string]*cachedCollector)
+		for name, interval := range intervals {
+			if interval > 0 {
+				e.cached[name] = newCachedCollector(name, nil, interval, log.With(e.logger, "collector", name))
+			}
+		}
+		return nil
+	}
+}
+
+// WithClusterInfo passes the cluster info updates of the subscription to the
+// collectors, see SetClusterInfo, once Run has been called.
+func WithClusterInfo(sub *clusterinfo.Subscription) Option {
+	return func(e *ElasticsearchCollector) error {
+		e.clusterInfo = sub
+		return nil
+	}
+}
+
+// Run starts polling the collectors with a refresh interval and receiving the
+// cluster info updates, see WithClusterInfo. Both stop when ctx is cancelled,
+// which also cancels the cluster info subscription.
+func (e *ElasticsearchCollector) Run(ctx context.Context) {
+	for _, c := range e.cached {
+		go c.run(ctx)
+	}
+	if e.clusterInfo == nil {
+		return
+	}
+	go func() {
+		defer e.clusterInfo.Unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ci, ok := <-e.clusterInfo.Updates():
+				if !ok {
+					return
+				}
+				e.SetClusterInfo(ci)
+			}
+		}
+	}()
+}
+
+// resettableCollector is implemented by collectors which keep state across
+// scrapes, e.g. to keep counters monotonic.
+type resettableCollector interface {
+	reset()
+}
+
+// SetClusterInfo passes the cluster info to the collectors, which label their
+// metrics with the cluster, and its Elasticsearch version to the collectors
+// depending on it. Collectors which do not support the version are skipped
+// from then on. If the cluster UUID changed, the state of the collectors is
+// reset, so that no metric mixes the values of both clusters.
+func (e *ElasticsearchCollector) SetClusterInfo(ci *clusterinfo.Response) {
+	if ci == nil {
+		return
+	}
+	if e.clusterUUID != "" && e.clusterUUID != ci.ClusterUUID {
+		_ = level.Warn(e.logger).Log(
+			"msg", "resetting collectors after the cluster UUID changed",
+			"previous_cluster_uuid", e.clusterUUID,
+			"cluster_uuid", ci.ClusterUUID,
+		)
+		e.reset()
+	}
+	e.clusterUUID = ci.ClusterUUID
+	for _, c := range e.Collectors {
+		if cc, ok := c.(clusterInfoConsumer); ok {
+			cc.SetClusterInfo(ci)
+		}
+	}
+	distribution := ci.Version.DistributionName()
+	if !e.version.set(distribution, ci.Version.Number) {
+		return
+	}
+	for name, c := range e.Collectors {
+		if vc, ok := c.(versionedCollector); ok {
+			vc.SetVersion(distribution, ci.Version.Number)
+		}
+		if !e.supports(name) {
+			_ = level.Info(e.logger).Log(
+				"msg", "collector does not support the Elasticsearch version",
+				"name", name,
+				"distribution", distribution,
+				"version", ci.Version.Number.String(),
+				"supported_versions", supportedVersions[name][distribution].expr,
+			)
+		}
+	}
+}
+
+// reset resets the state of the collectors and drops the metrics of the
+// collectors polled in the background.
+func (e *ElasticsearchCollector) reset() {
+	for _, c := range e.Collectors {
+		if rc, ok := c.(resettableCollector); ok {
+			rc.reset()
+		}
+	}
+	for _, c := range e.cached {
+		c.reset()
+	}
+}
+
+// supports reports whether the named collector supports the Elasticsearch
+// version of the target.
+func (e *ElasticsearchCollector) supports(name string) bool {
+	ranges, ok := supportedVersions[name]
+	if !ok {
+		return true
+	}
+	distribution, number := e.version.get()
+	if number == nil {
+		return true
+	}
+	r, ok := ranges[distribution]
+	return ok && r.contains(number)
+}
+
+func (e *ElasticsearchCollector) supportsFunc(name string) func() bool {
+	return func() bool {
+		return e.supports(name)
+	}
+}
+
 // Describe implements the prometheus.Collector interface.
 func (e ElasticsearchCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- scrapeDurationDesc
 	ch <- scrapeSuccessDesc
+	ch <- unsupportedDesc
 }
 
 // Collect implements the prometheus.Collector interface.
 func (e ElasticsearchCollector) Collect(ch chan<- prometheus.Metric) {
 	wg := sync.WaitGroup{}
-	ctx := context.TODO()
-	wg.Add(len(e.Collectors))
+	ctx := e.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
 	for name, c := range e.Collectors {
+		if !e.supports(name) {
+			distribution, number := e.version.get()
+			ch <- prometheus.MustNewConstMetric(unsupportedDesc, prometheus.GaugeValue, 1, name, distribution, number.String(), supportedVersions[name][distribution].expr)
+			continue
+		}
+		if cached, ok := e.cached[name]; ok {
+			c = cached
+		}
+		wg.Add(1)
 		go func(name string, c Collector) {
-			execute(ctx, name, c, ch, e.logger)
+			err := execute(ctx, name, c, ch, e.logger)
+			e.statuses.record(name, err, time.Now())
 			wg.Done()
 		}(name, c)
 	}
 	wg.Wait()
 }
 
-func execute(ctx context.Context, name string, c Collector, ch chan<- prometheus.Metric, logger log.Logger) {
+func execute(ctx context.Context, name string, c Collector, ch chan<- prometheus.Metric, logger log.Logger) error {
 	begin := time.Now()
 	err := c.Update(ctx, ch)
 	duration := time.Since(begin)
@@ -185,6 +445,8 @@ func execute(ctx context.Context, name string, c Collector, ch chan<- prometheus
 	if err != nil {
 		if IsNoDataError(err) {
 			_ = level.Debug(logger).Log("msg", "collector returned no data", "name", name, "duration_seconds", duration.Seconds(), "err", err)
+		} else if errors.Is(err, context.DeadlineExceeded) {
+			_ = level.Error(logger).Log("msg", "collector timed out", "name", name, "duration_seconds", duration.Seconds(), "err", err)
 		} else {
 			_ = level.Error(logger).Log("msg", "collector failed", "name", name, "duration_seconds", duration.Seconds(), "err", err)
 		}
@@ -195,6 +457,32 @@ func execute(ctx context.Context, name string, c Collector, ch chan<- prometheus
 	}
 	ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration.Seconds(), name)
 	ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, success, name)
+	return err
+}
+
+// EnabledCollectors returns the names of the collectors enabled by the
+// --collector.<name> command line flags.
+func EnabledCollectors() []string {
+	var names []string
+	for name, enabled := range collectorState {
+		if *enabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RefreshIntervals returns the refresh intervals set by the
+// --collector.<name>.refresh-interval command line flags.
+func RefreshIntervals() map[string]time.Duration {
+	intervals := make(map[string]time.Duration)
+	for name, interval := range collectorInterval {
+		if *interval > 0 {
+			intervals[name] = *interval
+		}
+	}
+	return intervals
 }
 
 // collectorFlagAction generates a new action function for the given collector
@@ -0,0 +1,308 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blang/semver/v4"
+	"github.com/go-kit/log"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/clusterinfo"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestElasticsearchCollectorWithContext(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	module := config.DefaultModule
+	module.Collectors = []string{"cluster-health"}
+	e, err := NewElasticsearchCollector(
+		log.NewNopLogger(),
+		[]string{},
+		WithElasticsearchURL(u),
+		WithHTTPClient(http.DefaultClient),
+		WithModule(&module),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create collector: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(e.WithContext(ctx))
+
+	done := make(chan struct{})
+	var success float64 = -1
+	go func() {
+		defer close(done)
+		mfs, err := registry.Gather()
+		if err != nil {
+			t.Errorf("Failed to gather: %s", err)
+			return
+		}
+		for _, mf := range mfs {
+			if mf.GetName() == "elasticsearch_scrape_success" {
+				success = mf.GetMetric()[0].GetGauge().GetValue()
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scrape did not return after the context deadline")
+	}
+	if success != 0 {
+		t.Errorf("expected scrape_success 0 for timed out collector, got %v", success)
+	}
+}
+
+func TestElasticsearchCollectorWithCollectorsOf(t *testing.T) {
+	u, err := url.Parse("http://localhost:9200")
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	module := config.DefaultModule
+	module.Collectors = []string{"cluster-health", "nodes", "snapshots"}
+	base, err := NewElasticsearchCollector(
+		log.NewNopLogger(),
+		[]string{},
+		WithElasticsearchURL(u),
+		WithHTTPClient(http.DefaultClient),
+		WithModule(&module),
+		WithRefreshIntervals(map[string]time.Duration{"snapshots": time.Minute}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create collector: %s", err)
+	}
+
+	e, err := NewElasticsearchCollector(log.NewNopLogger(), []string{"nodes", "snapshots"}, WithCollectorsOf(base))
+	if err != nil {
+		t.Fatalf("Failed to create filtered collector: %s", err)
+	}
+	if len(e.Collectors) != 2 || e.Collectors["nodes"] != base.Collectors["nodes"] {
+		t.Errorf("expected the nodes and snapshots collectors of base, got %v", e.Collectors)
+	}
+	if len(e.cached) != 1 || e.cached["snapshots"] != base.cached["snapshots"] {
+		t.Errorf("expected the cached snapshots collector of base, got %v", e.cached)
+	}
+	if len(base.Collectors) != 3 || len(base.cached) != 1 {
+		t.Error("expected base to be unchanged")
+	}
+
+	if _, err := NewElasticsearchCollector(log.NewNopLogger(), []string{"indices"}, WithCollectorsOf(base)); err == nil {
+		t.Error("expected an error for a collector disabled in base")
+	}
+	if _, err := NewElasticsearchCollector(log.NewNopLogger(), []string{"foo"}, WithCollectorsOf(base)); err == nil {
+		t.Error("expected an error for an unknown collector")
+	}
+}
+
+func TestElasticsearchCollectorUnsupportedVersion(t *testing.T) {
+	var slmRequests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/_slm") {
+			atomic.AddInt32(&slmRequests, 1)
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	module := config.DefaultModule
+	module.Collectors = []string{"cluster-health", "slm"}
+	e, err := NewElasticsearchCollector(
+		log.NewNopLogger(),
+		[]string{},
+		WithElasticsearchURL(u),
+		WithHTTPClient(http.DefaultClient),
+		WithModule(&module),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create collector: %s", err)
+	}
+	e.SetClusterInfo(&clusterinfo.Response{Version: clusterinfo.VersionInfo{Number: semver.MustParse("7.3.0")}})
+
+	expected := `
+# HELP elasticsearch_scrape_unsupported_info elasticsearch_exporter: Collector which is disabled because it does not support the Elasticsearch version.
+# TYPE elasticsearch_scrape_unsupported_info gauge
+elasticsearch_scrape_unsupported_info{collector="slm",distribution="elasticsearch",supported_versions=">=7.4.0",version="7.3.0"} 1
+# HELP elasticsearch_scrape_success elasticsearch_exporter: Whether a collector succeeded.
+# TYPE elasticsearch_scrape_success gauge
+elasticsearch_scrape_success{collector="cluster-health"} 1
+`
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(e)
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "elasticsearch_scrape_unsupported_info", "elasticsearch_scrape_success"); err != nil {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&slmRequests); n != 0 {
+		t.Errorf("expected no SLM requests, got %d", n)
+	}
+}
+
+func TestElasticsearchCollectorSupportsDistribution(t *testing.T) {
+	e := &ElasticsearchCollector{version: &clusterVersion{}}
+	for _, tc := range []struct {
+		distribution string
+		version      string
+		collector    string
+		supported    bool
+	}{
+		{clusterinfo.DistributionElasticsearch, "7.3.0", "slm", false},
+		{clusterinfo.DistributionElasticsearch, "7.4.0", "slm", true},
+		{clusterinfo.DistributionOpenSearch, "2.0.0", "slm", false},
+		{clusterinfo.DistributionOpenSearch, "2.3.0", "slm", true},
+		{clusterinfo.DistributionOpenSearch, "1.0.0", "data-stream", true},
+		{clusterinfo.DistributionOpenSearch, "1.0.0", "nodes", true},
+		{"other", "1.0.0", "ilm", false},
+	} {
+		e.version.set(tc.distribution, semver.MustParse(tc.version))
+		if supported := e.supports(tc.collector); supported != tc.supported {
+			t.Errorf("expected %s %s support of %s to be %t", tc.distribution, tc.version, tc.collector, tc.supported)
+		}
+	}
+}
+
+func TestElasticsearchCollectorSetClusterInfo(t *testing.T) {
+	u, err := url.Parse("http://localhost:9200")
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	shards := NewShards(log.NewNopLogger(), http.DefaultClient, u)
+	indices := NewIndices(log.NewNopLogger(), http.DefaultClient, u, false, false)
+	e := &ElasticsearchCollector{
+		Collectors: map[string]Collector{"shards": shards, "indices": indices},
+		logger:     log.NewNopLogger(),
+		version:    &clusterVersion{},
+	}
+	if name := shards.clusterName(); name != unknownCluster {
+		t.Errorf("expected cluster %s before the cluster info, got %s", unknownCluster, name)
+	}
+
+	e.SetClusterInfo(&clusterinfo.Response{ClusterName: "prod", ClusterUUID: "uuid"})
+	for name, c := range map[string]*clusterLabel{"shards": &shards.clusterLabel, "indices": &indices.clusterLabel} {
+		if ci := c.clusterInfo(); ci == nil || ci.ClusterName != "prod" || ci.ClusterUUID != "uuid" {
+			t.Errorf("expected cluster info of prod in collector %s, got %+v", name, ci)
+		}
+	}
+}
+
+func TestElasticsearchCollectorClusterUUIDChange(t *testing.T) {
+	u, err := url.Parse("http://localhost:9200")
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	indices := NewIndices(log.NewNopLogger(), http.DefaultClient, u, false, false)
+	indices.groups, err = newIndexGrouper(config.ModuleOptions{IndexGroups: []config.IndexGroup{{Regex: `(.+)-\d+`}}})
+	if err != nil {
+		t.Fatalf("Failed to create grouper: %s", err)
+	}
+	cached := newCachedCollector("fake", &fakeCollector{value: 1}, time.Hour, log.NewNopLogger())
+	e := &ElasticsearchCollector{
+		Collectors: map[string]Collector{"indices": indices, "fake": cached.collector},
+		cached:     map[string]*cachedCollector{"fake": cached},
+		logger:     log.NewNopLogger(),
+		version:    &clusterVersion{},
+	}
+
+	grouped := func() int {
+		indices.groups.mu.Lock()
+		defer indices.groups.mu.Unlock()
+		return len(indices.groups.indices)
+	}
+	e.SetClusterInfo(&clusterinfo.Response{ClusterName: "prod", ClusterUUID: "uuid-1"})
+	indices.groups.sum(map[string]IndexStatsIndexResponse{"logs-1": {}}, indices.indexMetrics)
+	cached.refresh(context.Background())
+
+	e.SetClusterInfo(&clusterinfo.Response{ClusterName: "prod", ClusterUUID: "uuid-1"})
+	if n := grouped(); n != 1 {
+		t.Errorf("expected the grouped indices to be kept for the same cluster, got %d", n)
+	}
+	if _, err := collectCached(t, cached); err != nil {
+		t.Errorf("expected the cached metrics to be kept for the same cluster, got %v", err)
+	}
+
+	e.SetClusterInfo(&clusterinfo.Response{ClusterName: "prod", ClusterUUID: "uuid-2"})
+	if n := grouped(); n != 0 {
+		t.Errorf("expected the grouped indices to be reset after the cluster UUID changed, got %d", n)
+	}
+	if _, err := collectCached(t, cached); err != ErrNoData {
+		t.Errorf("expected the cached metrics to be dropped after the cluster UUID changed, got %v", err)
+	}
+}
+
+func TestElasticsearchCollectorStatuses(t *testing.T) {
+	base, err := NewElasticsearchCollector(log.NewNopLogger(), []string{}, WithModule(&config.Module{}))
+	if err != nil {
+		t.Fatalf("Failed to create collector: %s", err)
+	}
+	healthy := &fakeCollector{value: 1}
+	failing := &fakeCollector{err: errors.New("unavailable")}
+	base.Collectors = map[string]Collector{"healthy": healthy, "failing": failing}
+	if len(base.Statuses()) != 0 {
+		t.Errorf("expected no statuses before the first scrape, got %v", base.Statuses())
+	}
+
+	collect := func(e *ElasticsearchCollector) {
+		ch := make(chan prometheus.Metric, 10)
+		e.Collect(ch)
+	}
+	collect(base.WithContext(context.Background()))
+	statuses := base.Statuses()
+	if s := statuses["healthy"]; s.LastSuccess.IsZero() || s.LastError != nil {
+		t.Errorf("expected a success of the healthy collector, got %+v", s)
+	}
+	if s := statuses["failing"]; !s.LastSuccess.IsZero() || s.LastError == nil || s.LastErrorTime.IsZero() {
+		t.Errorf("expected an error of the failing collector, got %+v", s)
+	}
+
+	// the last success is kept while the error is cleared on recovery
+	failing.err = nil
+	healthy.err = errors.New("timeout")
+	collect(base)
+	statuses = base.Statuses()
+	if s := statuses["healthy"]; s.LastSuccess.IsZero() || s.LastError == nil {
+		t.Errorf("expected the last success and an error of the healthy collector, got %+v", s)
+	}
+	if s := statuses["failing"]; s.LastSuccess.IsZero() || s.LastError != nil {
+		t.Errorf("expected a success of the recovered collector, got %+v", s)
+	}
+}
@@ -14,18 +14,26 @@
 package collector
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
-	"path"
 
 	"github.com/go-kit/log"
-	"github.com/go-kit/log/level"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/clusterinfo"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/esclient"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+func init() {
+	registerCollector("data-stream", defaultDisabled, func(logger log.Logger, u *url.URL, hc *http.Client, m *config.Module) (Collector, error) {
+		return NewDataStream(logger, hc, u), nil
+	})
+	registerVersionRange("data-stream", clusterinfo.DistributionElasticsearch, ">=7.9.0")
+	registerVersionRange("data-stream", clusterinfo.DistributionOpenSearch, ">=1.0.0")
+}
+
 type dataStreamMetric struct {
 	Type   prometheus.ValueType
 	Desc   *prometheus.Desc
@@ -34,7 +42,7 @@ type dataStreamMetric struct {
 }
 
 var (
-	defaultDataStreamLabels      = []string{"data_stream"}
+	defaultDataStreamLabels      = []string{"data_stream", "cluster"}
 	defaultDataStreamLabelValues = func(dataStreamStats DataStreamStatsDataStream) []string {
 		return []string{dataStreamStats.DataStream}
 	}
@@ -43,11 +51,8 @@ var (
 // DataStream Information Struct
 type DataStream struct {
 	logger log.Logger
-	client *http.Client
-	url    *url.URL
-
-	up                              prometheus.Gauge
-	totalScrapes, jsonParseFailures prometheus.Counter
+	client *esclient.Client
+	clusterLabel
 
 	dataStreamMetrics []*dataStreamMetric
 }
@@ -56,21 +61,8 @@ type DataStream struct {
 func NewDataStream(logger log.Logger, client *http.Client, url *url.URL) *DataStream {
 	return &DataStream{
 		logger: logger,
-		client: client,
-		url:    url,
+		client: esclient.New(logger, client, url),
 
-		up: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: prometheus.BuildFQName(namespace, "data_stream_stats", "up"),
-			Help: "Was the last scrape of the ElasticSearch Data Stream stats endpoint successful.",
-		}),
-		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: prometheus.BuildFQName(namespace, "data_stream_stats", "total_scrapes"),
-			Help: "Current total ElasticSearch Data STream scrapes.",
-		}),
-		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: prometheus.BuildFQName(namespace, "data_stream_stats", "json_parse_failures"),
-			Help: "Number of errors while parsing JSON.",
-		}),
 		dataStreamMetrics: []*dataStreamMetric{
 			{
 				Type: prometheus.CounterValue,
@@ -100,86 +92,29 @@ func NewDataStream(logger log.Logger, client *http.Client, url *url.URL) *DataSt
 	}
 }
 
-// Describe adds DataStream metrics descriptions
-func (ds *DataStream) Describe(ch chan<- *prometheus.Desc) {
-	for _, metric := range ds.dataStreamMetrics {
-		ch <- metric.Desc
-	}
-
-	ch <- ds.up.Desc()
-	ch <- ds.totalScrapes.Desc()
-	ch <- ds.jsonParseFailures.Desc()
-}
-
-func (ds *DataStream) fetchAndDecodeDataStreamStats() (DataStreamStatsResponse, error) {
+func (ds *DataStream) fetchAndDecodeDataStreamStats(ctx context.Context) (DataStreamStatsResponse, error) {
 	var dsr DataStreamStatsResponse
-
-	u := *ds.url
-	u.Path = path.Join(u.Path, "/_data_stream/*/_stats")
-	res, err := ds.client.Get(u.String())
-	if err != nil {
-		return dsr, fmt.Errorf("failed to get data stream stats health from %s://%s:%s%s: %s",
-			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
-	}
-
-	defer func() {
-		err = res.Body.Close()
-		if err != nil {
-			_ = level.Warn(ds.logger).Log(
-				"msg", "failed to close http.Client",
-				"err", err,
-			)
-		}
-	}()
-
-	if res.StatusCode != http.StatusOK {
-		return dsr, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
-	}
-
-	bts, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		ds.jsonParseFailures.Inc()
-		return dsr, err
-	}
-
-	if err := json.Unmarshal(bts, &dsr); err != nil {
-		ds.jsonParseFailures.Inc()
-		return dsr, err
-	}
-
-	return dsr, nil
+	err := ds.client.Get(ctx, "/_data_stream/*/_stats", nil, &dsr)
+	return dsr, err
 }
 
-// Collect gets DataStream metric values
-func (ds *DataStream) Collect(ch chan<- prometheus.Metric) {
-	ds.totalScrapes.Inc()
-	defer func() {
-		ch <- ds.up
-		ch <- ds.totalScrapes
-		ch <- ds.jsonParseFailures
-	}()
-
-	dataStreamStatsResp, err := ds.fetchAndDecodeDataStreamStats()
+// Update gets DataStream metric values
+func (ds *DataStream) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	dataStreamStatsResp, err := ds.fetchAndDecodeDataStreamStats(ctx)
 	if err != nil {
-		ds.up.Set(0)
-		_ = level.Warn(ds.logger).Log(
-			"msg", "failed to fetch and decode data stream stats",
-			"err", err,
-		)
-		return
+		return fmt.Errorf("failed to fetch and decode data stream stats: %w", err)
 	}
 
-	ds.up.Set(1)
-
 	for _, metric := range ds.dataStreamMetrics {
 		for _, dataStream := range dataStreamStatsResp.DataStreamStats {
-			fmt.Printf("Metric: %+v", dataStream)
 			ch <- prometheus.MustNewConstMetric(
 				metric.Desc,
 				metric.Type,
 				metric.Value(dataStream),
-				metric.Labels(dataStream)...,
+				append(metric.Labels(dataStream), ds.clusterName())...,
 			)
 		}
 	}
+
+	return nil
 }
@@ -14,6 +14,7 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -38,7 +39,7 @@ func TestDataStream(t *testing.T) {
 			t.Fatalf("Failed to parse URL: %s", err)
 		}
 		s := NewDataStream(log.NewNopLogger(), http.DefaultClient, u)
-		stats, err := s.fetchAndDecodeDataStreamStats()
+		stats, err := s.fetchAndDecodeDataStreamStats(context.Background())
 		if err != nil {
 			t.Fatalf("Failed to fetch or decode data stream stats: %s", err)
 		}
@@ -0,0 +1,160 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/blang/semver/v4"
+	"github.com/go-kit/log"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/clusterinfo"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/esclient"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	registerCollector("ilm", defaultDisabled, func(logger log.Logger, u *url.URL, hc *http.Client, m *config.Module) (Collector, error) {
+		return NewILM(logger, hc, u), nil
+	})
+	registerVersionRange("ilm", clusterinfo.DistributionElasticsearch, ">=6.6.0")
+	registerVersionRange("ilm", clusterinfo.DistributionOpenSearch, ">=1.0.0")
+}
+
+var (
+	ilmIndexStatusDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "ilm_index", "status"),
+		"Phase, action and step of the index in its lifecycle policy",
+		[]string{"index", "policy", "phase", "action", "step", "cluster"}, nil,
+	)
+	ilmStatusDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "ilm", "status"),
+		"Operating status of ILM",
+		[]string{"operation_mode", "cluster"}, nil,
+	)
+)
+
+// ILM exposes the lifecycle state of the indices, from index lifecycle
+// management (ILM) of Elasticsearch or index state management (ISM) of
+// OpenSearch.
+type ILM struct {
+	logger log.Logger
+	client *esclient.Client
+	clusterLabel
+
+	version clusterVersion
+}
+
+// NewILM defines ILM Prometheus metrics
+func NewILM(logger log.Logger, client *http.Client, url *url.URL) *ILM {
+	return &ILM{
+		logger: logger,
+		client: esclient.New(logger, client, url),
+	}
+}
+
+// ilmIndex is the lifecycle state of an index, common to ILM and ISM.
+type ilmIndex struct {
+	policy, phase, action, step string
+}
+
+func (i *ILM) fetchAndDecodeILMExplain(ctx context.Context) (map[string]ilmIndex, error) {
+	var ier ILMExplainResponse
+	params := url.Values{"only_managed": {"true"}}
+	if err := i.client.Get(ctx, "/_all/_ilm/explain", params, &ier); err != nil {
+		return nil, err
+	}
+	indices := make(map[string]ilmIndex, len(ier.Indices))
+	for name, index := range ier.Indices {
+		if !index.Managed {
+			continue
+		}
+		indices[name] = ilmIndex{policy: index.Policy, phase: index.Phase, action: index.Action, step: index.Step}
+	}
+	return indices, nil
+}
+
+func (i *ILM) fetchAndDecodeISMExplain(ctx context.Context) (map[string]ilmIndex, error) {
+	// the explain response mixes the indices with the total_managed_indices count
+	var ier map[string]json.RawMessage
+	if err := i.client.Get(ctx, "/_plugins/_ism/explain", nil, &ier); err != nil {
+		return nil, err
+	}
+	indices := make(map[string]ilmIndex, len(ier))
+	for name, raw := range ier {
+		if name == "total_managed_indices" {
+			continue
+		}
+		var index ISMExplainIndex
+		if err := json.Unmarshal(raw, &index); err != nil {
+			return nil, fmt.Errorf("failed to decode ISM state of index %s: %w", name, err)
+		}
+		if index.PolicyID == "" {
+			continue
+		}
+		indices[name] = ilmIndex{policy: index.PolicyID, phase: index.State.Name, action: index.Action.Name, step: index.Step.Name}
+	}
+	return indices, nil
+}
+
+func (i *ILM) fetchAndDecodeILMStatus(ctx context.Context) (ILMStatusResponse, error) {
+	var isr ILMStatusResponse
+	err := i.client.Get(ctx, "/_ilm/status", nil, &isr)
+	return isr, err
+}
+
+// SetVersion routes the requests to ISM instead of ILM for OpenSearch. It
+// implements the versionedCollector interface.
+func (i *ILM) SetVersion(distribution string, number semver.Version) {
+	i.version.set(distribution, number)
+}
+
+// Update gets ILM metric values
+func (i *ILM) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var (
+		indices map[string]ilmIndex
+		err     error
+	)
+	if distribution, _ := i.version.get(); distribution == clusterinfo.DistributionOpenSearch {
+		indices, err = i.fetchAndDecodeISMExplain(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to fetch and decode ism explain: %w", err)
+		}
+	} else {
+		status, err := i.fetchAndDecodeILMStatus(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to fetch and decode ilm status: %w", err)
+		}
+		for _, mode := range statuses {
+			var value float64
+			if status.OperationMode == mode {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(ilmStatusDesc, prometheus.GaugeValue, value, mode, i.clusterName())
+		}
+		indices, err = i.fetchAndDecodeILMExplain(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to fetch and decode ilm explain: %w", err)
+		}
+	}
+
+	for name, index := range indices {
+		ch <- prometheus.MustNewConstMetric(ilmIndexStatusDesc, prometheus.GaugeValue, 1, name, index.policy, index.phase, index.action, index.step, i.clusterName())
+	}
+	return nil
+}
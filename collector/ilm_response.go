@@ -0,0 +1,47 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+// ILMExplainResponse is a representation of the ILM state of the indices
+type ILMExplainResponse struct {
+	Indices map[string]ILMExplainIndex `json:"indices"`
+}
+
+// ILMExplainIndex is a representation of the ILM state of an index
+type ILMExplainIndex struct {
+	Managed bool   `json:"managed"`
+	Policy  string `json:"policy"`
+	Phase   string `json:"phase"`
+	Action  string `json:"action"`
+	Step    string `json:"step"`
+}
+
+// ILMStatusResponse is a representation of the ILM status
+type ILMStatusResponse struct {
+	OperationMode string `json:"operation_mode"`
+}
+
+// ISMExplainIndex is a representation of the OpenSearch ISM state of an index
+type ISMExplainIndex struct {
+	PolicyID string `json:"policy_id"`
+	State    struct {
+		Name string `json:"name"`
+	} `json:"state"`
+	Action struct {
+		Name string `json:"name"`
+	} `json:"action"`
+	Step struct {
+		Name string `json:"name"`
+	} `json:"step"`
+}
@@ -0,0 +1,101 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/blang/semver/v4"
+	"github.com/go-kit/log"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/clusterinfo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// wrapCollector exposes a Collector as unchecked prometheus.Collector.
+type wrapCollector struct {
+	c Collector
+}
+
+func (w wrapCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (w wrapCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = w.c.Update(context.Background(), ch)
+}
+
+func TestILM(t *testing.T) {
+	// Testcases created using:
+	//  curl http://127.0.0.1:9200/_all/_ilm/explain?only_managed=true
+	//  curl http://127.0.0.1:9200/_ilm/status
+	//  curl http://127.0.0.1:9200/_plugins/_ism/explain (OpenSearch 2.3.0)
+	responses := map[string]string{
+		"/_all/_ilm/explain":     `{"indices":{"logs-1":{"index":"logs-1","managed":true,"policy":"logs","lifecycle_date_millis":1664271812912,"phase":"hot","action":"rollover","step":"check-rollover-ready"}}}`,
+		"/_ilm/status":           `{"operation_mode":"RUNNING"}`,
+		"/_plugins/_ism/explain": `{"logs-1":{"index.plugins.index_state_management.policy_id":"logs","index.opendistro.index_state_management.policy_id":"logs","index":"logs-1","policy_id":"logs","enabled":true,"state":{"name":"hot"},"action":{"name":"rollover"},"step":{"name":"attempt_rollover","step_status":"starting"}},"tmp":{"index.plugins.index_state_management.policy_id":null},"total_managed_indices":1}`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(res))
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	for _, tc := range []struct {
+		distribution string
+		expected     string
+	}{
+		{
+			distribution: clusterinfo.DistributionElasticsearch,
+			expected: `
+# HELP elasticsearch_ilm_index_status Phase, action and step of the index in its lifecycle policy
+# TYPE elasticsearch_ilm_index_status gauge
+elasticsearch_ilm_index_status{action="rollover",cluster="unknown_cluster",index="logs-1",phase="hot",policy="logs",step="check-rollover-ready"} 1
+# HELP elasticsearch_ilm_status Operating status of ILM
+# TYPE elasticsearch_ilm_status gauge
+elasticsearch_ilm_status{cluster="unknown_cluster",operation_mode="RUNNING"} 1
+elasticsearch_ilm_status{cluster="unknown_cluster",operation_mode="STOPPED"} 0
+elasticsearch_ilm_status{cluster="unknown_cluster",operation_mode="STOPPING"} 0
+`,
+		},
+		{
+			distribution: clusterinfo.DistributionOpenSearch,
+			expected: `
+# HELP elasticsearch_ilm_index_status Phase, action and step of the index in its lifecycle policy
+# TYPE elasticsearch_ilm_index_status gauge
+elasticsearch_ilm_index_status{action="rollover",cluster="unknown_cluster",index="logs-1",phase="hot",policy="logs",step="attempt_rollover"} 1
+`,
+		},
+	} {
+		t.Run(tc.distribution, func(t *testing.T) {
+			c := NewILM(log.NewNopLogger(), http.DefaultClient, u)
+			c.SetVersion(tc.distribution, semver.MustParse("2.3.0"))
+			if err := testutil.CollectAndCompare(wrapCollector{c}, strings.NewReader(tc.expected)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+)
+
+// indexPattern is an index name pattern, either in the wildcard syntax of
+// Elasticsearch, e.g. "logs-*", or a regular expression enclosed in slashes,
+// e.g. "/logs-\d+/".
+type indexPattern struct {
+	// wildcard is the pattern in wildcard syntax, empty for a regular expression.
+	wildcard string
+	re       *regexp.Regexp
+}
+
+func newIndexPattern(p string) (indexPattern, error) {
+	if expr, ok := config.IndexPatternRegexp(p); ok {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return indexPattern{}, fmt.Errorf("invalid index pattern %q: %w", p, err)
+		}
+		return indexPattern{re: re}, nil
+	}
+	if p == "" || strings.ContainsAny(p, ", ") {
+		return indexPattern{}, fmt.Errorf("invalid index pattern %q", p)
+	}
+	re := regexp.MustCompile("^" + strings.ReplaceAll(regexp.QuoteMeta(p), `\*`, ".*") + "$")
+	return indexPattern{wildcard: p, re: re}, nil
+}
+
+// indexFilter selects the indices exported by the index-level collectors. An
+// index is selected if it matches any include pattern, or there is none, and
+// no exclude pattern. A nil indexFilter selects all indices.
+//
+// Wildcard patterns narrow down the indices in the requests to Elasticsearch,
+// regular expressions only apply to the responses.
+type indexFilter struct {
+	include []indexPattern
+	exclude []indexPattern
+}
+
+// newIndexFilter returns the filter of the module options, nil if the options
+// have no patterns.
+func newIndexFilter(options config.ModuleOptions) (*indexFilter, error) {
+	if len(options.IndicesInclude) == 0 && len(options.IndicesExclude) == 0 {
+		return nil, nil
+	}
+	f := &indexFilter{}
+	for _, p := range options.IndicesInclude {
+		pattern, err := newIndexPattern(p)
+		if err != nil {
+			return nil, err
+		}
+		f.include = append(f.include, pattern)
+	}
+	for _, p := range options.IndicesExclude {
+		pattern, err := newIndexPattern(p)
+		if err != nil {
+			return nil, err
+		}
+		f.exclude = append(f.exclude, pattern)
+	}
+	return f, nil
+}
+
+// expression returns the multi-target syntax of the indices to request, e.g.
+// "logs-*,-logs-debug-*", or an empty string if all indices must be requested.
+func (f *indexFilter) expression() string {
+	if f == nil {
+		return ""
+	}
+	var targets []string
+	for _, p := range f.include {
+		// a regular expression may match any index
+		if p.wildcard == "" {
+			targets = nil
+			break
+		}
+		targets = append(targets, p.wildcard)
+	}
+	if len(f.include) == 0 || targets == nil {
+		targets = []string{"*"}
+	}
+	// exclusions only apply to the preceding wildcard expressions
+	if !strings.Contains(strings.Join(targets, ","), "*") {
+		return strings.Join(targets, ",")
+	}
+	for _, p := range f.exclude {
+		if p.wildcard != "" {
+			targets = append(targets, "-"+p.wildcard)
+		}
+	}
+	if len(targets) == 1 && targets[0] == "*" {
+		return ""
+	}
+	return strings.Join(targets, ",")
+}
+
+// expressionParams adds the parameters of the requests of an expression to
+// params, so that included indices which do not exist (yet) are ignored
+// instead of failing the request.
+func expressionParams(params url.Values) url.Values {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("ignore_unavailable", "true")
+	params.Set("allow_no_indices", "true")
+	return params
+}
+
+// match reports whether the index is selected by the filter.
+func (f *indexFilter) match(index string) bool {
+	if f == nil {
+		return true
+	}
+	for _, p := range f.exclude {
+		if p.re.MatchString(index) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, p := range f.include {
+		if p.re.MatchString(index) {
+			return true
+		}
+	}
+	return false
+}
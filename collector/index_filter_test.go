@@ -0,0 +1,189 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+)
+
+func TestIndexFilter(t *testing.T) {
+	indices := []string{"logs-2022.10.01", "logs-debug-2022.10.01", "metrics-1", "metrics-x", ".kibana"}
+
+	for _, tc := range []struct {
+		include, exclude []string
+		expression       string
+		selected         []string
+	}{
+		{nil, nil, "", indices},
+		{[]string{"logs-*"}, nil, "logs-*", []string{"logs-2022.10.01", "logs-debug-2022.10.01"}},
+		{[]string{"logs-*"}, []string{"logs-debug-*"}, "logs-*,-logs-debug-*", []string{"logs-2022.10.01"}},
+		{nil, []string{"logs-*", `/\..*/`}, "*,-logs-*", []string{"metrics-1", "metrics-x"}},
+		{[]string{"logs-*", `/metrics-\d+/`}, []string{"logs-debug-*"}, "*,-logs-debug-*", []string{"logs-2022.10.01", "metrics-1"}},
+		{[]string{`/metrics-.*/`}, []string{`/.*-x/`}, "", []string{"metrics-1"}},
+		{[]string{"metrics-1"}, []string{"metrics-*"}, "metrics-1", nil},
+	} {
+		t.Run(strings.Join(append(tc.include, tc.exclude...), " "), func(t *testing.T) {
+			f, err := newIndexFilter(config.ModuleOptions{IndicesInclude: tc.include, IndicesExclude: tc.exclude})
+			if err != nil {
+				t.Fatalf("Failed to create filter: %s", err)
+			}
+			if expression := f.expression(); expression != tc.expression {
+				t.Errorf("expected expression %q, got %q", tc.expression, expression)
+			}
+			var selected []string
+			for _, index := range indices {
+				if f.match(index) {
+					selected = append(selected, index)
+				}
+			}
+			if strings.Join(selected, " ") != strings.Join(tc.selected, " ") {
+				t.Errorf("expected indices %v, got %v", tc.selected, selected)
+			}
+		})
+	}
+
+	for _, p := range []string{"", "a,b", "/(/"} {
+		if _, err := newIndexFilter(config.ModuleOptions{IndicesInclude: []string{p}}); err == nil {
+			t.Errorf("expected an error for pattern %q", p)
+		}
+	}
+}
+
+func TestIndexFilterRequests(t *testing.T) {
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_stats"):
+			fmt.Fprint(w, `{"indices":{"logs-1":{},"logs-x":{}}}`)
+		case strings.HasSuffix(r.URL.Path, "/_alias"):
+			fmt.Fprint(w, `{"logs-1":{"aliases":{"logs":{}}},"logs-x":{"aliases":{"logs":{}}}}`)
+		case strings.HasSuffix(r.URL.Path, "/_settings"):
+			fmt.Fprint(w, `{"logs-1":{},"logs-x":{}}`)
+		case strings.HasSuffix(r.URL.Path, "/_mappings"):
+			fmt.Fprint(w, `{"logs-1":{},"logs-x":{}}`)
+		case strings.HasPrefix(r.URL.Path, "/_cat/shards"):
+			fmt.Fprint(w, `[{"index":"logs-1","shard":"0","node":"n1"},{"index":"logs-x","shard":"0","node":"n1"}]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	f, err := newIndexFilter(config.ModuleOptions{IndicesInclude: []string{"logs-*"}, IndicesExclude: []string{`/.*-x/`}})
+	if err != nil {
+		t.Fatalf("Failed to create filter: %s", err)
+	}
+	ctx := context.Background()
+
+	i := NewIndices(log.NewNopLogger(), http.DefaultClient, u, false, true)
+	i.filter = f
+	isr, err := i.fetchAndDecodeIndexStats(ctx)
+	if err != nil {
+		t.Fatalf("Failed to fetch index stats: %s", err)
+	}
+	if _, ok := isr.Indices["logs-x"]; ok || len(isr.Indices) != 1 {
+		t.Errorf("expected only index logs-1, got %v", isr.Indices)
+	}
+	if _, ok := isr.Aliases["logs-x"]; ok || len(isr.Aliases) != 1 {
+		t.Errorf("expected only aliases of logs-1, got %v", isr.Aliases)
+	}
+
+	cs := NewIndicesSettings(log.NewNopLogger(), http.DefaultClient, u)
+	cs.filter = f
+	if asr, err := cs.fetchAndDecodeIndicesSettings(ctx); err != nil || len(asr) != 1 {
+		t.Errorf("expected settings of logs-1, got %v (%v)", asr, err)
+	}
+
+	im := NewIndicesMappings(log.NewNopLogger(), http.DefaultClient, u)
+	im.filter = f
+	if imr, err := im.fetchAndDecodeIndicesMappings(ctx); err != nil || len(*imr) != 1 {
+		t.Errorf("expected mappings of logs-1, got %v (%v)", imr, err)
+	}
+
+	s := NewShards(log.NewNopLogger(), http.DefaultClient, u)
+	s.filter = f
+	if sr, err := s.fetchAndDecodeShards(ctx); err != nil || len(sr) != 1 || sr[0].Index != "logs-1" {
+		t.Errorf("expected shards of logs-1, got %v (%v)", sr, err)
+	}
+
+	sort.Strings(paths)
+	expected := []string{"/_cat/shards/logs-*", "/logs-*/_alias", "/logs-*/_mappings", "/logs-*/_settings", "/logs-*/_stats"}
+	if strings.Join(paths, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected requests %v, got %v", expected, paths)
+	}
+}
+
+func TestIndexFilterMissingIndex(t *testing.T) {
+	// Elasticsearch fails the requests of a missing concrete index unless
+	// unavailable indices are ignored
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("ignore_unavailable") != "true" || q.Get("allow_no_indices") != "true" {
+			http.Error(w, `{"error":{"type":"index_not_found_exception"},"status":404}`, http.StatusNotFound)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/_cat/shards") {
+			fmt.Fprint(w, `[]`)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	f, err := newIndexFilter(config.ModuleOptions{IndicesInclude: []string{"logs-2022.10.01"}})
+	if err != nil {
+		t.Fatalf("Failed to create filter: %s", err)
+	}
+	ctx := context.Background()
+
+	i := NewIndices(log.NewNopLogger(), http.DefaultClient, u, false, true)
+	i.filter = f
+	if _, err := i.fetchAndDecodeIndexStats(ctx); err != nil {
+		t.Errorf("unexpected error of the index stats and aliases: %s", err)
+	}
+	cs := NewIndicesSettings(log.NewNopLogger(), http.DefaultClient, u)
+	cs.filter = f
+	if _, err := cs.fetchAndDecodeIndicesSettings(ctx); err != nil {
+		t.Errorf("unexpected error of the settings: %s", err)
+	}
+	im := NewIndicesMappings(log.NewNopLogger(), http.DefaultClient, u)
+	im.filter = f
+	if _, err := im.fetchAndDecodeIndicesMappings(ctx); err != nil {
+		t.Errorf("unexpected error of the mappings: %s", err)
+	}
+	s := NewShards(log.NewNopLogger(), http.DefaultClient, u)
+	s.filter = f
+	if _, err := s.fetchAndDecodeShards(ctx); err != nil {
+		t.Errorf("unexpected error of the shards: %s", err)
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+)
+
+type indexGroupRule struct {
+	re    *regexp.Regexp
+	group string
+}
+
+// groupedIndex holds the counters of an index of a group. offset is the sum of
+// the counters before they have been reset, e.g. by recreating the index, and
+// of the decreases of the counters, e.g. when a shard has been relocated.
+type groupedIndex struct {
+	group  string
+	uuid   string
+	last   []float64
+	offset []float64
+}
+
+// indexGrouper sums the index metrics by index group. The cumulative counters
+// of a group stay monotonic when its indices are deleted, as the last counters
+// of the deleted indices are kept in the group.
+type indexGrouper struct {
+	rules []indexGroupRule
+	// only skips the per-index metrics of the grouped indices.
+	only bool
+
+	mu      sync.Mutex
+	indices map[string]*groupedIndex
+	deleted map[string][]float64
+}
+
+// newIndexGrouper returns the grouper of the module options, nil if the
+// options have no groups.
+func newIndexGrouper(options config.ModuleOptions) (*indexGrouper, error) {
+	if len(options.IndexGroups) == 0 {
+		return nil, nil
+	}
+	g := &indexGrouper{
+		only:    options.IndexGroupsOnly,
+		indices: make(map[string]*groupedIndex),
+		deleted: make(map[string][]float64),
+	}
+	for _, rule := range options.IndexGroups {
+		re, err := regexp.Compile("^(?:" + rule.Regex + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid index group regex %q: %w", rule.Regex, err)
+		}
+		group := rule.Group
+		if group == "" {
+			group = config.DefaultIndexGroup
+		}
+		g.rules = append(g.rules, indexGroupRule{re: re, group: group})
+	}
+	return g, nil
+}
+
+// group returns the group of the index by the first matching rule.
+func (g *indexGrouper) group(index string) (string, bool) {
+	if g == nil {
+		return "", false
+	}
+	for _, rule := range g.rules {
+		if m := rule.re.FindStringSubmatchIndex(index); m != nil {
+			group := rule.re.ExpandString(nil, rule.group, index, m)
+			return string(group), len(group) > 0
+		}
+	}
+	return "", false
+}
+
+// skip reports whether the per-index metrics of the index are not exported.
+func (g *indexGrouper) skip(index string) bool {
+	if g == nil || !g.only {
+		return false
+	}
+	_, ok := g.group(index)
+	return ok
+}
+
+// reset forgets the indices and the counters of the deleted indices.
+func (g *indexGrouper) reset() {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.indices = make(map[string]*groupedIndex)
+	g.deleted = make(map[string][]float64)
+}
+
+// sum returns the values of the metrics summed by group. The indices of the
+// previous call which are missing are considered deleted.
+func (g *indexGrouper) sum(indices map[string]IndexStatsIndexResponse, metrics []*indexMetric) map[string][]float64 {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	sums := make(map[string][]float64)
+	seen := make(map[string]bool, len(indices))
+	for name, stats := range indices {
+		group, ok := g.group(name)
+		if !ok {
+			continue
+		}
+		seen[name] = true
+
+		values := make([]float64, len(metrics))
+		for k, metric := range metrics {
+			values[k] = metric.Value(stats)
+		}
+		index, ok := g.indices[name]
+		if !ok {
+			index = &groupedIndex{group: group, offset: make([]float64, len(metrics))}
+			g.indices[name] = index
+		} else {
+			// only a recreated index starts its counters from zero, a
+			// relocated shard merely takes its share with it
+			recreated := stats.UUID != "" && index.uuid != "" && stats.UUID != index.uuid
+			for k, metric := range metrics {
+				switch {
+				case !metric.cumulative():
+				case recreated:
+					index.offset[k] += index.last[k]
+				case values[k] < index.last[k]:
+					index.offset[k] += index.last[k] - values[k]
+				}
+			}
+		}
+		index.uuid = stats.UUID
+		index.last = values
+
+		sum, ok := sums[group]
+		if !ok {
+			sum = make([]float64, len(metrics))
+			sums[group] = sum
+		}
+		for k, metric := range metrics {
+			sum[k] += values[k]
+			if metric.cumulative() {
+				sum[k] += index.offset[k]
+			}
+		}
+	}
+
+	// keep the counters of the deleted indices in their group
+	for name, index := range g.indices {
+		if seen[name] {
+			continue
+		}
+		deleted, ok := g.deleted[index.group]
+		if !ok {
+			deleted = make([]float64, len(metrics))
+			g.deleted[index.group] = deleted
+		}
+		for k, metric := range metrics {
+			if metric.cumulative() {
+				deleted[k] += index.offset[k] + index.last[k]
+			}
+		}
+		delete(g.indices, name)
+	}
+	for group, deleted := range g.deleted {
+		sum, ok := sums[group]
+		if !ok {
+			sum = make([]float64, len(metrics))
+			sums[group] = sum
+		}
+		for k := range deleted {
+			sum[k] += deleted[k]
+		}
+	}
+	return sums
+}
@@ -0,0 +1,137 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestIndexGrouperGroup(t *testing.T) {
+	g, err := newIndexGrouper(config.ModuleOptions{IndexGroups: []config.IndexGroup{
+		{Regex: `(.+)-\d{4}\.\d{2}\.\d{2}`},
+		{Regex: `\.(kibana|security).*`, Group: "system-$1"},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create grouper: %s", err)
+	}
+	for index, expected := range map[string]string{
+		"logs-2022.10.01":       "logs",
+		"logs-nginx-2022.10.01": "logs-nginx",
+		".kibana_1":             "system-kibana",
+		"logs-current":          "",
+	} {
+		if group, _ := g.group(index); group != expected {
+			t.Errorf("expected group %q for index %s, got %q", expected, index, group)
+		}
+	}
+
+	if _, err := newIndexGrouper(config.ModuleOptions{IndexGroups: []config.IndexGroup{{Regex: "("}}}); err == nil {
+		t.Error("expected an error for an invalid regex")
+	}
+}
+
+func TestIndexGrouperSum(t *testing.T) {
+	g, err := newIndexGrouper(config.ModuleOptions{IndexGroups: []config.IndexGroup{{Regex: `(.+)-\d+`}}})
+	if err != nil {
+		t.Fatalf("Failed to create grouper: %s", err)
+	}
+	metrics := []*indexMetric{
+		{
+			Type:  prometheus.GaugeValue,
+			Value: func(s IndexStatsIndexResponse) float64 { return float64(s.Primaries.Docs.Count) },
+		},
+		{
+			Type:  prometheus.CounterValue,
+			Value: func(s IndexStatsIndexResponse) float64 { return float64(s.Primaries.Indexing.IndexTotal) },
+		},
+		{
+			Type:  prometheus.CounterValue,
+			Size:  true,
+			Value: func(s IndexStatsIndexResponse) float64 { return float64(s.Primaries.QueryCache.MemorySizeInBytes) },
+		},
+	}
+	index := func(uuid string, docs, indexed, cache int64) IndexStatsIndexResponse {
+		var s IndexStatsIndexResponse
+		s.UUID = uuid
+		s.Primaries.Docs.Count = docs
+		s.Primaries.Indexing.IndexTotal = indexed
+		s.Primaries.QueryCache.MemorySizeInBytes = cache
+		return s
+	}
+
+	for _, tc := range []struct {
+		name     string
+		indices  map[string]IndexStatsIndexResponse
+		expected []float64
+	}{
+		{"initial", map[string]IndexStatsIndexResponse{"logs-1": index("a", 10, 100, 30), "logs-2": index("b", 5, 50, 20), "other": index("o", 1, 1, 1)}, []float64{15, 150, 50}},
+		{"index deleted", map[string]IndexStatsIndexResponse{"logs-2": index("b", 6, 60, 25), "logs-3": index("c", 1, 10, 5)}, []float64{7, 170, 30}},
+		// only the decrease of the counter is carried forward
+		{"shard relocated", map[string]IndexStatsIndexResponse{"logs-2": index("b", 3, 30, 10), "logs-3": index("c", 2, 20, 5)}, []float64{5, 180, 15}},
+		{"index recreated", map[string]IndexStatsIndexResponse{"logs-2": index("d", 1, 5, 1), "logs-3": index("c", 2, 20, 5)}, []float64{3, 185, 6}},
+		{"all deleted", nil, []float64{0, 185, 0}},
+	} {
+		sums := g.sum(tc.indices, metrics)
+		if len(sums) != 1 {
+			t.Fatalf("%s: expected 1 group, got %v", tc.name, sums)
+		}
+		if fmt.Sprint(sums["logs"]) != fmt.Sprint(tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, sums["logs"])
+		}
+	}
+}
+
+func TestIndicesGroupsOnly(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"indices":{"logs-2022.10.01":{"primaries":{"docs":{"count":3}}},"logs-2022.10.02":{"primaries":{"docs":{"count":4}}},"other":{}}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	i := NewIndices(log.NewNopLogger(), http.DefaultClient, u, false, false)
+	i.groups, err = newIndexGrouper(config.ModuleOptions{
+		IndexGroups:     []config.IndexGroup{{Regex: `(.+)-\d{4}\.\d{2}\.\d{2}`}},
+		IndexGroupsOnly: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create grouper: %s", err)
+	}
+
+	expected := `
+# HELP elasticsearch_index_group_indices_docs_primary Count of documents with only primary shards
+# TYPE elasticsearch_index_group_indices_docs_primary gauge
+elasticsearch_index_group_indices_docs_primary{cluster="unknown_cluster",index_group="logs"} 7
+# HELP elasticsearch_indices_docs_primary Count of documents with only primary shards
+# TYPE elasticsearch_indices_docs_primary gauge
+elasticsearch_indices_docs_primary{cluster="unknown_cluster",index="other"} 0
+`
+	err = testutil.CollectAndCompare(wrapCollector{i}, strings.NewReader(expected),
+		"elasticsearch_indices_docs_primary", "elasticsearch_index_group_indices_docs_primary")
+	if err != nil {
+		t.Error(err)
+	}
+}
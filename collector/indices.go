@@ -14,30 +14,62 @@
 package collector
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/prometheus-community/elasticsearch_exporter/pkg/clusterinfo"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/esclient"
 	"github.com/prometheus/client_golang/prometheus"
-	"io/ioutil"
 	"net/http"
 	"net/url"
-	"path"
 	"sort"
 	"strconv"
 )
 
+func init() {
+	registerCollector("indices", defaultDisabled, func(logger log.Logger, u *url.URL, hc *http.Client, m *config.Module) (Collector, error) {
+		filter, err := newIndexFilter(m.Options)
+		if err != nil {
+			return nil, err
+		}
+		groups, err := newIndexGrouper(m.Options)
+		if err != nil {
+			return nil, err
+		}
+		i := NewIndices(logger, hc, u, m.Enabled("shards"), m.Options.Aliases)
+		i.filter = filter
+		i.groups = groups
+		i.limiter, err = newSeriesLimiter("indices", m.Options)
+		if err != nil {
+			return nil, err
+		}
+		return i, nil
+	})
+}
+
 type labels struct {
 	keys   func(...string) []string
 	values func(*clusterinfo.Response, ...string) []string
 }
 
 type indexMetric struct {
-	Type   prometheus.ValueType
-	Desc   *prometheus.Desc
-	Value  func(indexStats IndexStatsIndexResponse) float64
-	Labels labels
+	Type prometheus.ValueType
+	// Size marks a metric typed as counter which is a current size, e.g. of
+	// a cache, and decreases without being reset.
+	Size bool
+	Desc *prometheus.Desc
+	// GroupDesc is the metric of the sum of the indices of a group.
+	GroupDesc *prometheus.Desc
+	Value     func(indexStats IndexStatsIndexResponse) float64
+	Labels    labels
+}
+
+// cumulative reports whether the metric only decreases when it is reset, e.g.
+// when the index is recreated.
+func (m *indexMetric) cumulative() bool {
+	return m.Type == prometheus.CounterValue && !m.Size
 }
 
 type shardMetric struct {
@@ -56,17 +88,14 @@ type aliasMetric struct {
 
 // Indices information struct
 type Indices struct {
-	logger          log.Logger
-	client          *http.Client
-	url             *url.URL
-	shards          bool
-	aliases         bool
-	clusterInfoCh   chan *clusterinfo.Response
-	lastClusterInfo *clusterinfo.Response
-
-	up                prometheus.Gauge
-	totalScrapes      prometheus.Counter
-	jsonParseFailures prometheus.Counter
+	logger  log.Logger
+	client  *esclient.Client
+	shards  bool
+	aliases bool
+	filter  *indexFilter
+	groups  *indexGrouper
+	limiter *seriesLimiter
+	clusterLabel
 
 	indexMetrics []*indexMetric
 	shardMetrics []*shardMetric
@@ -84,12 +113,18 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 			if lastClusterinfo != nil {
 				return append(s, lastClusterinfo.ClusterName)
 			}
-			// this shouldn't happen, as the clusterinfo Retriever has a blocking
-			// Run method. It blocks until the first clusterinfo call has succeeded
-			return append(s, "unknown_cluster")
+			// until the first cluster info has been received
+			return append(s, unknownCluster)
 		},
 	}
 
+	indexGroupLabels := labels{
+		keys: func(...string) []string {
+			return []string{"index_group", "cluster"}
+		},
+		values: indexLabels.values,
+	}
+
 	shardLabels := labels{
 		keys: func(...string) []string {
 			return []string{"index", "shard", "node", "primary", "cluster"}
@@ -98,9 +133,8 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 			if lastClusterinfo != nil {
 				return append(s, lastClusterinfo.ClusterName)
 			}
-			// this shouldn't happen, as the clusterinfo Retriever has a blocking
-			// Run method. It blocks until the first clusterinfo call has succeeded
-			return append(s, "unknown_cluster")
+			// until the first cluster info has been received
+			return append(s, unknownCluster)
 		},
 	}
 
@@ -112,35 +146,16 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 			if lastClusterinfo != nil {
 				return append(s, lastClusterinfo.ClusterName)
 			}
-			// this shouldn't happen, as the clusterinfo Retriever has a blocking
-			// Run method. It blocks until the first clusterinfo call has succeeded
-			return append(s, "unknown_cluster")
+			// until the first cluster info has been received
+			return append(s, unknownCluster)
 		},
 	}
 
 	indices := &Indices{
-		logger:        logger,
-		client:        client,
-		url:           url,
-		shards:        shards,
-		aliases:       includeAliases,
-		clusterInfoCh: make(chan *clusterinfo.Response),
-		lastClusterInfo: &clusterinfo.Response{
-			ClusterName: "unknown_cluster",
-		},
-
-		up: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: prometheus.BuildFQName(namespace, "index_stats", "up"),
-			Help: "Was the last scrape of the Elasticsearch index endpoint successful.",
-		}),
-		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: prometheus.BuildFQName(namespace, "index_stats", "total_scrapes"),
-			Help: "Current total Elasticsearch index scrapes.",
-		}),
-		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: prometheus.BuildFQName(namespace, "index_stats", "json_parse_failures"),
-			Help: "Number of errors while parsing JSON.",
-		}),
+		logger:  logger,
+		client:  esclient.New(logger, client, url),
+		shards:  shards,
+		aliases: includeAliases,
 
 		indexMetrics: []*indexMetric{
 			{
@@ -150,6 +165,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Count of documents with only primary shards",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_docs_primary"),
+					"Count of documents with only primary shards",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Primaries.Docs.Count)
 				},
@@ -162,6 +182,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Count of deleted documents with only primary shards",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_deleted_docs_primary"),
+					"Count of deleted documents with only primary shards",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Primaries.Docs.Deleted)
 				},
@@ -174,6 +199,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total count of documents",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_docs_total"),
+					"Total count of documents",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Docs.Count)
 				},
@@ -186,6 +216,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total count of deleted documents",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_deleted_docs_total"),
+					"Total count of deleted documents",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Docs.Deleted)
 				},
@@ -198,6 +233,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current total size of stored index data in bytes with only primary shards on all nodes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_store_size_bytes_primary"),
+					"Current total size of stored index data in bytes with only primary shards on all nodes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Primaries.Store.SizeInBytes)
 				},
@@ -210,6 +250,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current total size of stored index data in bytes with all shards on all nodes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_store_size_bytes_total"),
+					"Current total size of stored index data in bytes with all shards on all nodes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Store.SizeInBytes)
 				},
@@ -222,6 +267,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current number of segments with only primary shards on all nodes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_segment_count_primary"),
+					"Current number of segments with only primary shards on all nodes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Primaries.Segments.Count)
 				},
@@ -234,6 +284,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current number of segments with all shards on all nodes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_segment_count_total"),
+					"Current number of segments with all shards on all nodes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Segments.Count)
 				},
@@ -246,6 +301,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current size of segments with only primary shards on all nodes in bytes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_segment_memory_bytes_primary"),
+					"Current size of segments with only primary shards on all nodes in bytes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Primaries.Segments.MemoryInBytes)
 				},
@@ -258,6 +318,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current size of segments with all shards on all nodes in bytes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_segment_memory_bytes_total"),
+					"Current size of segments with all shards on all nodes in bytes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Segments.MemoryInBytes)
 				},
@@ -270,6 +335,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current size of terms with only primary shards on all nodes in bytes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_segment_terms_memory_primary"),
+					"Current size of terms with only primary shards on all nodes in bytes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Primaries.Segments.TermsMemoryInBytes)
 				},
@@ -282,6 +352,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current number of terms with all shards on all nodes in bytes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_segment_terms_memory_total"),
+					"Current number of terms with all shards on all nodes in bytes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Segments.TermsMemoryInBytes)
 				},
@@ -294,6 +369,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current size of fields with only primary shards on all nodes in bytes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_segment_fields_memory_bytes_primary"),
+					"Current size of fields with only primary shards on all nodes in bytes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Primaries.Segments.StoredFieldsMemoryInBytes)
 				},
@@ -306,6 +386,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current size of fields with all shards on all nodes in bytes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_segment_fields_memory_bytes_total"),
+					"Current size of fields with all shards on all nodes in bytes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Segments.StoredFieldsMemoryInBytes)
 				},
@@ -318,6 +403,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current size of term vectors with only primary shards on all nodes in bytes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_segment_term_vectors_memory_primary_bytes"),
+					"Current size of term vectors with only primary shards on all nodes in bytes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Primaries.Segments.TermVectorsMemoryInBytes)
 				},
@@ -330,6 +420,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current size of term vectors with all shards on all nodes in bytes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_segment_term_vectors_memory_total_bytes"),
+					"Current size of term vectors with all shards on all nodes in bytes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Segments.TermVectorsMemoryInBytes)
 				},
@@ -342,6 +437,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current size of norms with only primary shards on all nodes in bytes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_segment_norms_memory_bytes_primary"),
+					"Current size of norms with only primary shards on all nodes in bytes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Primaries.Segments.NormsMemoryInBytes)
 				},
@@ -354,6 +454,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current size of norms with all shards on all nodes in bytes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_segment_norms_memory_bytes_total"),
+					"Current size of norms with all shards on all nodes in bytes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Segments.NormsMemoryInBytes)
 				},
@@ -366,6 +471,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current size of points with only primary shards on all nodes in bytes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_segment_points_memory_bytes_primary"),
+					"Current size of points with only primary shards on all nodes in bytes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Primaries.Segments.PointsMemoryInBytes)
 				},
@@ -378,6 +488,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current size of points with all shards on all nodes in bytes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_segment_points_memory_bytes_total"),
+					"Current size of points with all shards on all nodes in bytes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Segments.PointsMemoryInBytes)
 				},
@@ -390,6 +505,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current size of doc values with only primary shards on all nodes in bytes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_segment_doc_values_memory_bytes_primary"),
+					"Current size of doc values with only primary shards on all nodes in bytes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Primaries.Segments.DocValuesMemoryInBytes)
 				},
@@ -402,6 +522,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current size of doc values with all shards on all nodes in bytes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_segment_doc_values_memory_bytes_total"),
+					"Current size of doc values with all shards on all nodes in bytes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Segments.DocValuesMemoryInBytes)
 				},
@@ -414,6 +539,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current size of index writer with only primary shards on all nodes in bytes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_segment_index_writer_memory_bytes_primary"),
+					"Current size of index writer with only primary shards on all nodes in bytes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Primaries.Segments.IndexWriterMemoryInBytes)
 				},
@@ -426,6 +556,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current size of index writer with all shards on all nodes in bytes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_segment_index_writer_memory_bytes_total"),
+					"Current size of index writer with all shards on all nodes in bytes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Segments.IndexWriterMemoryInBytes)
 				},
@@ -438,6 +573,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current size of version map with only primary shards on all nodes in bytes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_segment_version_map_memory_bytes_primary"),
+					"Current size of version map with only primary shards on all nodes in bytes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Primaries.Segments.VersionMapMemoryInBytes)
 				},
@@ -450,6 +590,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current size of version map with all shards on all nodes in bytes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_segment_version_map_memory_bytes_total"),
+					"Current size of version map with all shards on all nodes in bytes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Segments.VersionMapMemoryInBytes)
 				},
@@ -462,6 +607,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current size of fixed bit with only primary shards on all nodes in bytes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_segment_fixed_bit_set_memory_bytes_primary"),
+					"Current size of fixed bit with only primary shards on all nodes in bytes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Primaries.Segments.FixedBitSetMemoryInBytes)
 				},
@@ -474,6 +624,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current size of fixed bit with all shards on all nodes in bytes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_segment_fixed_bit_set_memory_bytes_total"),
+					"Current size of fixed bit with all shards on all nodes in bytes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Segments.FixedBitSetMemoryInBytes)
 				},
@@ -486,6 +641,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current size of completion with only primary shards on all nodes in bytes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_completion_bytes_primary"),
+					"Current size of completion with only primary shards on all nodes in bytes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Primaries.Completion.SizeInBytes)
 				},
@@ -498,6 +658,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current size of completion with all shards on all nodes in bytes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "indices_completion_bytes_total"),
+					"Current size of completion with all shards on all nodes in bytes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Completion.SizeInBytes)
 				},
@@ -510,6 +675,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total search query time in seconds",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_search_query_time_seconds_total"),
+					"Total search query time in seconds",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Search.QueryTimeInMillis) / 1000
 				},
@@ -522,6 +692,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"The number of currently active queries",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "search_active_queries"),
+					"The number of currently active queries",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Search.QueryCurrent)
 				},
@@ -534,6 +709,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total number of queries",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_search_query_total"),
+					"Total number of queries",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Search.QueryTotal)
 				},
@@ -546,6 +726,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total search fetch time in seconds",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_search_fetch_time_seconds_total"),
+					"Total search fetch time in seconds",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Search.FetchTimeInMillis) / 1000
 				},
@@ -558,6 +743,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total search fetch count",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_search_fetch_total"),
+					"Total search fetch count",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Search.FetchTotal)
 				},
@@ -570,6 +760,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total search scroll time in seconds",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_search_scroll_time_seconds_total"),
+					"Total search scroll time in seconds",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Search.ScrollTimeInMillis) / 1000
 				},
@@ -582,6 +777,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Current search scroll count",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_search_scroll_current"),
+					"Current search scroll count",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Search.ScrollCurrent)
 				},
@@ -594,6 +794,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total search scroll count",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_search_scroll_total"),
+					"Total search scroll count",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Search.ScrollTotal)
 				},
@@ -606,6 +811,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total search suggest time in seconds",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_search_suggest_time_seconds_total"),
+					"Total search suggest time in seconds",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Search.SuggestTimeInMillis) / 1000
 				},
@@ -618,6 +828,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total search suggest count",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_search_suggest_total"),
+					"Total search suggest count",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Search.SuggestTotal)
 				},
@@ -630,6 +845,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total indexing index time in seconds",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_indexing_index_time_seconds_total"),
+					"Total indexing index time in seconds",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Indexing.IndexTimeInMillis) / 1000
 				},
@@ -642,6 +862,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"The number of documents currently being indexed to an index",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_index_current"),
+					"The number of documents currently being indexed to an index",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Indexing.IndexCurrent)
 				},
@@ -654,6 +879,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total indexing index count",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_indexing_index_total"),
+					"Total indexing index count",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Indexing.IndexTotal)
 				},
@@ -666,6 +896,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total indexing delete time in seconds",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_indexing_delete_time_seconds_total"),
+					"Total indexing delete time in seconds",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Indexing.DeleteTimeInMillis) / 1000
 				},
@@ -678,6 +913,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total indexing delete count",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_indexing_delete_total"),
+					"Total indexing delete count",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Indexing.DeleteTotal)
 				},
@@ -690,6 +930,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total indexing no-op update count",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_indexing_noop_update_total"),
+					"Total indexing no-op update count",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Indexing.NoopUpdateTotal)
 				},
@@ -702,6 +947,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total indexing throttle time in seconds",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_indexing_throttle_time_seconds_total"),
+					"Total indexing throttle time in seconds",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Indexing.ThrottleTimeInMillis) / 1000
 				},
@@ -714,6 +964,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total get time in seconds",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_get_time_seconds_total"),
+					"Total get time in seconds",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Get.TimeInMillis) / 1000
 				},
@@ -726,6 +981,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total get count",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_get_total"),
+					"Total get count",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Get.Total)
 				},
@@ -738,6 +998,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total merge time in seconds",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_merge_time_seconds_total"),
+					"Total merge time in seconds",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Merges.TotalTimeInMillis) / 1000
 				},
@@ -750,6 +1015,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total merge count",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_merge_total"),
+					"Total merge count",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Merges.Total)
 				},
@@ -762,6 +1032,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total merge I/O throttle time in seconds",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_merge_throttle_time_seconds_total"),
+					"Total merge I/O throttle time in seconds",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Merges.TotalThrottledTimeInMillis) / 1000
 				},
@@ -774,6 +1049,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total large merge stopped time in seconds, allowing smaller merges to complete",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_merge_stopped_time_seconds_total"),
+					"Total large merge stopped time in seconds, allowing smaller merges to complete",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Merges.TotalStoppedTimeInMillis) / 1000
 				},
@@ -781,11 +1061,17 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 			},
 			{
 				Type: prometheus.CounterValue,
+				Size: true,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "index_stats", "merge_auto_throttle_bytes_total"),
 					"Total bytes that were auto-throttled during merging",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_merge_auto_throttle_bytes_total"),
+					"Total bytes that were auto-throttled during merging",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Merges.TotalAutoThrottleInBytes)
 				},
@@ -798,6 +1084,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total refresh time in seconds",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_refresh_time_seconds_total"),
+					"Total refresh time in seconds",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Refresh.TotalTimeInMillis) / 1000
 				},
@@ -810,6 +1101,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total refresh count",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_refresh_total"),
+					"Total refresh count",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Refresh.Total)
 				},
@@ -822,6 +1118,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total flush time in seconds",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_flush_time_seconds_total"),
+					"Total flush time in seconds",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Flush.TotalTimeInMillis) / 1000
 				},
@@ -834,6 +1135,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total flush count",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_flush_total"),
+					"Total flush count",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Flush.Total)
 				},
@@ -846,6 +1152,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total warmer time in seconds",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_warmer_time_seconds_total"),
+					"Total warmer time in seconds",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Warmer.TotalTimeInMillis) / 1000
 				},
@@ -858,6 +1169,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total warmer count",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_warmer_total"),
+					"Total warmer count",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Warmer.Total)
 				},
@@ -865,11 +1181,17 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 			},
 			{
 				Type: prometheus.CounterValue,
+				Size: true,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "index_stats", "query_cache_memory_bytes_total"),
 					"Total query cache memory bytes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_query_cache_memory_bytes_total"),
+					"Total query cache memory bytes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.QueryCache.MemorySizeInBytes)
 				},
@@ -882,6 +1204,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total query cache size",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_query_cache_size"),
+					"Total query cache size",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.QueryCache.CacheSize)
 				},
@@ -894,6 +1221,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total query cache hits count",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_query_cache_hits_total"),
+					"Total query cache hits count",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.QueryCache.HitCount)
 				},
@@ -906,6 +1238,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total query cache misses count",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_query_cache_misses_total"),
+					"Total query cache misses count",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.QueryCache.MissCount)
 				},
@@ -918,6 +1255,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total query cache caches count",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_query_cache_caches_total"),
+					"Total query cache caches count",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.QueryCache.CacheCount)
 				},
@@ -930,6 +1272,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total query cache evictions count",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_query_cache_evictions_total"),
+					"Total query cache evictions count",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.QueryCache.Evictions)
 				},
@@ -937,11 +1284,17 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 			},
 			{
 				Type: prometheus.CounterValue,
+				Size: true,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "index_stats", "request_cache_memory_bytes_total"),
 					"Total request cache memory bytes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_request_cache_memory_bytes_total"),
+					"Total request cache memory bytes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.RequestCache.MemorySizeInBytes)
 				},
@@ -954,6 +1307,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total request cache hits count",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_request_cache_hits_total"),
+					"Total request cache hits count",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.RequestCache.HitCount)
 				},
@@ -966,6 +1324,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total request cache misses count",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_request_cache_misses_total"),
+					"Total request cache misses count",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.RequestCache.MissCount)
 				},
@@ -978,6 +1341,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total request cache evictions count",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_request_cache_evictions_total"),
+					"Total request cache evictions count",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.RequestCache.Evictions)
 				},
@@ -985,11 +1353,17 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 			},
 			{
 				Type: prometheus.CounterValue,
+				Size: true,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "index_stats", "fielddata_memory_bytes_total"),
 					"Total fielddata memory bytes",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_fielddata_memory_bytes_total"),
+					"Total fielddata memory bytes",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Fielddata.MemorySizeInBytes)
 				},
@@ -1002,6 +1376,11 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 					"Total fielddata evictions count",
 					indexLabels.keys(), nil,
 				),
+				GroupDesc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "index_group", "index_stats_fielddata_evictions_total"),
+					"Total fielddata evictions count",
+					indexGroupLabels.keys(), nil,
+				),
 				Value: func(indexStats IndexStatsIndexResponse) float64 {
 					return float64(indexStats.Total.Fielddata.Evictions)
 				},
@@ -1062,72 +1441,41 @@ func NewIndices(logger log.Logger, client *http.Client, url *url.URL, shards boo
 			},
 		},
 	}
-
-	// start go routine to fetch clusterinfo updates and save them to lastClusterinfo
-	go func() {
-		_ = level.Debug(logger).Log("msg", "starting cluster info receive loop")
-		for ci := range indices.clusterInfoCh {
-			if ci != nil {
-				_ = level.Debug(logger).Log("msg", "received cluster info update", "cluster", ci.ClusterName)
-				indices.lastClusterInfo = ci
-			}
-		}
-		_ = level.Debug(logger).Log("msg", "exiting cluster info receive loop")
-	}()
 	return indices
 }
 
-// ClusterLabelUpdates returns a pointer to a channel to receive cluster info updates. It implements the
-// (not exported) clusterinfo.consumer interface
-func (i *Indices) ClusterLabelUpdates() *chan *clusterinfo.Response {
-	return &i.clusterInfoCh
-}
-
-// String implements the stringer interface. It is part of the clusterinfo.consumer interface
-func (i *Indices) String() string {
-	return namespace + "indices"
-}
-
-// Describe add Indices metrics descriptions
-func (i *Indices) Describe(ch chan<- *prometheus.Desc) {
-	for _, metric := range i.indexMetrics {
-		ch <- metric.Desc
-	}
-	ch <- i.up.Desc()
-	ch <- i.totalScrapes.Desc()
-	ch <- i.jsonParseFailures.Desc()
-}
-
-func (i *Indices) fetchAndDecodeIndexStats() (indexStatsResponse, error) {
+func (i *Indices) fetchAndDecodeIndexStats(ctx context.Context) (indexStatsResponse, error) {
 	var isr indexStatsResponse
 
-	u := *i.url
-	u.Path = path.Join(u.Path, "/_all/_stats")
+	params := expressionParams(nil)
 	if i.shards {
-		u.RawQuery = "ignore_unavailable=true&level=shards"
-	} else {
-		u.RawQuery = "ignore_unavailable=true"
+		params.Set("level", "shards")
 	}
-
-	bts, err := i.queryURL(&u)
-	if err != nil {
-		return isr, err
+	p := "/_all/_stats"
+	if expr := i.filter.expression(); expr != "" {
+		p = "/" + expr + "/_stats"
 	}
-
-	if err := json.Unmarshal(bts, &isr); err != nil {
-		i.jsonParseFailures.Inc()
+	if err := i.client.Get(ctx, p, params, &isr); err != nil {
 		return isr, err
 	}
+	for indexName := range isr.Indices {
+		if !i.filter.match(indexName) {
+			delete(isr.Indices, indexName)
+		}
+	}
 
 	if i.aliases {
 		isr.Aliases = map[string][]string{}
-		asr, err := i.fetchAndDecodeAliases()
+		asr, err := i.fetchAndDecodeAliases(ctx)
 		if err != nil {
 			_ = level.Error(i.logger).Log("err", err.Error())
 			return isr, err
 		}
 
 		for indexName, aliases := range asr {
+			if !i.filter.match(indexName) {
+				continue
+			}
 			var aliasList []string
 			for aliasName := range aliases.Aliases {
 				aliasList = append(aliasList, aliasName)
@@ -1143,81 +1491,81 @@ func (i *Indices) fetchAndDecodeIndexStats() (indexStatsResponse, error) {
 	return isr, nil
 }
 
-func (i *Indices) fetchAndDecodeAliases() (aliasesResponse, error) {
+func (i *Indices) fetchAndDecodeAliases(ctx context.Context) (aliasesResponse, error) {
 	var asr aliasesResponse
-
-	u := *i.url
-	u.Path = path.Join(u.Path, "/_alias")
-
-	bts, err := i.queryURL(&u)
-	if err != nil {
-		return asr, err
-	}
-
-	if err := json.Unmarshal(bts, &asr); err != nil {
-		i.jsonParseFailures.Inc()
-		return asr, err
+	p := "/_alias"
+	var params url.Values
+	if expr := i.filter.expression(); expr != "" {
+		p = "/" + expr + "/_alias"
+		params = expressionParams(nil)
 	}
-
-	return asr, nil
+	err := i.client.Get(ctx, p, params, &asr)
+	return asr, err
 }
 
-func (i *Indices) queryURL(u *url.URL) ([]byte, error) {
-	res, err := i.client.Get(u.String())
-	if err != nil {
-		return []byte{}, fmt.Errorf("failed to get resource from %s://%s:%s%s: %s",
-			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+// limitSeries returns the indices to fold into the other index as their
+// series exceed the series limit.
+func (i *Indices) limitSeries(isr indexStatsResponse) map[string]bool {
+	if i.limiter == nil {
+		return nil
 	}
-
-	defer func() {
-		err = res.Body.Close()
-		if err != nil {
-			_ = level.Warn(i.logger).Log(
-				"msg", "failed to close http.Client",
-				"err", err,
-			)
+	var names []string
+	for indexName := range isr.Indices {
+		if !i.groups.skip(indexName) {
+			names = append(names, indexName)
 		}
-	}()
-
-	if res.StatusCode != http.StatusOK {
-		return []byte{}, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
 	}
-
-	bts, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return []byte{}, err
+	if i.aliases {
+		for indexName := range isr.Aliases {
+			if _, ok := isr.Indices[indexName]; !ok && !i.groups.skip(indexName) {
+				names = append(names, indexName)
+			}
+		}
 	}
-
-	return bts, nil
+	series := func(indexName string) int {
+		var n int
+		if indexStats, ok := isr.Indices[indexName]; ok {
+			n += len(i.indexMetrics)
+			if i.shards {
+				for _, shards := range indexStats.Shards {
+					n += len(shards) * len(i.shardMetrics)
+				}
+			}
+		}
+		if i.aliases {
+			n += len(isr.Aliases[indexName]) * len(i.aliasMetrics)
+		}
+		return n
+	}
+	return i.limiter.fold(isr.Indices, names, series, len(i.indexMetrics))
 }
 
-// Collect gets Indices metric values
-func (i *Indices) Collect(ch chan<- prometheus.Metric) {
-	i.totalScrapes.Inc()
-	defer func() {
-		ch <- i.up
-		ch <- i.totalScrapes
-		ch <- i.jsonParseFailures
-	}()
+// reset forgets the counters of the index groups and the dropped series of
+// the previous cluster.
+func (i *Indices) reset() {
+	i.groups.reset()
+	i.limiter.reset()
+}
 
+// Update gets Indices metric values
+func (i *Indices) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	// indices
-	indexStatsResp, err := i.fetchAndDecodeIndexStats()
+	indexStatsResp, err := i.fetchAndDecodeIndexStats(ctx)
 	if err != nil {
-		i.up.Set(0)
-		_ = level.Warn(i.logger).Log(
-			"msg", "failed to fetch and decode index stats",
-			"err", err,
-		)
-		return
+		return fmt.Errorf("failed to fetch and decode index stats: %w", err)
 	}
-	i.up.Set(1)
+	folded := i.limitSeries(indexStatsResp)
+	ci := i.clusterInfo()
 
 	// Alias stats
 	if i.aliases {
 		for _, metric := range i.aliasMetrics {
 			for indexName, aliases := range indexStatsResp.Aliases {
+				if i.groups.skip(indexName) || folded[indexName] {
+					continue
+				}
 				for _, alias := range aliases {
-					labelValues := metric.Labels.values(i.lastClusterInfo, indexName, alias)
+					labelValues := metric.Labels.values(ci, indexName, alias)
 
 					ch <- prometheus.MustNewConstMetric(
 						metric.Desc,
@@ -1230,14 +1578,29 @@ func (i *Indices) Collect(ch chan<- prometheus.Metric) {
 		}
 	}
 
+	// Index group stats
+	for group, values := range i.groups.sum(indexStatsResp.Indices, i.indexMetrics) {
+		for k, metric := range i.indexMetrics {
+			ch <- prometheus.MustNewConstMetric(
+				metric.GroupDesc,
+				metric.Type,
+				values[k],
+				metric.Labels.values(ci, group)...,
+			)
+		}
+	}
+
 	// Index stats
 	for indexName, indexStats := range indexStatsResp.Indices {
+		if i.groups.skip(indexName) || folded[indexName] {
+			continue
+		}
 		for _, metric := range i.indexMetrics {
 			ch <- prometheus.MustNewConstMetric(
 				metric.Desc,
 				metric.Type,
 				metric.Value(indexStats),
-				metric.Labels.values(i.lastClusterInfo, indexName)...,
+				metric.Labels.values(ci, indexName)...,
 			)
 
 		}
@@ -1250,11 +1613,24 @@ func (i *Indices) Collect(ch chan<- prometheus.Metric) {
 							metric.Desc,
 							metric.Type,
 							metric.Value(shard),
-							metric.Labels.values(i.lastClusterInfo, indexName, shardNumber, shard.Routing.Node, strconv.FormatBool(shard.Routing.Primary))...,
+							metric.Labels.values(ci, indexName, shardNumber, shard.Routing.Node, strconv.FormatBool(shard.Routing.Primary))...,
 						)
 					}
 				}
 			}
 		}
 	}
+	if other := i.limiter.sumOther(indexStatsResp.Indices, folded, i.indexMetrics); other != nil {
+		for k, metric := range i.indexMetrics {
+			ch <- prometheus.MustNewConstMetric(
+				metric.Desc,
+				metric.Type,
+				other[k],
+				metric.Labels.values(ci, otherIndex)...,
+			)
+		}
+	}
+	i.limiter.collect(ch)
+
+	return nil
 }
@@ -14,20 +14,31 @@
 package collector
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
-	"path"
 
 	"github.com/go-kit/log"
-	"github.com/go-kit/log/level"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/esclient"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+func init() {
+	registerCollector("indices-mappings", defaultDisabled, func(logger log.Logger, u *url.URL, hc *http.Client, m *config.Module) (Collector, error) {
+		filter, err := newIndexFilter(m.Options)
+		if err != nil {
+			return nil, err
+		}
+		im := NewIndicesMappings(logger, hc, u)
+		im.filter = filter
+		return im, nil
+	})
+}
+
 var (
-	defaultIndicesMappingsLabels = []string{"index"}
+	defaultIndicesMappingsLabels = []string{"index", "cluster"}
 )
 
 type indicesMappingsMetric struct {
@@ -39,11 +50,9 @@ type indicesMappingsMetric struct {
 // IndicesMappings information struct
 type IndicesMappings struct {
 	logger log.Logger
-	client *http.Client
-	url    *url.URL
-
-	up                              prometheus.Gauge
-	totalScrapes, jsonParseFailures prometheus.Counter
+	client *esclient.Client
+	clusterLabel
+	filter *indexFilter
 
 	metrics []*indicesMappingsMetric
 }
@@ -54,21 +63,8 @@ func NewIndicesMappings(logger log.Logger, client *http.Client, url *url.URL) *I
 
 	return &IndicesMappings{
 		logger: logger,
-		client: client,
-		url:    url,
-
-		up: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: prometheus.BuildFQName(namespace, subsystem, "up"),
-			Help: "Was the last scrape of the Elasticsearch Indices Mappings endpoint successful.",
-		}),
-		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: prometheus.BuildFQName(namespace, subsystem, "scrapes_total"),
-			Help: "Current total Elasticsearch Indices Mappings scrapes.",
-		}),
-		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: prometheus.BuildFQName(namespace, subsystem, "json_parse_failures_total"),
-			Help: "Number of errors while parsing JSON.",
-		}),
+		client: esclient.New(logger, client, url),
+
 		metrics: []*indicesMappingsMetric{
 			{
 				Type: prometheus.GaugeValue,
@@ -110,75 +106,31 @@ func countFieldsRecursive(properties IndexMappingProperties, fieldCounter float6
 	return fieldCounter
 }
 
-// Describe add Snapshots metrics descriptions
-func (im *IndicesMappings) Describe(ch chan<- *prometheus.Desc) {
-	for _, metric := range im.metrics {
-		ch <- metric.Desc
-	}
-
-	ch <- im.up.Desc()
-	ch <- im.totalScrapes.Desc()
-	ch <- im.jsonParseFailures.Desc()
-}
-
-func (im *IndicesMappings) getAndParseURL(u *url.URL) (*IndicesMappingsResponse, error) {
-	res, err := im.client.Get(u.String())
-	if err != nil {
-		return nil, fmt.Errorf("failed to get from %s://%s:%s%s: %s",
-			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
-	}
-
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
-	}
-
-	body, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		_ = level.Warn(im.logger).Log("msg", "failed to read response body", "err", err)
-		return nil, err
+func (im *IndicesMappings) fetchAndDecodeIndicesMappings(ctx context.Context) (*IndicesMappingsResponse, error) {
+	var imr IndicesMappingsResponse
+	p := "/_all/_mappings"
+	var params url.Values
+	if expr := im.filter.expression(); expr != "" {
+		p = "/" + expr + "/_mappings"
+		params = expressionParams(nil)
 	}
-
-	err = res.Body.Close()
-	if err != nil {
-		_ = level.Warn(im.logger).Log("msg", "failed to close response body", "err", err)
+	if err := im.client.Get(ctx, p, params, &imr); err != nil {
 		return nil, err
 	}
-
-	var imr IndicesMappingsResponse
-	if err := json.Unmarshal(body, &imr); err != nil {
-		im.jsonParseFailures.Inc()
-		return nil, err
+	for indexName := range imr {
+		if !im.filter.match(indexName) {
+			delete(imr, indexName)
+		}
 	}
-
 	return &imr, nil
 }
 
-func (im *IndicesMappings) fetchAndDecodeIndicesMappings() (*IndicesMappingsResponse, error) {
-	u := *im.url
-	u.Path = path.Join(u.Path, "/_all/_mappings")
-	return im.getAndParseURL(&u)
-}
-
-// Collect gets all indices mappings metric values
-func (im *IndicesMappings) Collect(ch chan<- prometheus.Metric) {
-
-	im.totalScrapes.Inc()
-	defer func() {
-		ch <- im.up
-		ch <- im.totalScrapes
-		ch <- im.jsonParseFailures
-	}()
-
-	indicesMappingsResponse, err := im.fetchAndDecodeIndicesMappings()
+// Update gets all indices mappings metric values
+func (im *IndicesMappings) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	indicesMappingsResponse, err := im.fetchAndDecodeIndicesMappings(ctx)
 	if err != nil {
-		im.up.Set(0)
-		_ = level.Warn(im.logger).Log(
-			"msg", "failed to fetch and decode cluster mappings stats",
-			"err", err,
-		)
-		return
+		return fmt.Errorf("failed to fetch and decode cluster mappings stats: %w", err)
 	}
-	im.up.Set(1)
 
 	for _, metric := range im.metrics {
 		for indexName, mappings := range *indicesMappingsResponse {
@@ -186,8 +138,10 @@ func (im *IndicesMappings) Collect(ch chan<- prometheus.Metric) {
 				metric.Desc,
 				metric.Type,
 				metric.Value(mappings),
-				indexName,
+				indexName, im.clusterName(),
 			)
 		}
 	}
+
+	return nil
 }
@@ -14,6 +14,7 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -125,7 +126,7 @@ func TestMapping(t *testing.T) {
 				t.Fatalf("Failed to parse URL: %s", err)
 			}
 			c := NewIndicesMappings(log.NewNopLogger(), http.DefaultClient, u)
-			imr, err := c.fetchAndDecodeIndicesMappings()
+			imr, err := c.fetchAndDecodeIndicesMappings(context.Background())
 			if err != nil {
 				t.Fatalf("Failed to fetch or decode indices mappings: %s", err)
 			}
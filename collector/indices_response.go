@@ -38,6 +38,7 @@ type IndexStatsShardsResponse struct {
 
 // IndexStatsIndexResponse defines index stats index information structure
 type IndexStatsIndexResponse struct {
+	UUID      string                                           `json:"uuid"`
 	Primaries IndexStatsIndexDetailResponse                    `json:"primaries"`
 	Total     IndexStatsIndexDetailResponse                    `json:"total"`
 	Shards    map[string][]IndexStatsIndexShardsDetailResponse `json:"shards"`
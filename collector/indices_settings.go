@@ -14,34 +14,44 @@
 package collector
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
-	"path"
 	"strconv"
 
 	"github.com/go-kit/log"
-	"github.com/go-kit/log/level"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/esclient"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+func init() {
+	registerCollector("indices-settings", defaultDisabled, func(logger log.Logger, u *url.URL, hc *http.Client, m *config.Module) (Collector, error) {
+		filter, err := newIndexFilter(m.Options)
+		if err != nil {
+			return nil, err
+		}
+		cs := NewIndicesSettings(logger, hc, u)
+		cs.filter = filter
+		return cs, nil
+	})
+}
+
 // IndicesSettings information struct
 type IndicesSettings struct {
 	logger log.Logger
-	client *http.Client
-	url    *url.URL
+	client *esclient.Client
+	clusterLabel
+	filter *indexFilter
 
-	up              prometheus.Gauge
-	readOnlyIndices prometheus.Gauge
+	readOnlyIndices *prometheus.Desc
 
-	totalScrapes, jsonParseFailures prometheus.Counter
-	metrics                         []*indicesSettingsMetric
+	metrics []*indicesSettingsMetric
 }
 
 var (
-	defaultIndicesTotalFieldsLabels = []string{"index"}
+	defaultIndicesTotalFieldsLabels = []string{"index", "cluster"}
 	defaultTotalFieldsValue         = 1000 //es default configuration for total fields
 )
 
@@ -55,25 +65,13 @@ type indicesSettingsMetric struct {
 func NewIndicesSettings(logger log.Logger, client *http.Client, url *url.URL) *IndicesSettings {
 	return &IndicesSettings{
 		logger: logger,
-		client: client,
-		url:    url,
+		client: esclient.New(logger, client, url),
 
-		up: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: prometheus.BuildFQName(namespace, "indices_settings_stats", "up"),
-			Help: "Was the last scrape of the Elasticsearch Indices Settings endpoint successful.",
-		}),
-		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: prometheus.BuildFQName(namespace, "indices_settings_stats", "total_scrapes"),
-			Help: "Current total Elasticsearch Indices Settings scrapes.",
-		}),
-		readOnlyIndices: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: prometheus.BuildFQName(namespace, "indices_settings_stats", "read_only_indices"),
-			Help: "Current number of read only indices within cluster",
-		}),
-		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: prometheus.BuildFQName(namespace, "indices_settings_stats", "json_parse_failures"),
-			Help: "Number of errors while parsing JSON.",
-		}),
+		readOnlyIndices: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "indices_settings_stats", "read_only_indices"),
+			"Current number of read only indices within cluster",
+			defaultClusterLabels, nil,
+		),
 		metrics: []*indicesSettingsMetric{
 			{
 				Type: prometheus.GaugeValue,
@@ -109,83 +107,31 @@ func NewIndicesSettings(logger log.Logger, client *http.Client, url *url.URL) *I
 	}
 }
 
-// Describe add Snapshots metrics descriptions
-func (cs *IndicesSettings) Describe(ch chan<- *prometheus.Desc) {
-	ch <- cs.up.Desc()
-	ch <- cs.totalScrapes.Desc()
-	ch <- cs.readOnlyIndices.Desc()
-	ch <- cs.jsonParseFailures.Desc()
-}
-
-func (cs *IndicesSettings) getAndParseURL(u *url.URL, data interface{}) error {
-	res, err := cs.client.Get(u.String())
-	if err != nil {
-		return fmt.Errorf("failed to get from %s://%s:%s%s: %s",
-			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
-	}
-
-	defer func() {
-		err = res.Body.Close()
-		if err != nil {
-			_ = level.Warn(cs.logger).Log(
-				"msg", "failed to close http.Client",
-				"err", err,
-			)
-		}
-	}()
-
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
-	}
-
-	bts, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		cs.jsonParseFailures.Inc()
-		return err
-	}
-
-	if err := json.Unmarshal(bts, data); err != nil {
-		cs.jsonParseFailures.Inc()
-		return err
-	}
-	return nil
-}
-
-func (cs *IndicesSettings) fetchAndDecodeIndicesSettings() (IndicesSettingsResponse, error) {
-
-	u := *cs.url
-	u.Path = path.Join(u.Path, "/_all/_settings")
+func (cs *IndicesSettings) fetchAndDecodeIndicesSettings(ctx context.Context) (IndicesSettingsResponse, error) {
 	var asr IndicesSettingsResponse
-	err := cs.getAndParseURL(&u, &asr)
-	if err != nil {
+	p := "/_all/_settings"
+	var params url.Values
+	if expr := cs.filter.expression(); expr != "" {
+		p = "/" + expr + "/_settings"
+		params = expressionParams(nil)
+	}
+	if err := cs.client.Get(ctx, p, params, &asr); err != nil {
 		return asr, err
 	}
-
-	return asr, err
+	for indexName := range asr {
+		if !cs.filter.match(indexName) {
+			delete(asr, indexName)
+		}
+	}
+	return asr, nil
 }
 
-// Collect gets all indices settings metric values
-func (cs *IndicesSettings) Collect(ch chan<- prometheus.Metric) {
-
-	cs.totalScrapes.Inc()
-	defer func() {
-		ch <- cs.up
-		ch <- cs.totalScrapes
-		ch <- cs.jsonParseFailures
-		ch <- cs.readOnlyIndices
-	}()
-
-	asr, err := cs.fetchAndDecodeIndicesSettings()
+// Update gets all indices settings metric values
+func (cs *IndicesSettings) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	asr, err := cs.fetchAndDecodeIndicesSettings(ctx)
 	if err != nil {
-		cs.readOnlyIndices.Set(0)
-		cs.up.Set(0)
-		_ = level.Warn(cs.logger).Log(
-			"msg", "failed to fetch and decode cluster settings stats",
-			"err", err,
-		)
-		return
+		return fmt.Errorf("failed to fetch and decode cluster settings stats: %w", err)
 	}
-	cs.up.Set(1)
 
 	var c int
 	for indexName, value := range asr {
@@ -197,9 +143,16 @@ func (cs *IndicesSettings) Collect(ch chan<- prometheus.Metric) {
 				metric.Desc,
 				metric.Type,
 				metric.Value(value.Settings),
-				indexName,
+				indexName, cs.clusterName(),
 			)
 		}
 	}
-	cs.readOnlyIndices.Set(float64(c))
+	ch <- prometheus.MustNewConstMetric(
+		cs.readOnlyIndices,
+		prometheus.GaugeValue,
+		float64(c),
+		cs.clusterName(),
+	)
+
+	return nil
 }
@@ -14,6 +14,7 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -71,7 +72,7 @@ func TestIndicesSettings(t *testing.T) {
 				t.Fatalf("Failed to parse URL: %s", err)
 			}
 			c := NewIndicesSettings(log.NewNopLogger(), http.DefaultClient, u)
-			nsr, err := c.fetchAndDecodeIndicesSettings()
+			nsr, err := c.fetchAndDecodeIndicesSettings(context.Background())
 			if err != nil {
 				t.Fatalf("Failed to fetch or decode indices settings: %s", err)
 			}
@@ -14,6 +14,7 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -50,7 +51,7 @@ func TestIndices(t *testing.T) {
 			t.Fatalf("Failed to parse URL: %s", err)
 		}
 		i := NewIndices(log.NewNopLogger(), http.DefaultClient, u, false, false)
-		stats, err := i.fetchAndDecodeIndexStats()
+		stats, err := i.fetchAndDecodeIndexStats(context.Background())
 		if err != nil {
 			t.Fatalf("Failed to fetch or decode indices stats: %s", err)
 		}
@@ -124,7 +125,7 @@ func TestAliases(t *testing.T) {
 			t.Fatalf("Failed to parse URL: %s", err)
 		}
 		i := NewIndices(log.NewNopLogger(), http.DefaultClient, u, false, true)
-		stats, err := i.fetchAndDecodeIndexStats()
+		stats, err := i.fetchAndDecodeIndexStats(context.Background())
 		if err != nil {
 			t.Fatalf("Failed to fetch or decode indices stats: %s", err)
 		}
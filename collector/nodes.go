@@ -14,18 +14,25 @@
 package collector
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"path"
 
+	"github.com/blang/semver/v4"
 	"github.com/go-kit/log"
-	"github.com/go-kit/log/level"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/esclient"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+func init() {
+	registerCollector("nodes", defaultEnabled, func(logger log.Logger, u *url.URL, hc *http.Client, m *config.Module) (Collector, error) {
+		return NewNodes(logger, hc, u, m.Options.AllNodes, m.Options.Node), nil
+	})
+}
+
 func getRoles(node NodeStatsNodeResponse) map[string]bool {
 	// default settings (2.x) and map, which roles to consider
 	roles := map[string]bool{
@@ -126,6 +133,9 @@ type nodeMetric struct {
 	Desc   *prometheus.Desc
 	Value  func(node NodeStatsNodeResponse) float64
 	Labels func(cluster string, node NodeStatsNodeResponse) []string
+	// Versions are the Elasticsearch versions which have the field of the
+	// metric, all versions if empty
+	Versions versionRange
 }
 
 type gcCollectionMetric struct {
@@ -166,44 +176,35 @@ type filesystemIODeviceMetric struct {
 // Nodes information struct
 type Nodes struct {
 	logger log.Logger
-	client *http.Client
-	url    *url.URL
+	client *esclient.Client
 	all    bool
 	node   string
 
-	up                              prometheus.Gauge
-	totalScrapes, jsonParseFailures prometheus.Counter
-
 	nodeMetrics               []*nodeMetric
 	gcCollectionMetrics       []*gcCollectionMetric
 	breakerMetrics            []*breakerMetric
 	threadPoolMetrics         []*threadPoolMetric
 	filesystemDataMetrics     []*filesystemDataMetric
 	filesystemIODeviceMetrics []*filesystemIODeviceMetric
+
+	version clusterVersion
 }
 
+var (
+	// the filter cache became the query cache in 2.0
+	filterCacheVersions = mustParseVersionRange("<2.0.0")
+	// the load average moved to os.cpu in 5.0
+	cpuLoadVersions = mustParseVersionRange(">=5.0.0")
+)
+
 // NewNodes defines Nodes Prometheus metrics
 func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, node string) *Nodes {
 	return &Nodes{
 		logger: logger,
-		client: client,
-		url:    url,
+		client: esclient.New(logger, client, url),
 		all:    all,
 		node:   node,
 
-		up: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: prometheus.BuildFQName(namespace, "node_stats", "up"),
-			Help: "Was the last scrape of the Elasticsearch nodes endpoint successful.",
-		}),
-		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: prometheus.BuildFQName(namespace, "node_stats", "total_scrapes"),
-			Help: "Current total Elasticsearch node scrapes.",
-		}),
-		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: prometheus.BuildFQName(namespace, "node_stats", "json_parse_failures"),
-			Help: "Number of errors while parsing JSON.",
-		}),
-
 		nodeMetrics: []*nodeMetric{
 			{
 				Type: prometheus.GaugeValue,
@@ -215,7 +216,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return node.OS.CPU.LoadAvg.Load1
 				},
-				Labels: defaultNodeLabelValues,
+				Labels:   defaultNodeLabelValues,
+				Versions: cpuLoadVersions,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -227,7 +229,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return node.OS.CPU.LoadAvg.Load5
 				},
-				Labels: defaultNodeLabelValues,
+				Labels:   defaultNodeLabelValues,
+				Versions: cpuLoadVersions,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -239,7 +242,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return node.OS.CPU.LoadAvg.Load15
 				},
-				Labels: defaultNodeLabelValues,
+				Labels:   defaultNodeLabelValues,
+				Versions: cpuLoadVersions,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -347,7 +351,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.FilterCache.MemorySize)
 				},
-				Labels: defaultNodeLabelValues,
+				Labels:   defaultNodeLabelValues,
+				Versions: filterCacheVersions,
 			},
 			{
 				Type: prometheus.CounterValue,
@@ -359,7 +364,8 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 				Value: func(node NodeStatsNodeResponse) float64 {
 					return float64(node.Indices.FilterCache.Evictions)
 				},
-				Labels: defaultNodeLabelValues,
+				Labels:   defaultNodeLabelValues,
+				Versions: filterCacheVersions,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -1776,91 +1782,30 @@ func NewNodes(logger log.Logger, client *http.Client, url *url.URL, all bool, no
 	}
 }
 
-// Describe add metrics descriptions
-func (c *Nodes) Describe(ch chan<- *prometheus.Desc) {
-	for _, metric := range c.nodeMetrics {
-		ch <- metric.Desc
-	}
-	for _, metric := range c.gcCollectionMetrics {
-		ch <- metric.Desc
-	}
-	for _, metric := range c.threadPoolMetrics {
-		ch <- metric.Desc
-	}
-	for _, metric := range c.filesystemDataMetrics {
-		ch <- metric.Desc
-	}
-	for _, metric := range c.filesystemIODeviceMetrics {
-		ch <- metric.Desc
-	}
-	ch <- c.up.Desc()
-	ch <- c.totalScrapes.Desc()
-	ch <- c.jsonParseFailures.Desc()
-}
-
-func (c *Nodes) fetchAndDecodeNodeStats() (nodeStatsResponse, error) {
+func (c *Nodes) fetchAndDecodeNodeStats(ctx context.Context) (nodeStatsResponse, error) {
 	var nsr nodeStatsResponse
 
-	u := *c.url
-
+	p := path.Join("_nodes", c.node, "stats")
 	if c.all {
-		u.Path = path.Join(u.Path, "/_nodes/stats")
-	} else {
-		u.Path = path.Join(u.Path, "_nodes", c.node, "stats")
-	}
-
-	res, err := c.client.Get(u.String())
-	if err != nil {
-		return nsr, fmt.Errorf("failed to get cluster health from %s://%s:%s%s: %s",
-			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+		p = "/_nodes/stats"
 	}
-
-	defer func() {
-		err = res.Body.Close()
-		if err != nil {
-			_ = level.Warn(c.logger).Log(
-				"msg", "failed to close http.Client",
-				"err", err,
-			)
-		}
-	}()
-
-	if res.StatusCode != http.StatusOK {
-		return nsr, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
-	}
-
-	bts, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		c.jsonParseFailures.Inc()
-		return nsr, err
-	}
-
-	if err := json.Unmarshal(bts, &nsr); err != nil {
-		c.jsonParseFailures.Inc()
-		return nsr, err
-	}
-	return nsr, nil
+	err := c.client.Get(ctx, p, nil, &nsr)
+	return nsr, err
 }
 
-// Collect gets nodes metric values
-func (c *Nodes) Collect(ch chan<- prometheus.Metric) {
-	c.totalScrapes.Inc()
-	defer func() {
-		ch <- c.up
-		ch <- c.totalScrapes
-		ch <- c.jsonParseFailures
-	}()
+// SetVersion selects the metrics of the fields of the Elasticsearch version. It
+// implements the versionedCollector interface.
+func (c *Nodes) SetVersion(distribution string, number semver.Version) {
+	c.version.set(distribution, number)
+}
 
-	nodeStatsResp, err := c.fetchAndDecodeNodeStats()
+// Update gets nodes metric values
+func (c *Nodes) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	nodeStatsResp, err := c.fetchAndDecodeNodeStats(ctx)
 	if err != nil {
-		c.up.Set(0)
-		_ = level.Warn(c.logger).Log(
-			"msg", "failed to fetch and decode node stats",
-			"err", err,
-		)
-		return
+		return fmt.Errorf("failed to fetch and decode node stats: %w", err)
 	}
-	c.up.Set(1)
+	version := c.version.compatible()
 
 	for _, node := range nodeStatsResp.Nodes {
 		// Handle the node labels metric
@@ -1879,6 +1824,9 @@ func (c *Nodes) Collect(ch chan<- prometheus.Metric) {
 		}
 
 		for _, metric := range c.nodeMetrics {
+			if !metric.Versions.contains(version) {
+				continue
+			}
 			ch <- prometheus.MustNewConstMetric(
 				metric.Desc,
 				metric.Type,
@@ -1948,4 +1896,6 @@ func (c *Nodes) Collect(ch chan<- prometheus.Metric) {
 		}
 
 	}
+
+	return nil
 }
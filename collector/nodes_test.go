@@ -14,6 +14,7 @@
 package collector
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"io/ioutil"
@@ -23,7 +24,10 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/blang/semver/v4"
 	"github.com/go-kit/log"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/clusterinfo"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func TestNodesStats(t *testing.T) {
@@ -60,7 +64,7 @@ func TestNodesStats(t *testing.T) {
 				}
 				u.User = url.UserPassword("elastic", "changeme")
 				c := NewNodes(log.NewNopLogger(), http.DefaultClient, u, true, "_local")
-				nsr, err := c.fetchAndDecodeNodeStats()
+				nsr, err := c.fetchAndDecodeNodeStats(context.Background())
 				if err != nil {
 					t.Fatalf("Failed to fetch or decode node stats: %s", err)
 				}
@@ -170,3 +174,58 @@ func (h *basicAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	h.Next.ServeHTTP(w, r)
 }
+
+func TestNodesVersionedMetrics(t *testing.T) {
+	data, err := ioutil.ReadFile("../fixtures/nodestats/7.13.1.json")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %s", err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	c := NewNodes(log.NewNopLogger(), http.DefaultClient, u, true, "_local")
+
+	names := func() map[string]bool {
+		ch := make(chan prometheus.Metric)
+		go func() {
+			if err := c.Update(context.Background(), ch); err != nil {
+				t.Errorf("Failed to update: %s", err)
+			}
+			close(ch)
+		}()
+		names := make(map[string]bool)
+		for m := range ch {
+			names[m.Desc().String()] = true
+		}
+		return names
+	}
+	hasMetric := func(names map[string]bool, name string) bool {
+		for desc := range names {
+			if strings.Contains(desc, `"`+name+`"`) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// without a version all metrics are sent
+	all := names()
+	if !hasMetric(all, "elasticsearch_indices_filter_cache_memory_size_bytes") {
+		t.Error("expected filter cache metric without a version")
+	}
+
+	c.SetVersion(clusterinfo.DistributionElasticsearch, semver.MustParse("7.13.1"))
+	versioned := names()
+	if hasMetric(versioned, "elasticsearch_indices_filter_cache_memory_size_bytes") {
+		t.Error("unexpected filter cache metric for 7.13.1")
+	}
+	if !hasMetric(versioned, "elasticsearch_os_load1") || !hasMetric(versioned, "elasticsearch_indices_query_cache_memory_size_bytes") {
+		t.Error("expected load and query cache metrics for 7.13.1")
+	}
+}
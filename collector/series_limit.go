@@ -0,0 +1,168 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// otherIndex is the index label of the sum of the indices over the series limit.
+const otherIndex = "_other"
+
+var seriesDroppedDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "exporter", "series_dropped_total"),
+	"Number of series which were not exported because the series limit of the collector was exceeded.",
+	[]string{"collector"}, nil,
+)
+
+// seriesRanks are the values the indices are ranked by to select the indices
+// exported within the series limit.
+var seriesRanks = map[string]func(IndexStatsIndexResponse) float64{
+	config.SeriesLimitByStoreSize: func(s IndexStatsIndexResponse) float64 {
+		return float64(s.Total.Store.SizeInBytes)
+	},
+	config.SeriesLimitByDocs: func(s IndexStatsIndexResponse) float64 {
+		return float64(s.Total.Docs.Count)
+	},
+	config.SeriesLimitByIndexing: func(s IndexStatsIndexResponse) float64 {
+		return float64(s.Total.Indexing.IndexTotal)
+	},
+	config.SeriesLimitBySearch: func(s IndexStatsIndexResponse) float64 {
+		return float64(s.Total.Search.QueryTotal)
+	},
+}
+
+// seriesLimiter limits the number of series of a collector. The indices with
+// the highest rank are exported as long as their series fit in the limit, the
+// others are folded into the otherIndex.
+type seriesLimiter struct {
+	collector string
+	limit     int
+	rank      func(IndexStatsIndexResponse) float64
+	// other sums the folded indices like an index group, so that the counters
+	// of the otherIndex stay monotonic when indices leave it.
+	other *indexGrouper
+
+	mu      sync.Mutex
+	dropped float64
+}
+
+// newSeriesLimiter returns the limiter of the collector by the module options,
+// nil if the options have no limit.
+func newSeriesLimiter(collector string, options config.ModuleOptions) (*seriesLimiter, error) {
+	if options.IndicesSeriesLimit <= 0 {
+		return nil, nil
+	}
+	by := options.IndicesSeriesLimitBy
+	if by == "" {
+		by = config.SeriesLimitByStoreSize
+	}
+	rank, ok := seriesRanks[by]
+	if !ok {
+		return nil, fmt.Errorf("unknown series limit rank %q", by)
+	}
+	other := &indexGrouper{
+		rules:   []indexGroupRule{{re: regexp.MustCompile(".*"), group: otherIndex}},
+		indices: make(map[string]*groupedIndex),
+		deleted: make(map[string][]float64),
+	}
+	return &seriesLimiter{collector: collector, limit: options.IndicesSeriesLimit, rank: rank, other: other}, nil
+}
+
+// fold returns the indices to fold into the otherIndex, nil if the series of
+// all indices fit in the limit. series returns the number of series of an
+// index and reserved is the number of series of the otherIndex.
+func (l *seriesLimiter) fold(indices map[string]IndexStatsIndexResponse, names []string, series func(string) int, reserved int) map[string]bool {
+	if l == nil {
+		return nil
+	}
+	total := 0
+	for _, name := range names {
+		total += series(name)
+	}
+	if total <= l.limit {
+		return nil
+	}
+
+	sort.Slice(names, func(a, b int) bool {
+		ra, rb := l.rank(indices[names[a]]), l.rank(indices[names[b]])
+		if ra != rb {
+			return ra > rb
+		}
+		return names[a] < names[b]
+	})
+	folded := make(map[string]bool)
+	budget := l.limit - reserved
+	dropped := 0
+	for _, name := range names {
+		n := series(name)
+		// keep the top indices only, smaller ones do not fill up the budget
+		if len(folded) > 0 || n > budget {
+			folded[name] = true
+			dropped += n
+			continue
+		}
+		budget -= n
+	}
+
+	l.mu.Lock()
+	l.dropped += float64(dropped)
+	l.mu.Unlock()
+	return folded
+}
+
+// sumOther returns the values of the metrics summed over the folded indices,
+// nil if no index has been folded yet. The counters of the indices which are
+// no longer folded, e.g. as they have been deleted, are kept in the sum.
+func (l *seriesLimiter) sumOther(indices map[string]IndexStatsIndexResponse, folded map[string]bool, metrics []*indexMetric) []float64 {
+	if l == nil {
+		return nil
+	}
+	foldedIndices := make(map[string]IndexStatsIndexResponse, len(folded))
+	for name := range folded {
+		if stats, ok := indices[name]; ok {
+			foldedIndices[name] = stats
+		}
+	}
+	return l.other.sum(foldedIndices, metrics)[otherIndex]
+}
+
+// reset resets the number of dropped series and the counters of the folded
+// indices.
+func (l *seriesLimiter) reset() {
+	if l == nil {
+		return
+	}
+	l.other.reset()
+	l.mu.Lock()
+	l.dropped = 0
+	l.mu.Unlock()
+}
+
+// collect sends the number of dropped series.
+func (l *seriesLimiter) collect(ch chan<- prometheus.Metric) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	dropped := l.dropped
+	l.mu.Unlock()
+	ch <- prometheus.MustNewConstMetric(seriesDroppedDesc, prometheus.CounterValue, dropped, l.collector)
+}
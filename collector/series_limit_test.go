@@ -0,0 +1,144 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestIndicesSeriesLimit(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_all/_stats":
+			fmt.Fprint(w, `{"indices":{
+				"big":{"total":{"store":{"size_in_bytes":300}}},
+				"medium":{"total":{"store":{"size_in_bytes":200}}},
+				"small":{"total":{"store":{"size_in_bytes":100}}}
+			}}`)
+		case "/_alias":
+			fmt.Fprint(w, `{"big":{"aliases":{"b":{}}},"small":{"aliases":{"s":{}}}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	i := NewIndices(log.NewNopLogger(), http.DefaultClient, u, false, true)
+	perIndex := len(i.indexMetrics) + len(i.aliasMetrics)
+
+	for _, tc := range []struct {
+		limit    int
+		expected string
+	}{
+		{
+			// the series of the other index are reserved in the limit
+			limit: 2*perIndex + len(i.indexMetrics) - 1,
+			expected: `
+elasticsearch_indices_store_size_bytes_total{cluster="unknown_cluster",index="_other"} 100
+elasticsearch_indices_store_size_bytes_total{cluster="unknown_cluster",index="big"} 300
+elasticsearch_indices_store_size_bytes_total{cluster="unknown_cluster",index="medium"} 200
+elasticsearch_exporter_series_dropped_total{collector="indices"} ` + fmt.Sprint(perIndex),
+		},
+		{
+			limit: 2 * perIndex,
+			expected: `
+elasticsearch_indices_store_size_bytes_total{cluster="unknown_cluster",index="_other"} 300
+elasticsearch_indices_store_size_bytes_total{cluster="unknown_cluster",index="big"} 300
+elasticsearch_exporter_series_dropped_total{collector="indices"} ` + fmt.Sprint(2*perIndex-len(i.aliasMetrics)),
+		},
+		{
+			limit: 3 * perIndex,
+			expected: `
+elasticsearch_indices_store_size_bytes_total{cluster="unknown_cluster",index="big"} 300
+elasticsearch_indices_store_size_bytes_total{cluster="unknown_cluster",index="medium"} 200
+elasticsearch_indices_store_size_bytes_total{cluster="unknown_cluster",index="small"} 100
+elasticsearch_exporter_series_dropped_total{collector="indices"} 0`,
+		},
+	} {
+		t.Run(fmt.Sprint(tc.limit), func(t *testing.T) {
+			i.limiter, err = newSeriesLimiter("indices", config.ModuleOptions{IndicesSeriesLimit: tc.limit})
+			if err != nil {
+				t.Fatalf("Failed to create limiter: %s", err)
+			}
+			expected := `
+# HELP elasticsearch_exporter_series_dropped_total Number of series which were not exported because the series limit of the collector was exceeded.
+# TYPE elasticsearch_exporter_series_dropped_total counter
+# HELP elasticsearch_indices_store_size_bytes_total Current total size of stored index data in bytes with all shards on all nodes
+# TYPE elasticsearch_indices_store_size_bytes_total gauge
+` + tc.expected + "\n"
+			err := testutil.CollectAndCompare(wrapCollector{i}, strings.NewReader(expected),
+				"elasticsearch_indices_store_size_bytes_total", "elasticsearch_exporter_series_dropped_total")
+			if err != nil {
+				t.Error(err)
+			}
+			if n := testutil.CollectAndCount(wrapCollector{i}); n > tc.limit+1 {
+				t.Errorf("expected at most %d series, got %d", tc.limit+1, n)
+			}
+		})
+	}
+}
+
+func TestSeriesLimiterSumOther(t *testing.T) {
+	l, err := newSeriesLimiter("indices", config.ModuleOptions{IndicesSeriesLimit: 1})
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %s", err)
+	}
+	metrics := []*indexMetric{
+		{
+			Type:  prometheus.GaugeValue,
+			Value: func(s IndexStatsIndexResponse) float64 { return float64(s.Primaries.Docs.Count) },
+		},
+		{
+			Type:  prometheus.CounterValue,
+			Value: func(s IndexStatsIndexResponse) float64 { return float64(s.Primaries.Indexing.IndexTotal) },
+		},
+	}
+	index := func(docs, indexed int64) IndexStatsIndexResponse {
+		var s IndexStatsIndexResponse
+		s.Primaries.Docs.Count = docs
+		s.Primaries.Indexing.IndexTotal = indexed
+		return s
+	}
+
+	for _, tc := range []struct {
+		name     string
+		indices  map[string]IndexStatsIndexResponse
+		folded   map[string]bool
+		expected []float64
+	}{
+		{"not folded", map[string]IndexStatsIndexResponse{"a": index(10, 100)}, nil, nil},
+		{"folded", map[string]IndexStatsIndexResponse{"a": index(10, 100), "b": index(5, 50), "c": index(1, 10)}, map[string]bool{"b": true, "c": true}, []float64{6, 60}},
+		// the counters of the indices leaving the other index are kept
+		{"unfolded", map[string]IndexStatsIndexResponse{"a": index(10, 100), "b": index(6, 60), "c": index(2, 20)}, map[string]bool{"c": true}, []float64{2, 70}},
+		{"deleted", map[string]IndexStatsIndexResponse{"a": index(10, 100), "b": index(6, 60)}, map[string]bool{}, []float64{0, 70}},
+	} {
+		if sum := l.sumOther(tc.indices, tc.folded, metrics); fmt.Sprint(sum) != fmt.Sprint(tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, sum)
+		}
+	}
+}
@@ -13,19 +13,19 @@
 package collector
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
-	"path"
 
 	"github.com/go-kit/log"
-	"github.com/go-kit/log/level"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/esclient"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 var (
-	defaultNodeShardLabels = []string{"node"}
+	defaultNodeShardLabels = []string{"node", "cluster"}
 
 	defaultNodeShardLabelValues = func(node string) []string {
 		return []string{
@@ -34,6 +34,18 @@ var (
 	}
 )
 
+func init() {
+	registerCollector("shards", defaultDisabled, func(logger log.Logger, u *url.URL, hc *http.Client, m *config.Module) (Collector, error) {
+		filter, err := newIndexFilter(m.Options)
+		if err != nil {
+			return nil, err
+		}
+		s := NewShards(logger, hc, u)
+		s.filter = filter
+		return s, nil
+	})
+}
+
 // ShardResponse has shard's node and index info
 type ShardResponse struct {
 	Index string `json:"index"`
@@ -44,11 +56,11 @@ type ShardResponse struct {
 // Shards information struct
 type Shards struct {
 	logger log.Logger
-	client *http.Client
-	url    *url.URL
+	client *esclient.Client
+	clusterLabel
+	filter *indexFilter
 
-	nodeShardMetrics  []*nodeShardMetric
-	jsonParseFailures prometheus.Counter
+	nodeShardMetrics []*nodeShardMetric
 }
 
 type nodeShardMetric struct {
@@ -62,8 +74,7 @@ type nodeShardMetric struct {
 func NewShards(logger log.Logger, client *http.Client, url *url.URL) *Shards {
 	return &Shards{
 		logger: logger,
-		client: client,
-		url:    url,
+		client: esclient.New(logger, client, url),
 
 		nodeShardMetrics: []*nodeShardMetric{
 			{
@@ -78,79 +89,37 @@ func NewShards(logger log.Logger, client *http.Client, url *url.URL) *Shards {
 				},
 				Labels: defaultNodeShardLabelValues,
 			}},
-
-		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: prometheus.BuildFQName(namespace, "node_shards", "json_parse_failures"),
-			Help: "Number of errors while parsing JSON.",
-		}),
-	}
-}
-
-// Describe Shards
-func (s *Shards) Describe(ch chan<- *prometheus.Desc) {
-	ch <- s.jsonParseFailures.Desc()
-
-	for _, metric := range s.nodeShardMetrics {
-		ch <- metric.Desc
 	}
 }
 
-func (s *Shards) getAndParseURL(u *url.URL) ([]ShardResponse, error) {
-	res, err := s.client.Get(u.String())
-	if err != nil {
-		return nil, fmt.Errorf("failed to get from %s://%s:%s%s: %s",
-			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
-	}
-
-	defer func() {
-		err = res.Body.Close()
-		if err != nil {
-			_ = level.Warn(s.logger).Log(
-				"msg", "failed to close http.Client",
-				"err", err,
-			)
-		}
-	}()
-
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
-	}
+func (s *Shards) fetchAndDecodeShards(ctx context.Context) ([]ShardResponse, error) {
 	var sfr []ShardResponse
-	if err := json.NewDecoder(res.Body).Decode(&sfr); err != nil {
-		s.jsonParseFailures.Inc()
+	p := "/_cat/shards"
+	params := url.Values{"format": {"json"}}
+	if expr := s.filter.expression(); expr != "" {
+		p += "/" + expr
+		params = expressionParams(params)
+	}
+	if err := s.client.Get(ctx, p, params, &sfr); err != nil {
 		return nil, err
 	}
-	return sfr, nil
-}
-
-func (s *Shards) fetchAndDecodeShards() ([]ShardResponse, error) {
-
-	u := *s.url
-	u.Path = path.Join(u.Path, "/_cat/shards")
-	q := u.Query()
-	q.Set("format", "json")
-	u.RawQuery = q.Encode()
-	sfr, err := s.getAndParseURL(&u)
-	if err != nil {
-		return sfr, err
+	if s.filter == nil {
+		return sfr, nil
+	}
+	filtered := sfr[:0]
+	for _, shard := range sfr {
+		if s.filter.match(shard.Index) {
+			filtered = append(filtered, shard)
+		}
 	}
-	return sfr, err
+	return filtered, nil
 }
 
-// Collect number of shards on each nodes
-func (s *Shards) Collect(ch chan<- prometheus.Metric) {
-
-	defer func() {
-		ch <- s.jsonParseFailures
-	}()
-
-	sr, err := s.fetchAndDecodeShards()
+// Update number of shards on each nodes
+func (s *Shards) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	sr, err := s.fetchAndDecodeShards(ctx)
 	if err != nil {
-		_ = level.Warn(s.logger).Log(
-			"msg", "failed to fetch and decode node shards stats",
-			"err", err,
-		)
-		return
+		return fmt.Errorf("failed to fetch and decode node shards stats: %w", err)
 	}
 
 	nodeShards := make(map[string]float64)
@@ -169,8 +138,10 @@ func (s *Shards) Collect(ch chan<- prometheus.Metric) {
 				metric.Desc,
 				metric.Type,
 				metric.Value(shards),
-				metric.Labels(node)...,
+				append(metric.Labels(node), s.clusterName())...,
 			)
 		}
 	}
+
+	return nil
 }
@@ -14,18 +14,27 @@
 package collector
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
-	"path"
 
+	"github.com/blang/semver/v4"
 	"github.com/go-kit/log"
-	"github.com/go-kit/log/level"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/clusterinfo"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/esclient"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+func init() {
+	registerCollector("slm", defaultDisabled, func(logger log.Logger, u *url.URL, hc *http.Client, m *config.Module) (Collector, error) {
+		return NewSLM(logger, hc, u), nil
+	})
+	registerVersionRange("slm", clusterinfo.DistributionElasticsearch, ">=7.4.0")
+	registerVersionRange("slm", clusterinfo.DistributionOpenSearch, ">=2.1.0")
+}
+
 type policyMetric struct {
 	Type   prometheus.ValueType
 	Desc   *prometheus.Desc
@@ -47,54 +56,55 @@ type slmStatusMetric struct {
 }
 
 var (
-	defaultPolicyLabels      = []string{"policy"}
+	defaultPolicyLabels      = []string{"policy", "cluster"}
 	defaultPolicyLabelValues = func(policyStats PolicyStats) []string {
 		return []string{policyStats.Policy}
 	}
 
 	statuses = []string{"RUNNING", "STOPPING", "STOPPED"}
+
+	// executionStatuses are the states of a snapshot management workflow
+	// execution of OpenSearch
+	executionStatuses = []string{"IN_PROGRESS", "SUCCESS", "RETRYING", "FAILED", "TIMED_OUT"}
+
+	smPolicyEnabledDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "slm", "policy_enabled"),
+		"Whether the OpenSearch snapshot management policy is enabled",
+		defaultPolicyLabels, nil,
+	)
+	smPolicyLastExecutionDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "slm", "policy_last_execution_status"),
+		"Status of the last execution of the creation or deletion workflow of the OpenSearch snapshot management policy",
+		[]string{"policy", "workflow", "status", "cluster"}, nil,
+	)
 )
 
 // SLM information struct
 type SLM struct {
 	logger log.Logger
-	client *http.Client
-	url    *url.URL
-
-	up                              prometheus.Gauge
-	totalScrapes, jsonParseFailures prometheus.Counter
+	client *esclient.Client
+	clusterLabel
 
 	slmMetrics      []*slmMetric
 	policyMetrics   []*policyMetric
 	slmStatusMetric *slmStatusMetric
+
+	version clusterVersion
 }
 
 // NewSLM defines SLM Prometheus metrics
 func NewSLM(logger log.Logger, client *http.Client, url *url.URL) *SLM {
 	return &SLM{
 		logger: logger,
-		client: client,
-		url:    url,
+		client: esclient.New(logger, client, url),
 
-		up: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: prometheus.BuildFQName(namespace, "slm_stats", "up"),
-			Help: "Was the last scrape of the Elasticsearch SLM endpoint successful.",
-		}),
-		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: prometheus.BuildFQName(namespace, "slm_stats", "total_scrapes"),
-			Help: "Current total Elasticsearch SLM scrapes.",
-		}),
-		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: prometheus.BuildFQName(namespace, "slm_stats", "json_parse_failures"),
-			Help: "Number of errors while parsing JSON.",
-		}),
 		slmMetrics: []*slmMetric{
 			{
 				Type: prometheus.CounterValue,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "slm_stats", "retention_runs_total"),
 					"Total retention runs",
-					nil, nil,
+					defaultClusterLabels, nil,
 				),
 				Value: func(slmStats SLMStatsResponse) float64 {
 					return float64(slmStats.RetentionRuns)
@@ -105,7 +115,7 @@ func NewSLM(logger log.Logger, client *http.Client, url *url.URL) *SLM {
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "slm_stats", "retention_failed_total"),
 					"Total failed retention runs",
-					nil, nil,
+					defaultClusterLabels, nil,
 				),
 				Value: func(slmStats SLMStatsResponse) float64 {
 					return float64(slmStats.RetentionFailed)
@@ -116,7 +126,7 @@ func NewSLM(logger log.Logger, client *http.Client, url *url.URL) *SLM {
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "slm_stats", "retention_timed_out_total"),
 					"Total timed out retention runs",
-					nil, nil,
+					defaultClusterLabels, nil,
 				),
 				Value: func(slmStats SLMStatsResponse) float64 {
 					return float64(slmStats.RetentionTimedOut)
@@ -127,7 +137,7 @@ func NewSLM(logger log.Logger, client *http.Client, url *url.URL) *SLM {
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "slm_stats", "retention_deletion_time_seconds"),
 					"Retention run deletion time",
-					nil, nil,
+					defaultClusterLabels, nil,
 				),
 				Value: func(slmStats SLMStatsResponse) float64 {
 					return float64(slmStats.RetentionDeletionTimeMillis) / 1000
@@ -138,7 +148,7 @@ func NewSLM(logger log.Logger, client *http.Client, url *url.URL) *SLM {
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "slm_stats", "total_snapshots_taken_total"),
 					"Total snapshots taken",
-					nil, nil,
+					defaultClusterLabels, nil,
 				),
 				Value: func(slmStats SLMStatsResponse) float64 {
 					return float64(slmStats.TotalSnapshotsTaken)
@@ -149,7 +159,7 @@ func NewSLM(logger log.Logger, client *http.Client, url *url.URL) *SLM {
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "slm_stats", "total_snapshots_failed_total"),
 					"Total snapshots failed",
-					nil, nil,
+					defaultClusterLabels, nil,
 				),
 				Value: func(slmStats SLMStatsResponse) float64 {
 					return float64(slmStats.TotalSnapshotsFailed)
@@ -160,7 +170,7 @@ func NewSLM(logger log.Logger, client *http.Client, url *url.URL) *SLM {
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "slm_stats", "total_snapshots_deleted_total"),
 					"Total snapshots deleted",
-					nil, nil,
+					defaultClusterLabels, nil,
 				),
 				Value: func(slmStats SLMStatsResponse) float64 {
 					return float64(slmStats.TotalSnapshotsDeleted)
@@ -171,7 +181,7 @@ func NewSLM(logger log.Logger, client *http.Client, url *url.URL) *SLM {
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "slm_stats", "total_snapshot_deletion_failures_total"),
 					"Total snapshot deletion failures",
-					nil, nil,
+					defaultClusterLabels, nil,
 				),
 				Value: func(slmStats SLMStatsResponse) float64 {
 					return float64(slmStats.TotalSnapshotDeletionFailures)
@@ -233,7 +243,7 @@ func NewSLM(logger log.Logger, client *http.Client, url *url.URL) *SLM {
 			Desc: prometheus.NewDesc(
 				prometheus.BuildFQName(namespace, "slm_stats", "operation_mode"),
 				"Operating status of SLM",
-				[]string{"operation_mode"}, nil,
+				[]string{"operation_mode", "cluster"}, nil,
 			),
 			Value: func(slmStatus SLMStatusResponse, operationMode string) float64 {
 				if slmStatus.OperationMode == operationMode {
@@ -245,138 +255,52 @@ func NewSLM(logger log.Logger, client *http.Client, url *url.URL) *SLM {
 	}
 }
 
-// Describe adds SLM metrics descriptions
-func (s *SLM) Describe(ch chan<- *prometheus.Desc) {
-	ch <- s.slmStatusMetric.Desc
-
-	for _, metric := range s.slmMetrics {
-		ch <- metric.Desc
-	}
-
-	for _, metric := range s.policyMetrics {
-		ch <- metric.Desc
-	}
-
-	ch <- s.up.Desc()
-	ch <- s.totalScrapes.Desc()
-	ch <- s.jsonParseFailures.Desc()
-}
-
-func (s *SLM) fetchAndDecodeSLMStats() (SLMStatsResponse, error) {
+func (s *SLM) fetchAndDecodeSLMStats(ctx context.Context) (SLMStatsResponse, error) {
 	var ssr SLMStatsResponse
-
-	u := *s.url
-	u.Path = path.Join(u.Path, "/_slm/stats")
-	res, err := s.client.Get(u.String())
-	if err != nil {
-		return ssr, fmt.Errorf("failed to get slm stats health from %s://%s:%s%s: %s",
-			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
-	}
-
-	defer func() {
-		err = res.Body.Close()
-		if err != nil {
-			_ = level.Warn(s.logger).Log(
-				"msg", "failed to close http.Client",
-				"err", err,
-			)
-		}
-	}()
-
-	if res.StatusCode != http.StatusOK {
-		return ssr, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
-	}
-
-	bts, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		s.jsonParseFailures.Inc()
-		return ssr, err
-	}
-
-	if err := json.Unmarshal(bts, &ssr); err != nil {
-		s.jsonParseFailures.Inc()
-		return ssr, err
-	}
-
-	return ssr, nil
+	err := s.client.Get(ctx, "/_slm/stats", nil, &ssr)
+	return ssr, err
 }
 
-func (s *SLM) fetchAndDecodeSLMStatus() (SLMStatusResponse, error) {
+func (s *SLM) fetchAndDecodeSLMStatus(ctx context.Context) (SLMStatusResponse, error) {
 	var ssr SLMStatusResponse
+	err := s.client.Get(ctx, "/_slm/status", nil, &ssr)
+	return ssr, err
+}
 
-	u := *s.url
-	u.Path = path.Join(u.Path, "/_slm/status")
-	res, err := s.client.Get(u.String())
-	if err != nil {
-		return ssr, fmt.Errorf("failed to get slm status from %s://%s:%s%s: %s",
-			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
-	}
-
-	defer func() {
-		err = res.Body.Close()
-		if err != nil {
-			_ = level.Warn(s.logger).Log(
-				"msg", "failed to close http.Client",
-				"err", err,
-			)
-		}
-	}()
-
-	if res.StatusCode != http.StatusOK {
-		return ssr, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
-	}
-
-	bts, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		s.jsonParseFailures.Inc()
-		return ssr, err
-	}
-
-	if err := json.Unmarshal(bts, &ssr); err != nil {
-		s.jsonParseFailures.Inc()
-		return ssr, err
-	}
+func (s *SLM) fetchAndDecodeSMExplain(ctx context.Context) (SMExplainResponse, error) {
+	var ser SMExplainResponse
+	err := s.client.Get(ctx, "/_plugins/_sm/policies/*/_explain", nil, &ser)
+	return ser, err
+}
 
-	return ssr, nil
+// SetVersion routes the requests to the snapshot management API of OpenSearch
+// instead of SLM. It implements the versionedCollector interface.
+func (s *SLM) SetVersion(distribution string, number semver.Version) {
+	s.version.set(distribution, number)
 }
 
-// Collect gets SLM metric values
-func (s *SLM) Collect(ch chan<- prometheus.Metric) {
-	s.totalScrapes.Inc()
-	defer func() {
-		ch <- s.up
-		ch <- s.totalScrapes
-		ch <- s.jsonParseFailures
-	}()
+// Update gets SLM metric values
+func (s *SLM) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	if distribution, _ := s.version.get(); distribution == clusterinfo.DistributionOpenSearch {
+		return s.updateSnapshotManagement(ctx, ch)
+	}
 
-	slmStatusResp, err := s.fetchAndDecodeSLMStatus()
+	slmStatusResp, err := s.fetchAndDecodeSLMStatus(ctx)
 	if err != nil {
-		s.up.Set(0)
-		_ = level.Warn(s.logger).Log(
-			"msg", "failed to fetch and decode slm status",
-			"err", err,
-		)
-		return
+		return fmt.Errorf("failed to fetch and decode slm status: %w", err)
 	}
 
-	slmStatsResp, err := s.fetchAndDecodeSLMStats()
+	slmStatsResp, err := s.fetchAndDecodeSLMStats(ctx)
 	if err != nil {
-		s.up.Set(0)
-		_ = level.Warn(s.logger).Log(
-			"msg", "failed to fetch and decode slm stats",
-			"err", err,
-		)
-		return
+		return fmt.Errorf("failed to fetch and decode slm stats: %w", err)
 	}
 
-	s.up.Set(1)
-
 	for _, status := range statuses {
 		ch <- prometheus.MustNewConstMetric(
 			s.slmStatusMetric.Desc,
 			s.slmStatusMetric.Type,
 			s.slmStatusMetric.Value(slmStatusResp, status),
-			status,
+			status, s.clusterName(),
 		)
 	}
 
@@ -385,6 +309,7 @@ func (s *SLM) Collect(ch chan<- prometheus.Metric) {
 			metric.Desc,
 			metric.Type,
 			metric.Value(slmStatsResp),
+			s.clusterName(),
 		)
 	}
 
@@ -394,8 +319,45 @@ func (s *SLM) Collect(ch chan<- prometheus.Metric) {
 				metric.Desc,
 				metric.Type,
 				metric.Value(policy),
-				metric.Labels(policy)...,
+				append(metric.Labels(policy), s.clusterName())...,
 			)
 		}
 	}
+
+	return nil
+}
+
+// updateSnapshotManagement gets the metrics of the snapshot management
+// policies of OpenSearch, which has no equivalent of the SLM stats.
+func (s *SLM) updateSnapshotManagement(ctx context.Context, ch chan<- prometheus.Metric) error {
+	explainResp, err := s.fetchAndDecodeSMExplain(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch and decode snapshot management policies: %w", err)
+	}
+
+	for _, policy := range explainResp.Policies {
+		var enabled float64
+		if policy.Enabled {
+			enabled = 1
+		}
+		ch <- prometheus.MustNewConstMetric(smPolicyEnabledDesc, prometheus.GaugeValue, enabled, policy.Name, s.clusterName())
+
+		for workflow, explain := range map[string]*SMWorkflowExplain{
+			"creation": policy.Creation,
+			"deletion": policy.Deletion,
+		} {
+			if explain == nil || explain.LatestExecution == nil {
+				continue
+			}
+			for _, status := range executionStatuses {
+				var value float64
+				if explain.LatestExecution.Status == status {
+					value = 1
+				}
+				ch <- prometheus.MustNewConstMetric(smPolicyLastExecutionDesc, prometheus.GaugeValue, value, policy.Name, workflow, status, s.clusterName())
+			}
+		}
+	}
+
+	return nil
 }
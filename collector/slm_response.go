@@ -40,3 +40,26 @@ type PolicyStats struct {
 type SLMStatusResponse struct {
 	OperationMode string `json:"operation_mode"`
 }
+
+// SMExplainResponse is a representation of the OpenSearch snapshot management policies
+type SMExplainResponse struct {
+	Policies []SMPolicyExplain `json:"policies"`
+}
+
+// SMPolicyExplain is a representation of the state of an OpenSearch snapshot management policy
+type SMPolicyExplain struct {
+	Name     string             `json:"name"`
+	Enabled  bool               `json:"enabled"`
+	Creation *SMWorkflowExplain `json:"creation"`
+	Deletion *SMWorkflowExplain `json:"deletion"`
+}
+
+// SMWorkflowExplain is a representation of the state of the creation or deletion workflow of a policy
+type SMWorkflowExplain struct {
+	CurrentState    string `json:"current_state"`
+	LatestExecution *struct {
+		Status    string `json:"status"`
+		StartTime int64  `json:"start_time"`
+		EndTime   int64  `json:"end_time"`
+	} `json:"latest_execution"`
+}
@@ -14,13 +14,18 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 
+	"github.com/blang/semver/v4"
 	"github.com/go-kit/log"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/clusterinfo"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestSLM(t *testing.T) {
@@ -45,7 +50,7 @@ func TestSLM(t *testing.T) {
 			t.Fatalf("Failed to parse URL: %s", err)
 		}
 		s := NewSLM(log.NewNopLogger(), http.DefaultClient, u)
-		stats, err := s.fetchAndDecodeSLMStats()
+		stats, err := s.fetchAndDecodeSLMStats(context.Background())
 		if err != nil {
 			t.Fatalf("Failed to fetch or decode snapshots stats: %s", err)
 		}
@@ -63,3 +68,40 @@ func TestSLM(t *testing.T) {
 	}
 
 }
+
+func TestSLMOpenSearch(t *testing.T) {
+	// Testcase created using:
+	//  curl http://127.0.0.1:9200/_plugins/_sm/policies/*/_explain (OpenSearch 2.3.0)
+	out := `{"policies":[{"name":"daily","creation":{"current_state":"CREATION_FINISHED","trigger":{"time":1664280000000},"latest_execution":{"status":"SUCCESS","start_time":1664276400100,"end_time":1664276460000}},"deletion":{"current_state":"DELETION_START","trigger":{"time":1664280000000}},"policy_seq_no":0,"policy_primary_term":1,"enabled":true}]}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_plugins/_sm/policies/*/_explain" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, out)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	s := NewSLM(log.NewNopLogger(), http.DefaultClient, u)
+	s.SetVersion(clusterinfo.DistributionOpenSearch, semver.MustParse("2.3.0"))
+
+	expected := `
+# HELP elasticsearch_slm_policy_enabled Whether the OpenSearch snapshot management policy is enabled
+# TYPE elasticsearch_slm_policy_enabled gauge
+elasticsearch_slm_policy_enabled{cluster="unknown_cluster",policy="daily"} 1
+# HELP elasticsearch_slm_policy_last_execution_status Status of the last execution of the creation or deletion workflow of the OpenSearch snapshot management policy
+# TYPE elasticsearch_slm_policy_last_execution_status gauge
+elasticsearch_slm_policy_last_execution_status{cluster="unknown_cluster",policy="daily",status="FAILED",workflow="creation"} 0
+elasticsearch_slm_policy_last_execution_status{cluster="unknown_cluster",policy="daily",status="IN_PROGRESS",workflow="creation"} 0
+elasticsearch_slm_policy_last_execution_status{cluster="unknown_cluster",policy="daily",status="RETRYING",workflow="creation"} 0
+elasticsearch_slm_policy_last_execution_status{cluster="unknown_cluster",policy="daily",status="SUCCESS",workflow="creation"} 1
+elasticsearch_slm_policy_last_execution_status{cluster="unknown_cluster",policy="daily",status="TIMED_OUT",workflow="creation"} 0
+`
+	if err := testutil.CollectAndCompare(wrapCollector{s}, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
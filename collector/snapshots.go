@@ -14,18 +14,24 @@
 package collector
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"path"
 
 	"github.com/go-kit/log"
-	"github.com/go-kit/log/level"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/esclient"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+func init() {
+	registerCollector("snapshots", defaultDisabled, func(logger log.Logger, u *url.URL, hc *http.Client, m *config.Module) (Collector, error) {
+		return NewSnapshots(logger, hc, u), nil
+	})
+}
+
 type snapshotMetric struct {
 	Type   prometheus.ValueType
 	Desc   *prometheus.Desc
@@ -41,11 +47,11 @@ type repositoryMetric struct {
 }
 
 var (
-	defaultSnapshotLabels      = []string{"repository", "state", "version"}
+	defaultSnapshotLabels      = []string{"repository", "state", "version", "cluster"}
 	defaultSnapshotLabelValues = func(repositoryName string, snapshotStats SnapshotStatDataResponse) []string {
 		return []string{repositoryName, snapshotStats.State, snapshotStats.Version}
 	}
-	defaultSnapshotRepositoryLabels      = []string{"repository"}
+	defaultSnapshotRepositoryLabels      = []string{"repository", "cluster"}
 	defaultSnapshotRepositoryLabelValues = func(repositoryName string) []string {
 		return []string{repositoryName}
 	}
@@ -54,11 +60,8 @@ var (
 // Snapshots information struct
 type Snapshots struct {
 	logger log.Logger
-	client *http.Client
-	url    *url.URL
-
-	up                              prometheus.Gauge
-	totalScrapes, jsonParseFailures prometheus.Counter
+	client *esclient.Client
+	clusterLabel
 
 	snapshotMetrics   []*snapshotMetric
 	repositoryMetrics []*repositoryMetric
@@ -68,21 +71,8 @@ type Snapshots struct {
 func NewSnapshots(logger log.Logger, client *http.Client, url *url.URL) *Snapshots {
 	return &Snapshots{
 		logger: logger,
-		client: client,
-		url:    url,
+		client: esclient.New(logger, client, url),
 
-		up: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: prometheus.BuildFQName(namespace, "snapshot_stats", "up"),
-			Help: "Was the last scrape of the Elasticsearch snapshots endpoint successful.",
-		}),
-		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: prometheus.BuildFQName(namespace, "snapshot_stats", "total_scrapes"),
-			Help: "Current total Elasticsearch snapshots scrapes.",
-		}),
-		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: prometheus.BuildFQName(namespace, "snapshot_stats", "json_parse_failures"),
-			Help: "Number of errors while parsing JSON.",
-		}),
 		snapshotMetrics: []*snapshotMetric{
 			{
 				Type: prometheus.GaugeValue,
@@ -219,65 +209,17 @@ func NewSnapshots(logger log.Logger, client *http.Client, url *url.URL) *Snapsho
 	}
 }
 
-// Describe add Snapshots metrics descriptions
-func (s *Snapshots) Describe(ch chan<- *prometheus.Desc) {
-	for _, metric := range s.snapshotMetrics {
-		ch <- metric.Desc
-	}
-	ch <- s.up.Desc()
-	ch <- s.totalScrapes.Desc()
-	ch <- s.jsonParseFailures.Desc()
-}
-
-func (s *Snapshots) getAndParseURL(u *url.URL, data interface{}) error {
-	res, err := s.client.Get(u.String())
-	if err != nil {
-		return fmt.Errorf("failed to get from %s://%s:%s%s: %s",
-			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
-	}
-
-	defer func() {
-		err = res.Body.Close()
-		if err != nil {
-			_ = level.Warn(s.logger).Log(
-				"msg", "failed to close http.Client",
-				"err", err,
-			)
-		}
-	}()
-
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
-	}
-
-	bts, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		s.jsonParseFailures.Inc()
-		return err
-	}
-
-	if err := json.Unmarshal(bts, data); err != nil {
-		s.jsonParseFailures.Inc()
-		return err
-	}
-	return nil
-}
-
-func (s *Snapshots) fetchAndDecodeSnapshotsStats() (map[string]SnapshotStatsResponse, error) {
+func (s *Snapshots) fetchAndDecodeSnapshotsStats(ctx context.Context) (map[string]SnapshotStatsResponse, error) {
 	mssr := make(map[string]SnapshotStatsResponse)
 
-	u := *s.url
-	u.Path = path.Join(u.Path, "/_snapshot")
 	var srr SnapshotRepositoriesResponse
-	err := s.getAndParseURL(&u, &srr)
+	err := s.client.Get(ctx, "/_snapshot", nil, &srr)
 	if err != nil {
 		return nil, err
 	}
 	for repository := range srr {
-		u := *s.url
-		u.Path = path.Join(u.Path, "/_snapshot", repository, "/_all")
 		var ssr SnapshotStatsResponse
-		err := s.getAndParseURL(&u, &ssr)
+		err := s.client.Get(ctx, path.Join("/_snapshot", repository, "/_all"), nil, &ssr)
 		if err != nil {
 			continue
 		}
@@ -287,26 +229,13 @@ func (s *Snapshots) fetchAndDecodeSnapshotsStats() (map[string]SnapshotStatsResp
 	return mssr, nil
 }
 
-// Collect gets Snapshots metric values
-func (s *Snapshots) Collect(ch chan<- prometheus.Metric) {
-	s.totalScrapes.Inc()
-	defer func() {
-		ch <- s.up
-		ch <- s.totalScrapes
-		ch <- s.jsonParseFailures
-	}()
-
+// Update gets Snapshots metric values
+func (s *Snapshots) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	// indices
-	snapshotsStatsResp, err := s.fetchAndDecodeSnapshotsStats()
+	snapshotsStatsResp, err := s.fetchAndDecodeSnapshotsStats(ctx)
 	if err != nil {
-		s.up.Set(0)
-		_ = level.Warn(s.logger).Log(
-			"msg", "failed to fetch and decode snapshot stats",
-			"err", err,
-		)
-		return
+		return fmt.Errorf("failed to fetch and decode snapshot stats: %w", err)
 	}
-	s.up.Set(1)
 
 	// Snapshots stats
 	for repositoryName, snapshotStats := range snapshotsStatsResp {
@@ -315,7 +244,7 @@ func (s *Snapshots) Collect(ch chan<- prometheus.Metric) {
 				metric.Desc,
 				metric.Type,
 				metric.Value(snapshotStats),
-				metric.Labels(repositoryName)...,
+				append(metric.Labels(repositoryName), s.clusterName())...,
 			)
 		}
 		if len(snapshotStats.Snapshots) == 0 {
@@ -328,8 +257,10 @@ func (s *Snapshots) Collect(ch chan<- prometheus.Metric) {
 				metric.Desc,
 				metric.Type,
 				metric.Value(lastSnapshot),
-				metric.Labels(repositoryName, lastSnapshot)...,
+				append(metric.Labels(repositoryName, lastSnapshot), s.clusterName())...,
 			)
 		}
 	}
+
+	return nil
 }
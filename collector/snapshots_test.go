@@ -14,6 +14,7 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -58,7 +59,7 @@ func TestSnapshots(t *testing.T) {
 			t.Fatalf("Failed to parse URL: %s", err)
 		}
 		s := NewSnapshots(log.NewNopLogger(), http.DefaultClient, u)
-		stats, err := s.fetchAndDecodeSnapshotsStats()
+		stats, err := s.fetchAndDecodeSnapshotsStats(context.Background())
 		if err != nil {
 			t.Fatalf("Failed to fetch or decode snapshots stats: %s", err)
 		}
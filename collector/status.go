@@ -0,0 +1,71 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sync"
+	"time"
+)
+
+// Status is the outcome of the executions of a collector.
+type Status struct {
+	// LastSuccess is the time of the last successful execution, zero if the
+	// collector never succeeded.
+	LastSuccess time.Time
+	// LastError is the error of the last execution, nil if it succeeded.
+	LastError error
+	// LastErrorTime is the time of the last failed execution.
+	LastErrorTime time.Time
+}
+
+// collectorStatuses records the outcome of the last execution of each
+// collector. It is shared by the copies of an ElasticsearchCollector.
+type collectorStatuses struct {
+	mu       sync.Mutex
+	statuses map[string]Status
+}
+
+func newCollectorStatuses() *collectorStatuses {
+	return &collectorStatuses{statuses: make(map[string]Status)}
+}
+
+func (s *collectorStatuses) record(name string, err error, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.statuses[name]
+	status.LastError = err
+	if err != nil {
+		status.LastErrorTime = at
+	} else {
+		status.LastSuccess = at
+	}
+	s.statuses[name] = status
+}
+
+func (s *collectorStatuses) get() map[string]Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make(map[string]Status, len(s.statuses))
+	for name, status := range s.statuses {
+		statuses[name] = status
+	}
+	return statuses
+}
+
+// Statuses returns the outcome of the last execution of each collector which
+// has been executed by a scrape, including the scrapes of the collectors
+// derived by WithContext and WithCollectorsOf.
+func (e *ElasticsearchCollector) Statuses() map[string]Status {
+	return e.statuses.get()
+}
@@ -0,0 +1,111 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sync"
+
+	"github.com/blang/semver/v4"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/clusterinfo"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var unsupportedDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "scrape", "unsupported_info"),
+	"elasticsearch_exporter: Collector which is disabled because it does not support the Elasticsearch version.",
+	[]string{"collector", "distribution", "version", "supported_versions"},
+	nil,
+)
+
+// openSearchCompatibleVersion is the Elasticsearch version OpenSearch has been
+// forked from. Its fields are used for the metrics of all OpenSearch versions.
+var openSearchCompatibleVersion = semver.MustParse("7.10.2")
+
+// distributionName returns the distribution given in the cluster info,
+// Elasticsearch if none is given.
+func distributionName(distribution string) string {
+	return clusterinfo.VersionInfo{Distribution: distribution}.DistributionName()
+}
+
+// versionRange is a range of versions, e.g. ">=7.4.0".
+type versionRange struct {
+	expr  string
+	check semver.Range
+}
+
+func mustParseVersionRange(expr string) versionRange {
+	return versionRange{expr: expr, check: semver.MustParseRange(expr)}
+}
+
+// contains reports whether v is in the range. An unknown version is in any
+// range, so that metrics are not lost before the version has been fetched.
+func (r versionRange) contains(v *semver.Version) bool {
+	return r.check == nil || v == nil || r.check(*v)
+}
+
+// supportedVersions are the version ranges by distribution of the collectors
+// which do not support all versions, see registerVersionRange.
+var supportedVersions = make(map[string]map[string]versionRange)
+
+// registerVersionRange restricts the named collector to the versions of the
+// distribution in expr. Once a range has been registered for a collector, it
+// is skipped for the versions outside the range and for the distributions
+// without a range.
+func registerVersionRange(name, distribution, expr string) {
+	if supportedVersions[name] == nil {
+		supportedVersions[name] = make(map[string]versionRange)
+	}
+	supportedVersions[name][distribution] = mustParseVersionRange(expr)
+}
+
+// versionedCollector is implemented by collectors whose requests or metrics
+// depend on the distribution and version of the cluster.
+type versionedCollector interface {
+	SetVersion(distribution string, number semver.Version)
+}
+
+// clusterVersion is the distribution and version of the scraped cluster.
+type clusterVersion struct {
+	mu           sync.RWMutex
+	distribution string
+	number       *semver.Version
+}
+
+// get returns the distribution and version, which are unknown until set.
+func (v *clusterVersion) get() (string, *semver.Version) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.distribution, v.number
+}
+
+// set updates the distribution and version and reports whether they changed.
+func (v *clusterVersion) set(distribution string, number semver.Version) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.number != nil && v.distribution == distribution && v.number.Equals(number) {
+		return false
+	}
+	v.distribution = distribution
+	v.number = &number
+	return true
+}
+
+// compatible returns the Elasticsearch version whose fields the cluster has.
+func (v *clusterVersion) compatible() *semver.Version {
+	distribution, number := v.get()
+	if distribution == clusterinfo.DistributionOpenSearch {
+		return &openSearchCompatibleVersion
+	}
+	return number
+}
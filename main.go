@@ -23,9 +23,10 @@ import (
 
 	"context"
 
+	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/prometheus-community/elasticsearch_exporter/collector"
-	"github.com/prometheus-community/elasticsearch_exporter/pkg/clusterinfo"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
 	"github.com/prometheus-community/elasticsearch_exporter/pkg/roundtripper"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -37,14 +38,86 @@ import (
 
 const name = "elasticsearch_exporter"
 
-type transportWithAPIKey struct {
-	underlyingTransport http.RoundTripper
-	apiKey              string
-}
+var (
+	// transportMetrics are shared by the HTTP clients of all targets.
+	transportMetrics = roundtripper.NewTransportMetrics()
+	// credentialMetrics are shared by the HTTP clients of all targets.
+	credentialMetrics = roundtripper.NewCredentialMetrics()
+)
+
+// newHTTPClient creates the client used to talk to the targets of the module.
+// If balance is not nil, it wraps the transport to a single endpoint, e.g. to
+// spread the requests over several nodes.
+func newHTTPClient(m *config.Module, logger log.Logger, balance func(http.RoundTripper) (http.RoundTripper, error)) (*http.Client, error) {
+	httpTransport, err := createTransport(m.TLS, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create TLS config: %w", err)
+	}
 
-func (t *transportWithAPIKey) RoundTrip(req *http.Request) (*http.Response, error) {
-	req.Header.Add("Authorization", fmt.Sprintf("ApiKey %s", t.apiKey))
-	return t.underlyingTransport.RoundTrip(req)
+	// the password is sent in the URL unless it is read from a file
+	if m.Auth.PasswordFile != "" || m.Auth.APIKey != "" || m.Auth.APIKeyFile != "" ||
+		m.Auth.BearerToken != "" || m.Auth.BearerTokenFile != "" {
+		httpTransport, err = roundtripper.NewCredentialsTransport(httpTransport, roundtripper.Credentials{
+			Username:        m.Auth.Username,
+			PasswordFile:    m.Auth.PasswordFile,
+			APIKey:          m.Auth.APIKey,
+			APIKeyFile:      m.Auth.APIKeyFile,
+			BearerToken:     m.Auth.BearerToken,
+			BearerTokenFile: m.Auth.BearerTokenFile,
+		}, credentialMetrics, logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if o := m.Auth.OAuth2; o != nil {
+		// the token endpoint shares the TLS settings of Elasticsearch, except
+		// the server name of Elasticsearch
+		tokenTLS := m.TLS
+		tokenTLS.ServerName = ""
+		tokenTransport, err := createTransport(tokenTLS, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create TLS config of the token endpoint: %w", err)
+		}
+		httpTransport, err = roundtripper.NewOAuth2Transport(httpTransport, roundtripper.OAuth2Config{
+			TokenURL:         o.TokenURL,
+			ClientID:         o.ClientID,
+			ClientSecret:     o.ClientSecret,
+			ClientSecretFile: o.ClientSecretFile,
+			Scopes:           o.Scopes,
+			EndpointParams:   o.EndpointParams,
+			SharedSecret:     o.SharedSecret,
+			SharedSecretFile: o.SharedSecretFile,
+			Timeout:          m.Timeout,
+		}, &http.Client{Transport: tokenTransport, Timeout: m.Timeout}, credentialMetrics, logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if m.AWSRegion != "" {
+		httpTransport, err = roundtripper.NewAWSSigningTransport(httpTransport, roundtripper.AWSConfig{
+			Region:               m.AWSRegion,
+			Service:              m.AWSService,
+			RoleARN:              m.AWSRoleARN,
+			WebIdentityTokenFile: m.AWSWebIdentityTokenFile,
+		}, credentialMetrics, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create AWS transport: %w", err)
+		}
+	}
+	if balance != nil {
+		httpTransport, err = balance(httpTransport)
+		if err != nil {
+			return nil, err
+		}
+	}
+	httpTransport = roundtripper.NewInstrumentedTransport(httpTransport, transportMetrics)
+	httpTransport = roundtripper.NewCoalescingTransport(httpTransport, m.CacheTTL, transportMetrics)
+
+	return &http.Client{
+		Timeout:   m.Timeout,
+		Transport: httpTransport,
+	}, nil
 }
 
 func main() {
@@ -55,13 +128,43 @@ func main() {
 		metricsPath = kingpin.Flag("web.telemetry-path",
 			"Path under which to expose metrics.").
 			Default("/metrics").String()
+		readinessWindow = kingpin.Flag("web.readiness-window",
+			"Report not ready when no request to Elasticsearch of the cluster info retrieval or of a collector succeeded for this long, 0 disables it.").
+			Default("10m").Duration()
 		webConfig = webflag.AddFlags(kingpin.CommandLine)
 		esURI     = kingpin.Flag("es.uri",
-			"HTTP API address of an Elasticsearch node.").
-			Default("http://localhost:9200").String()
+			"HTTP API address of an Elasticsearch node, "+config.DefaultURI+" by default. Repeat for further nodes of the same cluster.").
+			Strings()
+		esCloudID = kingpin.Flag("es.cloud-id",
+			"Elastic Cloud ID of the deployment, which replaces es.uri.").
+			Default("").String()
+		esResolveDNS = kingpin.Flag("es.resolve-dns",
+			"Resolve the hosts of es.uri to all their addresses and use each address as endpoint.").
+			Default("false").Bool()
+		esLoadBalancing = kingpin.Flag("es.load-balancing",
+			"How requests are spread over the endpoints, one of failover or round-robin.").
+			Default("failover").Enum("failover", "round-robin")
+		esHealthCheckInterval = kingpin.Flag("es.health-check-interval",
+			"Interval of the active health checks of the endpoints, 0 disables them.").
+			Default("10s").Duration()
+		esSniff = kingpin.Flag("es.sniff",
+			"Discover the nodes of the cluster and use their HTTP publish addresses as endpoints.").
+			Default("false").Bool()
+		esSniffInterval = kingpin.Flag("es.sniff-interval",
+			"Interval of the discovery of the nodes of the cluster.").
+			Default("5m").Duration()
+		esSniffRoles = kingpin.Flag("es.sniff-role",
+			"Only use the discovered nodes with this role, prefix it with ! to skip nodes with the role. Repeat for further roles, coordinating_only matches nodes without roles.").
+			Strings()
 		esTimeout = kingpin.Flag("es.timeout",
 			"Timeout for trying to get stats from Elasticsearch.").
 			Default("5s").Duration()
+		esCacheTTL = kingpin.Flag("es.cache-ttl",
+			"Cache successful responses of Elasticsearch for this long. Identical requests in flight are always shared.").
+			Default("0s").Duration()
+		timeoutOffset = kingpin.Flag("scrape.timeout-offset",
+			"Offset to subtract from the scrape timeout sent by Prometheus in the X-Prometheus-Scrape-Timeout-Seconds header.").
+			Default("500ms").Duration()
 		esAllNodes = kingpin.Flag("es.all",
 			"Export stats for all nodes in the cluster. If used, this flag will override the flag es.node.").
 			Default("false").Bool()
@@ -69,31 +172,49 @@ func main() {
 			"Node's name of which metrics should be exposed.").
 			Default("_local").String()
 		esExportIndices = kingpin.Flag("es.indices",
-			"Export stats for indices in the cluster.").
+			"Export stats for indices in the cluster. DEPRECATED: use --collector.indices.").
 			Default("false").Bool()
 		esExportIndicesSettings = kingpin.Flag("es.indices_settings",
-			"Export stats for settings of all indices of the cluster.").
+			"Export stats for settings of all indices of the cluster. DEPRECATED: use --collector.indices-settings.").
 			Default("false").Bool()
 		esExportIndicesMappings = kingpin.Flag("es.indices_mappings",
-			"Export stats for mappings of all indices of the cluster.").
+			"Export stats for mappings of all indices of the cluster. DEPRECATED: use --collector.indices-mappings.").
 			Default("false").Bool()
 		esExportIndexAliases = kingpin.Flag("es.aliases",
 			"Export informational alias metrics.").
 			Default("true").Bool()
+		esIndicesInclude = kingpin.Flag("es.indices-include",
+			"Only export the indices matching this pattern in the index-level collectors, a wildcard pattern or a regular expression enclosed in slashes. Can be repeated.").
+			Strings()
+		esIndicesExclude = kingpin.Flag("es.indices-exclude",
+			"Do not export the indices matching this pattern in the index-level collectors, a wildcard pattern or a regular expression enclosed in slashes. Can be repeated.").
+			Strings()
+		esIndicesGroups = kingpin.Flag("es.indices-group",
+			"Sum the index metrics of the indices matching this regular expression by its first capture group in the index_group label. Can be repeated.").
+			Strings()
+		esIndicesGroupsOnly = kingpin.Flag("es.indices-group-only",
+			"Do not export the per-index metrics of the indices of an index group.").
+			Default("false").Bool()
+		esIndicesSeriesLimit = kingpin.Flag("es.indices-series-limit",
+			"Maximum number of series of the indices collector, the indices over the limit are summed in the _other index. 0 disables the limit.").
+			Default("0").Int()
+		esIndicesSeriesLimitBy = kingpin.Flag("es.indices-series-limit-by",
+			"Value the indices are ranked by when the series limit is exceeded: store_size, docs, indexing or search.").
+			Default(config.SeriesLimitByStoreSize).Enum(config.SeriesLimitByStoreSize, config.SeriesLimitByDocs, config.SeriesLimitByIndexing, config.SeriesLimitBySearch)
 		esExportClusterSettings = kingpin.Flag("es.cluster_settings",
-			"Export stats for cluster settings.").
+			"Export stats for cluster settings. DEPRECATED: use --collector.cluster-settings.").
 			Default("false").Bool()
 		esExportShards = kingpin.Flag("es.shards",
-			"Export stats for shards in the cluster (implies --es.indices).").
+			"Export stats for shards in the cluster (implies --es.indices). DEPRECATED: use --collector.shards and --collector.indices.").
 			Default("false").Bool()
 		esExportSnapshots = kingpin.Flag("es.snapshots",
-			"Export stats for the cluster snapshots.").
+			"Export stats for the cluster snapshots. DEPRECATED: use --collector.snapshots.").
 			Default("false").Bool()
 		esExportSLM = kingpin.Flag("es.slm",
-			"Export stats for SLM snapshots.").
+			"Export stats for SLM snapshots. DEPRECATED: use --collector.slm.").
 			Default("false").Bool()
 		esExportDataStream = kingpin.Flag("es.data_stream",
-			"Export stas for Data Streams.").
+			"Export stats for Data Streams. DEPRECATED: use --collector.data-stream.").
 			Default("false").Bool()
 		esClusterInfoInterval = kingpin.Flag("es.clusterinfo.interval",
 			"Cluster info update interval for the cluster label").
@@ -107,9 +228,45 @@ func main() {
 		esClientCert = kingpin.Flag("es.client-cert",
 			"Path to PEM file that contains the corresponding cert for the private key to connect to Elasticsearch.").
 			Default("").String()
+		esPasswordFile = kingpin.Flag("es.password-file",
+			"Path to a file that contains the password of ES_USERNAME, read again when it changes.").
+			Default("").String()
+		esAPIKeyFile = kingpin.Flag("es.api-key-file",
+			"Path to a file that contains the API key to connect to Elasticsearch, read again when it changes.").
+			Default("").String()
+		esBearerTokenFile = kingpin.Flag("es.bearer-token-file",
+			"Path to a file that contains the bearer token, e.g. of a service account, to connect to Elasticsearch, read again when it changes.").
+			Default("").String()
+		esOAuth2TokenURL = kingpin.Flag("es.oauth2.token-url",
+			"URL of the OAuth2 token endpoint to request bearer tokens from with the client credentials grant.").
+			Default("").String()
+		esOAuth2ClientID = kingpin.Flag("es.oauth2.client-id",
+			"OAuth2 client ID, the client secret is read from ES_OAUTH2_CLIENT_SECRET or es.oauth2.client-secret-file.").
+			Default("").String()
+		esOAuth2ClientSecretFile = kingpin.Flag("es.oauth2.client-secret-file",
+			"Path to a file that contains the OAuth2 client secret, read again when it changes.").
+			Default("").String()
+		esOAuth2Scopes = kingpin.Flag("es.oauth2.scope",
+			"OAuth2 scope to request. Can be repeated.").
+			Strings()
+		esOAuth2SharedSecretFile = kingpin.Flag("es.oauth2.shared-secret-file",
+			"Path to a file that contains the shared secret sent in the ES-Client-Authentication header, read again when it changes.").
+			Default("").String()
 		esInsecureSkipVerify = kingpin.Flag("es.ssl-skip-verify",
 			"Skip SSL verification when connecting to Elasticsearch.").
 			Default("false").Bool()
+		esTLSServerName = kingpin.Flag("es.tls-server-name",
+			"Server name to verify the certificate of Elasticsearch with, e.g. when connecting by IP address.").
+			Default("").String()
+		esTLSMinVersion = kingpin.Flag("es.tls-min-version",
+			"Minimum TLS version to connect to Elasticsearch with, one of TLS10, TLS11, TLS12 or TLS13.").
+			Default("").String()
+		esTLSMaxVersion = kingpin.Flag("es.tls-max-version",
+			"Maximum TLS version to connect to Elasticsearch with, one of TLS10, TLS11, TLS12 or TLS13.").
+			Default("").String()
+		esTLSCipherSuites = kingpin.Flag("es.tls-cipher-suite",
+			"TLS cipher suite to connect to Elasticsearch with, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. Can be repeated.").
+			Strings()
 		logLevel = kingpin.Flag("log.level",
 			"Sets the loglevel. Valid levels are debug, info, warn, error").
 			Default("info").String()
@@ -122,6 +279,21 @@ func main() {
 		awsRegion = kingpin.Flag("aws.region",
 			"Region for AWS elasticsearch").
 			Default("").String()
+		awsService = kingpin.Flag("aws.service",
+			"AWS service requests are signed for, es for Amazon OpenSearch Service or aoss for OpenSearch Serverless.").
+			Default("es").Enum("es", "aoss")
+		awsRoleARN = kingpin.Flag("aws.role-arn",
+			"ARN of the AWS role to assume to sign the requests.").
+			Default("").String()
+		awsWebIdentityTokenFile = kingpin.Flag("aws.web-identity-token-file",
+			"Path to a web identity token file to assume aws.role-arn with, e.g. a Kubernetes service account token.").
+			Default("").String()
+		configFile = kingpin.Flag("config.file",
+			"Path to the YAML configuration file. It is reloaded on SIGHUP and, with web.enable-lifecycle, on POST requests to /-/reload.").
+			Default("").String()
+		enableLifecycle = kingpin.Flag("web.enable-lifecycle",
+			"Enable reloading the configuration file via HTTP request.").
+			Default("false").Bool()
 	)
 
 	kingpin.Version(version.Print(name))
@@ -130,110 +302,132 @@ func main() {
 
 	logger := getLogger(*logLevel, *logOutput, *logFormat)
 
-	esURL, err := url.Parse(*esURI)
-	if err != nil {
-		_ = level.Error(logger).Log(
-			"msg", "failed to parse es.uri",
-			"err", err,
-		)
+	switch {
+	case *esCloudID != "" && len(*esURI) > 0:
+		_ = level.Error(logger).Log("msg", "es.cloud-id and es.uri are mutually exclusive")
 		os.Exit(1)
-	}
-
-	esUsername := os.Getenv("ES_USERNAME")
-	esPassword := os.Getenv("ES_PASSWORD")
-
-	if esUsername != "" && esPassword != "" {
-		esURL.User = url.UserPassword(esUsername, esPassword)
-	}
-
-	// returns nil if not provided and falls back to simple TCP.
-	tlsConfig := createTLSConfig(*esCA, *esClientCert, *esClientPrivateKey, *esInsecureSkipVerify)
-
-	var httpTransport http.RoundTripper
-
-	httpTransport = &http.Transport{
-		TLSClientConfig: tlsConfig,
-		Proxy:           http.ProxyFromEnvironment,
-	}
-
-	esAPIKey := os.Getenv("ES_API_KEY")
-
-	if esAPIKey != "" {
-		httpTransport = &transportWithAPIKey{
-			underlyingTransport: httpTransport,
-			apiKey:              esAPIKey,
-		}
-	}
-
-	httpClient := &http.Client{
-		Timeout:   *esTimeout,
-		Transport: httpTransport,
-	}
-
-	if *awsRegion != "" {
-		httpClient.Transport, err = roundtripper.NewAWSSigningTransport(httpTransport, *awsRegion, logger)
+	case *esCloudID != "":
+		uri, err := config.CloudIDURL(*esCloudID)
 		if err != nil {
-			_ = level.Error(logger).Log("msg", "failed to create AWS transport", "err", err)
+			_ = level.Error(logger).Log(
+				"msg", "failed to decode es.cloud-id",
+				"err", err,
+			)
 			os.Exit(1)
 		}
+		*esURI = []string{uri}
+	case len(*esURI) == 0:
+		*esURI = []string{config.DefaultURI}
 	}
 
-	// version metric
-	prometheus.MustRegister(version.NewCollector(name))
-
-	// create the exporter
-	exporter, err := collector.NewElasticsearchCollector(
-		logger,
-		[]string{},
-		collector.WithElasticsearchURL(esURL),
-		collector.WithHTTPClient(httpClient),
-	)
-	if err != nil {
-		_ = level.Error(logger).Log("msg", "failed to create Elasticsearch collector", "err", err)
-		os.Exit(1)
-	}
-	prometheus.MustRegister(exporter)
-
-	// TODO(@sysadmind): Remove this when we have a better way to get the cluster name to down stream collectors.
-	// cluster info retriever
-	clusterInfoRetriever := clusterinfo.New(logger, httpClient, esURL, *esClusterInfoInterval)
-
-	prometheus.MustRegister(collector.NewClusterHealth(logger, httpClient, esURL))
-	prometheus.MustRegister(collector.NewNodes(logger, httpClient, esURL, *esAllNodes, *esNode))
-
-	if *esExportIndices || *esExportShards {
-		prometheus.MustRegister(collector.NewShards(logger, httpClient, esURL))
-		iC := collector.NewIndices(logger, httpClient, esURL, *esExportShards, *esExportIndexAliases)
-		prometheus.MustRegister(iC)
-		if registerErr := clusterInfoRetriever.RegisterConsumer(iC); registerErr != nil {
-			_ = level.Error(logger).Log("msg", "failed to register indices collector in cluster info")
+	for _, uri := range *esURI {
+		if _, err := url.Parse(uri); err != nil {
+			_ = level.Error(logger).Log(
+				"msg", "failed to parse es.uri",
+				"err", err,
+			)
 			os.Exit(1)
 		}
 	}
 
-	if *esExportSnapshots {
-		prometheus.MustRegister(collector.NewSnapshots(logger, httpClient, esURL))
+	// the es.* flags are used unless the configuration file has an elasticsearch section
+	flagsConfig := &config.Elasticsearch{
+		URI:                 (*esURI)[0],
+		Endpoints:           (*esURI)[1:],
+		ResolveDNS:          *esResolveDNS,
+		LoadBalancing:       *esLoadBalancing,
+		HealthCheckInterval: *esHealthCheckInterval,
+		Sniff:               *esSniff,
+		SniffInterval:       *esSniffInterval,
+		SniffRoles:          *esSniffRoles,
+		ClusterInfoInterval: *esClusterInfoInterval,
+		RefreshIntervals:    collector.RefreshIntervals(),
+		Module: config.Module{
+			Timeout:  *esTimeout,
+			CacheTTL: *esCacheTTL,
+			Auth: config.Auth{
+				Username:        os.Getenv("ES_USERNAME"),
+				Password:        os.Getenv("ES_PASSWORD"),
+				PasswordFile:    *esPasswordFile,
+				APIKey:          os.Getenv("ES_API_KEY"),
+				APIKeyFile:      *esAPIKeyFile,
+				BearerToken:     os.Getenv("ES_BEARER_TOKEN"),
+				BearerTokenFile: *esBearerTokenFile,
+			},
+			TLS: config.TLS{
+				CAFile:             *esCA,
+				CertFile:           *esClientCert,
+				KeyFile:            *esClientPrivateKey,
+				InsecureSkipVerify: *esInsecureSkipVerify,
+				ServerName:         *esTLSServerName,
+				MinVersion:         *esTLSMinVersion,
+				MaxVersion:         *esTLSMaxVersion,
+				CipherSuites:       *esTLSCipherSuites,
+			},
+			AWSRegion:               *awsRegion,
+			AWSService:              *awsService,
+			AWSRoleARN:              *awsRoleARN,
+			AWSWebIdentityTokenFile: *awsWebIdentityTokenFile,
+			Collectors:              collector.EnabledCollectors(),
+			Options: config.ModuleOptions{
+				AllNodes:             *esAllNodes,
+				Node:                 *esNode,
+				Aliases:              *esExportIndexAliases,
+				IndicesInclude:       *esIndicesInclude,
+				IndicesExclude:       *esIndicesExclude,
+				IndexGroupsOnly:      *esIndicesGroupsOnly,
+				IndicesSeriesLimit:   *esIndicesSeriesLimit,
+				IndicesSeriesLimitBy: *esIndicesSeriesLimitBy,
+			},
+		},
 	}
-
-	if *esExportSLM {
-		prometheus.MustRegister(collector.NewSLM(logger, httpClient, esURL))
+	if *esOAuth2TokenURL != "" {
+		flagsConfig.Module.Auth.OAuth2 = &config.OAuth2{
+			TokenURL:         *esOAuth2TokenURL,
+			ClientID:         *esOAuth2ClientID,
+			ClientSecret:     os.Getenv("ES_OAUTH2_CLIENT_SECRET"),
+			ClientSecretFile: *esOAuth2ClientSecretFile,
+			Scopes:           *esOAuth2Scopes,
+			SharedSecretFile: *esOAuth2SharedSecretFile,
+		}
 	}
-
-	if *esExportDataStream {
-		prometheus.MustRegister(collector.NewDataStream(logger, httpClient, esURL))
+	for _, regex := range *esIndicesGroups {
+		flagsConfig.Module.Options.IndexGroups = append(flagsConfig.Module.Options.IndexGroups, config.IndexGroup{Regex: regex})
 	}
-
-	if *esExportClusterSettings {
-		prometheus.MustRegister(collector.NewClusterSettings(logger, httpClient, esURL))
+	// deprecated aliases of the --collector.<name> flags
+	for _, alias := range []struct {
+		flag       string
+		enabled    bool
+		collectors []string
+	}{
+		{"es.indices", *esExportIndices, []string{"indices"}},
+		{"es.shards", *esExportShards, []string{"indices", "shards"}},
+		{"es.snapshots", *esExportSnapshots, []string{"snapshots"}},
+		{"es.slm", *esExportSLM, []string{"slm"}},
+		{"es.data_stream", *esExportDataStream, []string{"data-stream"}},
+		{"es.cluster_settings", *esExportClusterSettings, []string{"cluster-settings"}},
+		{"es.indices_settings", *esExportIndicesSettings, []string{"indices-settings"}},
+		{"es.indices_mappings", *esExportIndicesMappings, []string{"indices-mappings"}},
+	} {
+		if !alias.enabled {
+			continue
+		}
+		_ = level.Warn(logger).Log(
+			"msg", "flag is deprecated, use the --collector.<name> flags instead",
+			"flag", alias.flag,
+		)
+		flagsConfig.Module.Collectors = append(flagsConfig.Module.Collectors, alias.collectors...)
 	}
-
-	if *esExportIndicesSettings {
-		prometheus.MustRegister(collector.NewIndicesSettings(logger, httpClient, esURL))
+	if err := flagsConfig.Validate(); err != nil {
+		_ = level.Error(logger).Log("msg", "invalid es.* flags", "err", err)
+		os.Exit(1)
 	}
 
-	if *esExportIndicesMappings {
-		prometheus.MustRegister(collector.NewIndicesMappings(logger, httpClient, esURL))
-	}
+	// version metric
+	prometheus.MustRegister(version.NewCollector(name))
+	prometheus.MustRegister(transportMetrics)
+	prometheus.MustRegister(credentialMetrics)
+	prometheus.MustRegister(tlsMetrics)
 
 	// create a http server
 	server := &http.Server{}
@@ -242,27 +436,43 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
 	defer cancel()
 
-	// start the cluster info retriever
-	switch runErr := clusterInfoRetriever.Run(ctx); runErr {
-	case nil:
-		_ = level.Info(logger).Log(
-			"msg", "started cluster info retriever",
-			"interval", (*esClusterInfoInterval).String(),
-		)
-	case clusterinfo.ErrInitialCallTimeout:
-		_ = level.Info(logger).Log("msg", "initial cluster info call timed out")
-	default:
-		_ = level.Error(logger).Log("msg", "failed to run cluster info retriever", "err", err)
+	// create the exporter and load the configuration file, which is reloaded on
+	// SIGHUP and, if enabled, on requests to /-/reload
+	exporter := newClusterExporter(ctx, flagsConfig, *readinessWindow, logger)
+	prober := newProber(logger, *timeoutOffset)
+	configReloader := newReloader(*configFile, logger, exporter.PrepareConfig, prober.PrepareConfig)
+	if err := configReloader.Reload(); err != nil {
+		_ = level.Error(logger).Log("msg", "failed to apply config", "err", err)
 		os.Exit(1)
 	}
-
-	// register cluster info retriever as prometheus collector
-	prometheus.MustRegister(clusterInfoRetriever)
+	prometheus.MustRegister(configReloader)
+	go configReloader.Run(ctx)
 
 	mux := http.DefaultServeMux
-	mux.Handle(*metricsPath, promhttp.Handler())
+	mux.Handle(*metricsPath, promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel, err := scrapeContext(r, *timeoutOffset)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			defer cancel()
+			gatherer, err := exporter.Gatherer(ctx, r.URL.Query()["collect[]"])
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			gatherers := prometheus.Gatherers{prometheus.DefaultGatherer, gatherer}
+			promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+		}),
+	))
+	mux.Handle("/probe", prober)
+	if *enableLifecycle {
+		mux.Handle("/-/reload", configReloader)
+	}
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		_, err = w.Write([]byte(`<html>
+		_, err := w.Write([]byte(`<html>
 			<head><title>Elasticsearch Exporter</title></head>
 			<body>
 			<h1>Elasticsearch Exporter</h1>
@@ -282,6 +492,9 @@ func main() {
 		http.Error(w, http.StatusText(http.StatusOK), http.StatusOK)
 	})
 
+	// readiness endpoint, reporting whether Elasticsearch can be reached
+	mux.HandleFunc("/readyz", exporter.ServeReady)
+
 	server.Handler = mux
 	server.Addr = *listenAddress
 
@@ -15,17 +15,16 @@ package clusterinfo
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
-	"path"
+	"sync"
 	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/esclient"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -35,7 +34,7 @@ const (
 )
 
 var (
-	// ErrConsumerAlreadyRegistered is returned if a consumer is already registered
+	// ErrConsumerAlreadyRegistered is returned if a subscription or consumer with the same name is already registered
 	ErrConsumerAlreadyRegistered = errors.New("consumer already registered")
 	// ErrInitialCallTimeout is returned if the initial clusterinfo call timed out
 	ErrInitialCallTimeout = errors.New("initial cluster info call timed out")
@@ -49,12 +48,57 @@ type consumer interface {
 	String() string
 }
 
+// Subscription receives the cluster info updates of a Retriever. Only the
+// latest update is buffered: an update which has not been received when the
+// next one is sent is replaced, so a slow subscriber never blocks the
+// Retriever and always receives the current cluster info.
+type Subscription struct {
+	name string
+	ch   chan *Response
+	// owned reports whether the channel is closed on Unsubscribe, which is not
+	// the case for the channels of consumers, see RegisterConsumer.
+	owned bool
+	r     *Retriever
+}
+
+// Updates returns the channel of the cluster info updates. It is closed when
+// the subscription is cancelled by Unsubscribe.
+func (s *Subscription) Updates() <-chan *Response {
+	return s.ch
+}
+
+// Unsubscribe stops the updates of the subscription. It is safe to call it
+// more than once.
+func (s *Subscription) Unsubscribe() {
+	s.r.unsubscribe(s)
+}
+
+// Status is the outcome of the cluster info retrievals.
+type Status struct {
+	// LastSuccess is the time of the last successful retrieval, zero if the
+	// cluster info has never been retrieved.
+	LastSuccess time.Time
+	// LastError is the error of the last retrieval, nil if it succeeded.
+	LastError error
+	// LastErrorTime is the time of the last failed retrieval.
+	LastErrorTime time.Time
+}
+
 // Retriever periodically gets the cluster info from the / endpoint end
-// sends it to all registered consumer channels
+// sends it to all subscriptions
 type Retriever struct {
-	consumerChannels      map[string]*chan *Response
+	// mu guards the subscriptions, the latest cluster info, the status and
+	// the url label
+	mu            sync.Mutex
+	subscriptions map[string]*Subscription
+	latest        *Response
+	status        Status
+	// urlLabel is the url label of the metrics, the endpoint which served the
+	// last cluster info
+	urlLabel string
+
 	logger                log.Logger
-	client                *http.Client
+	client                *esclient.Client
 	url                   *url.URL
 	interval              time.Duration
 	sync                  chan struct{}
@@ -62,17 +106,21 @@ type Retriever struct {
 	up                    *prometheus.GaugeVec
 	lastUpstreamSuccessTs *prometheus.GaugeVec
 	lastUpstreamErrorTs   *prometheus.GaugeVec
+	staleUpdates          *prometheus.CounterVec
+	droppedUpdates        *prometheus.CounterVec
+	uuidChanges           prometheus.Counter
 }
 
 // New creates a new Retriever
 func New(logger log.Logger, client *http.Client, u *url.URL, interval time.Duration) *Retriever {
 	return &Retriever{
-		consumerChannels: make(map[string]*chan *Response),
-		logger:           logger,
-		client:           client,
-		url:              u,
-		interval:         interval,
-		sync:             make(chan struct{}, 1),
+		subscriptions: make(map[string]*Subscription),
+		logger:        logger,
+		client:        esclient.New(logger, client, u),
+		url:           u,
+		urlLabel:      endpointLabel(u),
+		interval:      interval,
+		sync:          make(chan struct{}, 1),
 		versionMetric: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: prometheus.BuildFQName(namespace, subsystem, "version_info"),
@@ -81,6 +129,7 @@ func New(logger log.Logger, client *http.Client, u *url.URL, interval time.Durat
 			[]string{
 				"cluster",
 				"cluster_uuid",
+				"distribution",
 				"build_date",
 				"build_hash",
 				"version",
@@ -108,6 +157,26 @@ func New(logger log.Logger, client *http.Client, u *url.URL, interval time.Durat
 			},
 			[]string{"url"},
 		),
+		staleUpdates: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: prometheus.BuildFQName(namespace, subsystem, "stale_updates_total"),
+				Help: "Number of cluster info updates replaced by a newer one before the subscriber received them",
+			},
+			[]string{"subscriber"},
+		),
+		droppedUpdates: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: prometheus.BuildFQName(namespace, subsystem, "dropped_updates_total"),
+				Help: "Number of cluster info updates which could not be delivered to the subscriber",
+			},
+			[]string{"subscriber"},
+		),
+		uuidChanges: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: prometheus.BuildFQName(namespace, subsystem, "uuid_changes_total"),
+				Help: "Number of times the UUID of the cluster behind the URL changed",
+			},
+		),
 	}
 }
 
@@ -117,6 +186,9 @@ func (r *Retriever) Describe(ch chan<- *prometheus.Desc) {
 	r.up.Describe(ch)
 	r.lastUpstreamSuccessTs.Describe(ch)
 	r.lastUpstreamErrorTs.Describe(ch)
+	r.staleUpdates.Describe(ch)
+	r.droppedUpdates.Describe(ch)
+	r.uuidChanges.Describe(ch)
 }
 
 // Collect implements the prometheus.Collector interface
@@ -125,12 +197,31 @@ func (r *Retriever) Collect(ch chan<- prometheus.Metric) {
 	r.up.Collect(ch)
 	r.lastUpstreamSuccessTs.Collect(ch)
 	r.lastUpstreamErrorTs.Collect(ch)
+	r.staleUpdates.Collect(ch)
+	r.droppedUpdates.Collect(ch)
+	r.uuidChanges.Collect(ch)
 }
 
-func (r *Retriever) updateMetrics(res *Response) {
-	u := *r.url
-	u.User = nil
-	url := u.String()
+// endpointLabel returns the url label of the endpoint, its scheme and host.
+func endpointLabel(u *url.URL) string {
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host}).String()
+}
+
+// updateMetrics updates the metrics with the response served by the URL
+// served. Without a response, the metrics of the endpoint which served the
+// last response are updated, so that the retriever has a single series.
+func (r *Retriever) updateMetrics(res *Response, served *url.URL) {
+	r.mu.Lock()
+	if served != nil {
+		if label := endpointLabel(served); label != r.urlLabel {
+			r.up.DeleteLabelValues(r.urlLabel)
+			r.lastUpstreamSuccessTs.DeleteLabelValues(r.urlLabel)
+			r.lastUpstreamErrorTs.DeleteLabelValues(r.urlLabel)
+			r.urlLabel = label
+		}
+	}
+	url := r.urlLabel
+	r.mu.Unlock()
 	_ = level.Debug(r.logger).Log("msg", "updating cluster info metrics")
 	// scrape failed, response is nil
 	if res == nil {
@@ -142,6 +233,7 @@ func (r *Retriever) updateMetrics(res *Response) {
 	r.versionMetric.WithLabelValues(
 		res.ClusterName,
 		res.ClusterUUID,
+		res.Version.DistributionName(),
 		res.Version.BuildDate,
 		res.Version.BuildHash,
 		res.Version.Number.String(),
@@ -150,18 +242,126 @@ func (r *Retriever) updateMetrics(res *Response) {
 	r.lastUpstreamSuccessTs.WithLabelValues(url).Set(float64(time.Now().Unix()))
 }
 
+// Status returns the outcome of the cluster info retrievals.
+func (r *Retriever) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// setStatus records the outcome of a retrieval.
+func (r *Retriever) setStatus(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.LastError = err
+	if err != nil {
+		r.status.LastErrorTime = time.Now()
+	} else {
+		r.status.LastSuccess = time.Now()
+	}
+}
+
 // Update triggers an external cluster info label update
 func (r *Retriever) Update() {
 	r.sync <- struct{}{}
 }
 
-// RegisterConsumer registers a consumer for cluster info updates
+// Subscribe returns a subscription to the cluster info updates with the
+// given name, which must be unique among the subscriptions of the Retriever.
+// If the cluster info has already been retrieved, it is available on the
+// Updates channel right away, so subscriptions may be created at any time,
+// e.g. by the collectors of a probe or after a reload. The subscription must
+// be cancelled by Unsubscribe once it is not used anymore.
+func (r *Retriever) Subscribe(name string) (*Subscription, error) {
+	return r.subscribe(name, make(chan *Response, 1), true)
+}
+
+// RegisterConsumer registers a consumer for cluster info updates. The updates
+// are sent to the channel of the consumer with the semantics of a Subscription,
+// so the consumer should provide a buffered channel.
+//
+// Deprecated: use Subscribe.
 func (r *Retriever) RegisterConsumer(c consumer) error {
-	if _, registered := r.consumerChannels[c.String()]; registered {
-		return ErrConsumerAlreadyRegistered
+	_, err := r.subscribe(c.String(), *c.ClusterLabelUpdates(), false)
+	return err
+}
+
+func (r *Retriever) subscribe(name string, ch chan *Response, owned bool) (*Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, registered := r.subscriptions[name]; registered {
+		return nil, ErrConsumerAlreadyRegistered
+	}
+	s := &Subscription{name: name, ch: ch, owned: owned, r: r}
+	r.subscriptions[name] = s
+	if r.latest != nil {
+		r.send(s, r.latest)
+	}
+	return s, nil
+}
+
+func (r *Retriever) unsubscribe(s *Subscription) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.subscriptions[s.name] != s {
+		return
+	}
+	delete(r.subscriptions, s.name)
+	r.staleUpdates.DeleteLabelValues(s.name)
+	r.droppedUpdates.DeleteLabelValues(s.name)
+	if s.owned {
+		close(s.ch)
 	}
-	r.consumerChannels[c.String()] = c.ClusterLabelUpdates()
-	return nil
+}
+
+// checkClusterUUID detects whether the URL serves a different cluster than on
+// the last retrieval, e.g. after the cluster was rebuilt or its DNS name was
+// moved. The version info of the previous cluster is removed, the subscribers
+// detect the change by the UUID of the cluster info.
+func (r *Retriever) checkClusterUUID(res *Response) {
+	r.mu.Lock()
+	latest := r.latest
+	r.mu.Unlock()
+	if latest == nil || latest.ClusterUUID == res.ClusterUUID {
+		return
+	}
+	_ = level.Warn(r.logger).Log(
+		"msg", "cluster UUID changed, the URL serves a different cluster",
+		"previous_cluster", latest.ClusterName,
+		"previous_cluster_uuid", latest.ClusterUUID,
+		"cluster", res.ClusterName,
+		"cluster_uuid", res.ClusterUUID,
+	)
+	r.uuidChanges.Inc()
+	r.versionMetric.Reset()
+}
+
+// publish sends the cluster info to all subscriptions.
+func (r *Retriever) publish(res *Response) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latest = res
+	for name, s := range r.subscriptions {
+		_ = level.Debug(r.logger).Log(
+			"msg", "sending update",
+			"subscriber", name,
+			"res", fmt.Sprintf("%+v", res),
+		)
+		r.send(s, res)
+	}
+}
+
+// Fetch retrieves the cluster info once and updates the retriever metrics. Unlike Run
+// it neither starts the update loop nor sends the result to registered consumers.
+func (r *Retriever) Fetch(ctx context.Context) (*Response, error) {
+	res, served, err := r.fetchAndDecodeClusterInfo(ctx)
+	r.setStatus(err)
+	if err != nil {
+		r.updateMetrics(nil, nil)
+		return nil, err
+	}
+	r.updateMetrics(res, served)
+	return res, nil
 }
 
 // Run starts the update loop and periodically queries the / endpoint
@@ -183,24 +383,19 @@ func (r *Retriever) Run(ctx context.Context) error {
 				_ = level.Info(r.logger).Log(
 					"msg", "providing consumers with updated cluster info label",
 				)
-				res, err := r.fetchAndDecodeClusterInfo()
+				res, served, err := r.fetchAndDecodeClusterInfo(ctx)
+				r.setStatus(err)
 				if err != nil {
 					_ = level.Error(r.logger).Log(
 						"msg", "failed to retrieve cluster info from ES",
 						"err", err,
 					)
-					r.updateMetrics(nil)
+					r.updateMetrics(nil, nil)
 					continue
 				}
-				r.updateMetrics(res)
-				for name, consumerCh := range r.consumerChannels {
-					_ = level.Debug(r.logger).Log(
-						"msg", "sending update",
-						"consumer", name,
-						"res", fmt.Sprintf("%+v", res),
-					)
-					*consumerCh <- res
-				}
+				r.checkClusterUUID(res)
+				r.updateMetrics(res, served)
+				r.publish(res)
 				// close startupComplete if not already closed
 				select {
 				case <-startupComplete:
@@ -225,6 +420,7 @@ func (r *Retriever) Run(ctx context.Context) error {
 			return
 		}
 		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
 		for {
 			select {
 			case <-ctx.Done():
@@ -237,7 +433,12 @@ func (r *Retriever) Run(ctx context.Context) error {
 				_ = level.Debug(r.logger).Log(
 					"msg", "triggering periodic update",
 				)
-				r.sync <- struct{}{}
+				// the update loop exits when ctx is done
+				select {
+				case r.sync <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
 			}
 		}
 	}(ctx)
@@ -257,42 +458,43 @@ func (r *Retriever) Run(ctx context.Context) error {
 	}
 }
 
-func (r *Retriever) fetchAndDecodeClusterInfo() (*Response, error) {
-	var response *Response
-	u := *r.url
-	u.Path = path.Join(r.url.Path, "/")
+// send passes the cluster info to the subscription without blocking the
+// update loop. As only the latest cluster info matters, an update the
+// subscriber has not received yet is replaced. The update is dropped if the
+// subscriber is neither waiting for it nor has a buffered channel. r.mu must
+// be held.
+func (r *Retriever) send(s *Subscription, res *Response) {
+	select {
+	case s.ch <- res:
+		return
+	default:
+	}
+	select {
+	case <-s.ch:
+		r.staleUpdates.WithLabelValues(s.name).Inc()
+	default:
+	}
+	select {
+	case s.ch <- res:
+	default:
+		r.droppedUpdates.WithLabelValues(s.name).Inc()
+		_ = level.Warn(r.logger).Log(
+			"msg", "dropped cluster info update, subscriber is not ready",
+			"subscriber", s.name,
+		)
+	}
+}
 
-	res, err := r.client.Get(u.String())
+// fetchAndDecodeClusterInfo returns the cluster info and the URL which served it.
+func (r *Retriever) fetchAndDecodeClusterInfo(ctx context.Context) (*Response, *url.URL, error) {
+	var response *Response
+	served, err := r.client.GetWithURL(ctx, "/", nil, &response)
 	if err != nil {
 		_ = level.Error(r.logger).Log(
 			"msg", "failed to get cluster info",
 			"err", err,
 		)
-		return nil, err
+		return nil, nil, err
 	}
-
-	defer func() {
-		err = res.Body.Close()
-		if err != nil {
-			_ = level.Warn(r.logger).Log(
-				"msg", "failed to close http.Client",
-				"err", err,
-			)
-		}
-	}()
-
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
-	}
-
-	bts, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	if err := json.Unmarshal(bts, &response); err != nil {
-		return nil, err
-	}
-
-	return response, nil
+	return response, served, nil
 }
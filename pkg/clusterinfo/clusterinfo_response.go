@@ -26,11 +26,28 @@ type Response struct {
 	Tagline     string      `json:"tagline"`
 }
 
+// Distributions of the cluster software.
+const (
+	DistributionElasticsearch = "elasticsearch"
+	DistributionOpenSearch    = "opensearch"
+)
+
 // VersionInfo is the version info retrievable from the / endpoint, embedded in Response
 type VersionInfo struct {
+	// Distribution is only set by distributions other than Elasticsearch
+	Distribution  string         `json:"distribution"`
 	Number        semver.Version `json:"number"`
 	BuildHash     string         `json:"build_hash"`
 	BuildDate     string         `json:"build_date"`
 	BuildSnapshot bool           `json:"build_snapshot"`
 	LuceneVersion semver.Version `json:"lucene_version"`
 }
+
+// DistributionName returns the distribution of the cluster software,
+// DistributionElasticsearch if none is given.
+func (v VersionInfo) DistributionName() string {
+	if v.Distribution == "" {
+		return DistributionElasticsearch
+	}
+	return v.Distribution
+}
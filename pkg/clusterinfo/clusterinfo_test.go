@@ -22,10 +22,12 @@ import (
 	"os"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 
 	"github.com/blang/semver/v4"
 )
@@ -83,7 +85,7 @@ type mockConsumer struct {
 func newMockConsumer(ctx context.Context, name string, t *testing.T) *mockConsumer {
 	mc := &mockConsumer{
 		name: name,
-		ch:   make(chan *Response),
+		ch:   make(chan *Response, 1),
 	}
 	go func() {
 		for {
@@ -142,8 +144,8 @@ func TestRetriever_RegisterConsumer(t *testing.T) {
 			t.Errorf("failed to register consumer: %s", err)
 		}
 	}
-	if len(retriever.consumerChannels) != len(consumerNames) {
-		t.Error("number of registered consumerChannels doesn't match the number of calls to the register func")
+	if len(retriever.subscriptions) != len(consumerNames) {
+		t.Error("number of registered subscriptions doesn't match the number of calls to the register func")
 	}
 }
 
@@ -172,7 +174,7 @@ func TestRetriever_fetchAndDecodeClusterInfo(t *testing.T) {
 		t.Skipf("internal test error: %s", err)
 	}
 	retriever := New(log.NewNopLogger(), mockES.Client(), u, 0)
-	ci, err := retriever.fetchAndDecodeClusterInfo()
+	ci, _, err := retriever.fetchAndDecodeClusterInfo(context.Background())
 	if err != nil {
 		t.Fatalf("failed to retrieve cluster info: %s", err)
 	}
@@ -219,3 +221,209 @@ func TestRetriever_Run(t *testing.T) {
 	default:
 	}
 }
+
+func TestRetriever_RunSlowConsumer(t *testing.T) {
+	mockES := httptest.NewServer(mockES{})
+	defer mockES.Close()
+	u, err := url.Parse(mockES.URL)
+	if err != nil {
+		t.Fatalf("internal test error: %s", err)
+	}
+	retriever := New(log.NewNopLogger(), mockES.Client(), u, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	// the slow consumer never receives its updates
+	slow := &mockConsumer{name: "slow", ch: make(chan *Response)}
+	mc := newMockConsumer(ctx, "test-consumer", t)
+	for _, c := range []consumer{slow, mc} {
+		if err := retriever.RegisterConsumer(c); err != nil {
+			t.Fatalf("failed to register consumer: %s", err)
+		}
+	}
+
+	if err := retriever.Run(ctx); err != nil {
+		t.Fatalf("failed to run retriever: %s", err)
+	}
+	retriever.Update()
+	retriever.Update()
+	for ctx.Err() == nil {
+		mc.mu.RLock()
+		received := mc.data != nil
+		mc.mu.RUnlock()
+		if received {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("consumer did not receive the cluster info")
+}
+
+func TestRetriever_Subscribe(t *testing.T) {
+	u, err := url.Parse("http://localhost:9200")
+	if err != nil {
+		t.Fatalf("internal test error: %s", err)
+	}
+	retriever := New(log.NewNopLogger(), http.DefaultClient, u, 0)
+
+	early, err := retriever.Subscribe("early")
+	if err != nil {
+		t.Fatalf("failed to subscribe: %s", err)
+	}
+	if _, err := retriever.Subscribe("early"); err != ErrConsumerAlreadyRegistered {
+		t.Errorf("expected %s on duplicate subscription, got %v", ErrConsumerAlreadyRegistered, err)
+	}
+
+	first, second := &Response{ClusterName: "first"}, &Response{ClusterName: "second"}
+	retriever.publish(first)
+	retriever.publish(second)
+	if ci := <-early.Updates(); ci != second {
+		t.Errorf("expected the latest cluster info %+v, got %+v", second, ci)
+	}
+	if v := testutil.ToFloat64(retriever.staleUpdates.WithLabelValues("early")); v != 1 {
+		t.Errorf("expected 1 stale update, got %v", v)
+	}
+
+	// a subscription created after the retrieval receives the latest cluster info
+	late, err := retriever.Subscribe("late")
+	if err != nil {
+		t.Fatalf("failed to subscribe: %s", err)
+	}
+	select {
+	case ci := <-late.Updates():
+		if ci != second {
+			t.Errorf("expected the latest cluster info %+v, got %+v", second, ci)
+		}
+	default:
+		t.Error("late subscription did not receive the latest cluster info")
+	}
+
+	early.Unsubscribe()
+	early.Unsubscribe()
+	if _, ok := <-early.Updates(); ok {
+		t.Error("expected the updates of a cancelled subscription to be closed")
+	}
+	retriever.publish(first)
+	if ci := <-late.Updates(); ci != first {
+		t.Errorf("expected the latest cluster info %+v, got %+v", first, ci)
+	}
+
+	// the name of a cancelled subscription can be reused
+	if _, err := retriever.Subscribe("early"); err != nil {
+		t.Errorf("failed to subscribe again: %s", err)
+	}
+}
+
+func TestRetriever_checkClusterUUID(t *testing.T) {
+	u, err := url.Parse("http://localhost:9200")
+	if err != nil {
+		t.Fatalf("internal test error: %s", err)
+	}
+	retriever := New(log.NewNopLogger(), http.DefaultClient, u, 0)
+
+	for _, tc := range []struct {
+		uuid     string
+		expected float64
+	}{
+		{"uuid-1", 0},
+		{"uuid-1", 0},
+		{"uuid-2", 1},
+		{"uuid-1", 2},
+	} {
+		res := &Response{ClusterName: clusterName, ClusterUUID: tc.uuid}
+		retriever.checkClusterUUID(res)
+		retriever.updateMetrics(res, nil)
+		retriever.publish(res)
+		if v := testutil.ToFloat64(retriever.uuidChanges); v != tc.expected {
+			t.Errorf("expected %v UUID changes after %s, got %v", tc.expected, tc.uuid, v)
+		}
+		// only the version info of the current cluster is exported
+		if n := testutil.CollectAndCount(retriever.versionMetric); n != 1 {
+			t.Errorf("expected 1 version info after %s, got %d", tc.uuid, n)
+		}
+	}
+}
+
+func TestRetriever_Status(t *testing.T) {
+	var down int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		mockES{}.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("internal test error: %s", err)
+	}
+	retriever := New(log.NewNopLogger(), ts.Client(), u, 0)
+	if s := retriever.Status(); !s.LastSuccess.IsZero() || s.LastError != nil {
+		t.Errorf("expected an empty status before the first retrieval, got %+v", s)
+	}
+
+	if _, err := retriever.Fetch(context.Background()); err != nil {
+		t.Fatalf("failed to fetch cluster info: %s", err)
+	}
+	success := retriever.Status().LastSuccess
+	if success.IsZero() || retriever.Status().LastError != nil {
+		t.Errorf("expected a successful retrieval, got %+v", retriever.Status())
+	}
+
+	atomic.StoreInt32(&down, 1)
+	if _, err := retriever.Fetch(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+	if s := retriever.Status(); !s.LastSuccess.Equal(success) || s.LastError == nil || s.LastErrorTime.IsZero() {
+		t.Errorf("expected the last success and an error, got %+v", s)
+	}
+}
+
+func TestRetriever_upMetric(t *testing.T) {
+	var down int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		mockES{}.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("internal test error: %s", err)
+	}
+	retriever := New(log.NewNopLogger(), ts.Client(), u, 0)
+
+	check := func(name, label string, expected float64) {
+		t.Helper()
+		if n := testutil.CollectAndCount(retriever.up); n != 1 {
+			t.Errorf("%s: expected 1 up series, got %d", name, n)
+		}
+		if v := testutil.ToFloat64(retriever.up.WithLabelValues(label)); v != expected {
+			t.Errorf("%s: expected up %v for %s, got %v", name, expected, label, v)
+		}
+	}
+
+	// the label of a success and a failure is the scheme and host of the URL
+	if _, err := retriever.Fetch(context.Background()); err != nil {
+		t.Fatalf("failed to fetch cluster info: %s", err)
+	}
+	check("success", ts.URL, 1)
+	atomic.StoreInt32(&down, 1)
+	if _, err := retriever.Fetch(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+	check("failure", ts.URL, 0)
+
+	// the series moves to the endpoint which served the cluster info
+	served, err := url.Parse("http://10.0.0.2:9200/")
+	if err != nil {
+		t.Fatalf("internal test error: %s", err)
+	}
+	retriever.updateMetrics(&Response{ClusterName: clusterName}, served)
+	check("other endpoint", "http://10.0.0.2:9200", 1)
+	retriever.updateMetrics(nil, nil)
+	check("other endpoint failure", "http://10.0.0.2:9200", 0)
+}
@@ -0,0 +1,542 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config holds the exporter configuration file format.
+package config
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultModuleName is the module used by the probe endpoint when none is requested.
+const DefaultModuleName = "default"
+
+// DefaultURI is the URI of the elasticsearch section when neither uri nor
+// cloud_id is set.
+const DefaultURI = "http://localhost:9200"
+
+// Collectors which can be enabled for a module.
+var knownCollectors = map[string]bool{
+	"cluster-info":     true,
+	"cluster-health":   true,
+	"nodes":            true,
+	"indices":          true,
+	"shards":           true,
+	"snapshots":        true,
+	"slm":              true,
+	"data-stream":      true,
+	"cluster-settings": true,
+	"indices-settings": true,
+	"indices-mappings": true,
+	"ilm":              true,
+}
+
+// DefaultModule is used for probes when the requested module is the default one
+// and no module of that name has been configured.
+var DefaultModule = Module{
+	Timeout:    5 * time.Second,
+	Collectors: []string{"cluster-info", "cluster-health", "nodes"},
+	Options: ModuleOptions{
+		Node:    "_local",
+		Aliases: true,
+	},
+}
+
+// Config is the content of the exporter configuration file.
+type Config struct {
+	// Elasticsearch configures the cluster exposed on the metrics endpoint. If
+	// set, it replaces the es.* command line flags.
+	Elasticsearch *Elasticsearch     `yaml:"elasticsearch"`
+	Modules       map[string]*Module `yaml:"modules"`
+}
+
+// Elasticsearch defines the cluster exposed on the metrics endpoint.
+type Elasticsearch struct {
+	URI string `yaml:"uri"`
+	// CloudID is the Elastic Cloud ID of the deployment, which replaces URI.
+	CloudID string `yaml:"cloud_id"`
+	// Endpoints are further nodes of the cluster at URI. The requests are
+	// balanced over URI and Endpoints according to LoadBalancing.
+	Endpoints []string `yaml:"endpoints"`
+	// ResolveDNS resolves the hosts of URI and Endpoints to all their
+	// addresses, which are used as endpoints.
+	ResolveDNS    bool   `yaml:"resolve_dns"`
+	LoadBalancing string `yaml:"load_balancing"`
+	// HealthCheckInterval is the interval of the active health checks of the
+	// endpoints, 0 disables them.
+	HealthCheckInterval time.Duration `yaml:"health_check_interval"`
+	// Sniff replaces the endpoints every SniffInterval by the HTTP publish
+	// addresses of the nodes of the cluster with one of SniffRoles. A role
+	// prefixed with "!" excludes the nodes with that role, the role
+	// coordinating_only matches the nodes without roles.
+	Sniff               bool          `yaml:"sniff"`
+	SniffInterval       time.Duration `yaml:"sniff_interval"`
+	SniffRoles          []string      `yaml:"sniff_roles"`
+	ClusterInfoInterval time.Duration `yaml:"clusterinfo_interval"`
+	// RefreshIntervals makes the named collectors poll Elasticsearch in the
+	// background and serve their last result on scrape.
+	RefreshIntervals map[string]time.Duration `yaml:"refresh_intervals"`
+	Module           Module                   `yaml:",inline"`
+}
+
+// UnmarshalYAML sets the defaults of the elasticsearch section before decoding it.
+func (e *Elasticsearch) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*e = Elasticsearch{
+		LoadBalancing:       "failover",
+		HealthCheckInterval: 10 * time.Second,
+		SniffInterval:       5 * time.Minute,
+		ClusterInfoInterval: 5 * time.Minute,
+		Module:              DefaultModule,
+	}
+	type plain Elasticsearch
+	if err := unmarshal((*plain)(e)); err != nil {
+		return err
+	}
+	switch {
+	case e.CloudID != "" && e.URI != "":
+		return errors.New("cloud_id and uri are mutually exclusive")
+	case e.CloudID != "":
+		uri, err := CloudIDURL(e.CloudID)
+		if err != nil {
+			return err
+		}
+		e.URI = uri
+	case e.URI == "":
+		e.URI = DefaultURI
+	}
+	return nil
+}
+
+// Validate checks the elasticsearch section for errors.
+func (e *Elasticsearch) Validate() error {
+	for _, uri := range e.URIs() {
+		u, err := url.Parse(uri)
+		if err != nil {
+			return fmt.Errorf("invalid uri: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("invalid uri scheme %q", u.Scheme)
+		}
+	}
+	if e.LoadBalancing != "failover" && e.LoadBalancing != "round-robin" {
+		return fmt.Errorf("invalid load_balancing %q, must be failover or round-robin", e.LoadBalancing)
+	}
+	if e.HealthCheckInterval < 0 {
+		return fmt.Errorf("health_check_interval must not be negative, got %s", e.HealthCheckInterval)
+	}
+	if e.Sniff {
+		if e.SniffInterval <= 0 {
+			return fmt.Errorf("sniff_interval must be positive, got %s", e.SniffInterval)
+		}
+		if e.ResolveDNS {
+			return errors.New("sniff and resolve_dns are mutually exclusive")
+		}
+	}
+	for name, interval := range e.RefreshIntervals {
+		if !knownCollectors[name] {
+			return fmt.Errorf("refresh interval for unknown collector %q", name)
+		}
+		if interval <= 0 {
+			return fmt.Errorf("refresh interval for collector %q must be positive", name)
+		}
+	}
+	return e.Module.Validate()
+}
+
+// URIs returns URI followed by Endpoints.
+func (e *Elasticsearch) URIs() []string {
+	return append([]string{e.URI}, e.Endpoints...)
+}
+
+// CloudIDURL decodes an Elastic Cloud ID into the URL of Elasticsearch like
+// the official clients. The ID is the deployment name and the base64 encoding
+// of "<host>[:<port>]$<elasticsearch id>[:<port>]$<kibana id>", separated by a
+// colon. The URL uses HTTPS and defaults to port 443.
+func CloudIDURL(cloudID string) (string, error) {
+	encoded := cloudID
+	if i := strings.LastIndex(cloudID, ":"); i >= 0 {
+		encoded = cloudID[i+1:]
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("invalid cloud ID: %w", err)
+	}
+	parts := strings.Split(string(decoded), "$")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("invalid cloud ID %q: expected <host>$<elasticsearch id>", cloudID)
+	}
+	host, port := parts[0], "443"
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		host, port = h, p
+	}
+	id := parts[1]
+	if i, p, ok := strings.Cut(id, ":"); ok {
+		id, port = i, p
+	}
+	u := url.URL{Scheme: "https", Host: net.JoinHostPort(id+"."+host, port)}
+	return u.String(), nil
+}
+
+// Balanced reports whether the requests are spread over several endpoints.
+func (e *Elasticsearch) Balanced() bool {
+	return len(e.Endpoints) > 0 || e.ResolveDNS || e.Sniff
+}
+
+// Module defines how a probed target is scraped.
+type Module struct {
+	Timeout time.Duration `yaml:"timeout"`
+	// CacheTTL caches successful responses for identical requests, which are
+	// otherwise only shared while in flight.
+	CacheTTL   time.Duration `yaml:"cache_ttl"`
+	Auth       Auth          `yaml:"auth"`
+	TLS        TLS           `yaml:"tls"`
+	AWSRegion  string        `yaml:"aws_region"`
+	AWSService string        `yaml:"aws_service"`
+	// AWSRoleARN is assumed to sign the requests, with the web identity token
+	// of AWSWebIdentityTokenFile if set.
+	AWSRoleARN              string        `yaml:"aws_role_arn"`
+	AWSWebIdentityTokenFile string        `yaml:"aws_web_identity_token_file"`
+	Collectors              []string      `yaml:"collectors"`
+	Options                 ModuleOptions `yaml:"options"`
+}
+
+// Auth holds the credentials used to connect to the target. The files are
+// read again when they change.
+type Auth struct {
+	Username        string `yaml:"username"`
+	Password        string `yaml:"password"`
+	PasswordFile    string `yaml:"password_file"`
+	APIKey          string `yaml:"api_key"`
+	APIKeyFile      string `yaml:"api_key_file"`
+	BearerToken     string `yaml:"bearer_token"`
+	BearerTokenFile string `yaml:"bearer_token_file"`
+	// OAuth2 requests the bearer tokens with the client credentials grant.
+	OAuth2 *OAuth2 `yaml:"oauth2"`
+}
+
+// OAuth2 configures the client credentials grant of the bearer tokens, e.g.
+// for the JWT realm of Elasticsearch.
+type OAuth2 struct {
+	TokenURL         string            `yaml:"token_url"`
+	ClientID         string            `yaml:"client_id"`
+	ClientSecret     string            `yaml:"client_secret"`
+	ClientSecretFile string            `yaml:"client_secret_file"`
+	Scopes           []string          `yaml:"scopes"`
+	EndpointParams   map[string]string `yaml:"endpoint_params"`
+	// SharedSecret is sent in the ES-Client-Authentication header.
+	SharedSecret     string `yaml:"shared_secret"`
+	SharedSecretFile string `yaml:"shared_secret_file"`
+}
+
+// TLS holds the TLS settings used to connect to the target.
+type TLS struct {
+	// ServerName is used to verify the certificate of the target instead of
+	// its host.
+	ServerName         string `yaml:"server_name"`
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	// MinVersion and MaxVersion are TLS versions like TLS12, see TLSVersion.
+	MinVersion   string   `yaml:"min_version"`
+	MaxVersion   string   `yaml:"max_version"`
+	CipherSuites []string `yaml:"cipher_suites"`
+}
+
+// tlsVersions are the TLS versions by name.
+var tlsVersions = map[string]uint16{
+	"TLS10": tls.VersionTLS10,
+	"TLS11": tls.VersionTLS11,
+	"TLS12": tls.VersionTLS12,
+	"TLS13": tls.VersionTLS13,
+}
+
+// TLSVersion returns the TLS version of the name, e.g. TLS12, 0 for an empty
+// name.
+func TLSVersion(name string) (uint16, error) {
+	if name == "" {
+		return 0, nil
+	}
+	v, ok := tlsVersions[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q, must be one of TLS10, TLS11, TLS12 or TLS13", name)
+	}
+	return v, nil
+}
+
+// TLSCipherSuites returns the IDs of the cipher suites by their names, e.g.
+// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256.
+func TLSCipherSuites(names []string) ([]uint16, error) {
+	var ids []uint16
+	for _, name := range names {
+		id, ok := cipherSuite(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func cipherSuite(name string) (uint16, bool) {
+	for _, suites := range [][]*tls.CipherSuite{tls.CipherSuites(), tls.InsecureCipherSuites()} {
+		for _, s := range suites {
+			if s.Name == name {
+				return s.ID, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// ModuleOptions holds collector specific settings.
+type ModuleOptions struct {
+	// AllNodes and Node select the nodes exported by the nodes collector.
+	AllNodes bool   `yaml:"all_nodes"`
+	Node     string `yaml:"node"`
+	// Aliases enables the alias metrics of the indices collector.
+	Aliases bool `yaml:"aliases"`
+	// IndicesInclude and IndicesExclude select the indices of the index-level
+	// collectors by wildcard pattern or by regular expression in slashes.
+	IndicesInclude []string `yaml:"indices_include"`
+	IndicesExclude []string `yaml:"indices_exclude"`
+	// IndexGroups sum the metrics of the indices collector by index group.
+	IndexGroups []IndexGroup `yaml:"index_groups"`
+	// IndexGroupsOnly skips the per-index metrics of the grouped indices.
+	IndexGroupsOnly bool `yaml:"index_groups_only"`
+	// IndicesSeriesLimit limits the series of the indices collector, keeping
+	// the indices with the highest value of IndicesSeriesLimitBy.
+	IndicesSeriesLimit   int    `yaml:"indices_series_limit"`
+	IndicesSeriesLimitBy string `yaml:"indices_series_limit_by"`
+}
+
+// Values the indices are ranked by when the series limit is exceeded.
+const (
+	SeriesLimitByStoreSize = "store_size"
+	SeriesLimitByDocs      = "docs"
+	SeriesLimitByIndexing  = "indexing"
+	SeriesLimitBySearch    = "search"
+)
+
+// IndexGroup assigns the indices whose name matches Regex to the group named
+// by expanding Group with the submatches of Regex, e.g. "logs-$1".
+type IndexGroup struct {
+	Regex string `yaml:"regex"`
+	Group string `yaml:"group"`
+}
+
+// DefaultIndexGroup is the group of an IndexGroup without Group, the first
+// submatch of its Regex.
+const DefaultIndexGroup = "$1"
+
+// IndexPatternRegexp returns the regular expression of an index pattern
+// enclosed in slashes, e.g. "/logs-\d+/", and false for a wildcard pattern.
+func IndexPatternRegexp(pattern string) (string, bool) {
+	if len(pattern) < 2 || !strings.HasPrefix(pattern, "/") || !strings.HasSuffix(pattern, "/") {
+		return "", false
+	}
+	return pattern[1 : len(pattern)-1], true
+}
+
+// UnmarshalYAML sets the defaults of a module before decoding it.
+func (m *Module) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*m = DefaultModule
+	type plain Module
+	return unmarshal((*plain)(m))
+}
+
+// Enabled reports whether the named collector is enabled for the module.
+func (m *Module) Enabled(collector string) bool {
+	for _, c := range m.Collectors {
+		if c == collector {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the module for errors.
+func (m *Module) Validate() error {
+	// a zero timeout disables the client timeout
+	if m.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative, got %s", m.Timeout)
+	}
+	if m.CacheTTL < 0 {
+		return fmt.Errorf("cache_ttl must not be negative, got %s", m.CacheTTL)
+	}
+	for _, secret := range []struct{ name, value, file string }{
+		{"password", m.Auth.Password, m.Auth.PasswordFile},
+		{"api_key", m.Auth.APIKey, m.Auth.APIKeyFile},
+		{"bearer_token", m.Auth.BearerToken, m.Auth.BearerTokenFile},
+	} {
+		if secret.value != "" && secret.file != "" {
+			return fmt.Errorf("%s and %s_file are mutually exclusive", secret.name, secret.name)
+		}
+	}
+	if m.Auth.PasswordFile != "" && m.Auth.Username == "" {
+		return fmt.Errorf("password_file requires a username")
+	}
+	// a username without a password is not sent, e.g. ES_USERNAME along with
+	// an API key
+	basic := (m.Auth.Username != "" && m.Auth.Password != "") || m.Auth.PasswordFile != ""
+	apiKey := m.Auth.APIKey != "" || m.Auth.APIKeyFile != ""
+	bearer := m.Auth.BearerToken != "" || m.Auth.BearerTokenFile != ""
+	if apiKey && basic {
+		return fmt.Errorf("api_key and username/password are mutually exclusive")
+	}
+	if bearer && (basic || apiKey) {
+		return fmt.Errorf("bearer_token and username/password or api_key are mutually exclusive")
+	}
+	if o := m.Auth.OAuth2; o != nil {
+		if basic || apiKey || bearer {
+			return fmt.Errorf("oauth2 and username/password, api_key or bearer_token are mutually exclusive")
+		}
+		if o.TokenURL == "" || o.ClientID == "" {
+			return fmt.Errorf("oauth2 requires token_url and client_id")
+		}
+		if _, err := url.Parse(o.TokenURL); err != nil {
+			return fmt.Errorf("invalid oauth2 token_url: %w", err)
+		}
+		if o.ClientSecret != "" && o.ClientSecretFile != "" {
+			return fmt.Errorf("oauth2 client_secret and client_secret_file are mutually exclusive")
+		}
+		if o.SharedSecret != "" && o.SharedSecretFile != "" {
+			return fmt.Errorf("oauth2 shared_secret and shared_secret_file are mutually exclusive")
+		}
+	}
+	if m.AWSService != "" && m.AWSService != "es" && m.AWSService != "aoss" {
+		return fmt.Errorf("invalid aws_service %q, must be es or aoss", m.AWSService)
+	}
+	if m.AWSWebIdentityTokenFile != "" && m.AWSRoleARN == "" {
+		return fmt.Errorf("aws_web_identity_token_file requires aws_role_arn")
+	}
+	if m.AWSRoleARN != "" && m.AWSRegion == "" {
+		return fmt.Errorf("aws_role_arn requires aws_region")
+	}
+	minVersion, err := TLSVersion(m.TLS.MinVersion)
+	if err != nil {
+		return err
+	}
+	maxVersion, err := TLSVersion(m.TLS.MaxVersion)
+	if err != nil {
+		return err
+	}
+	if minVersion != 0 && maxVersion != 0 && minVersion > maxVersion {
+		return fmt.Errorf("TLS min_version %s is greater than max_version %s", m.TLS.MinVersion, m.TLS.MaxVersion)
+	}
+	if _, err := TLSCipherSuites(m.TLS.CipherSuites); err != nil {
+		return err
+	}
+	if (m.TLS.CertFile == "") != (m.TLS.KeyFile == "") {
+		return fmt.Errorf("cert_file and key_file must be set together")
+	}
+	files := []string{m.TLS.CAFile, m.TLS.CertFile, m.TLS.KeyFile, m.Auth.PasswordFile, m.Auth.APIKeyFile, m.Auth.BearerTokenFile, m.AWSWebIdentityTokenFile}
+	if m.Auth.OAuth2 != nil {
+		files = append(files, m.Auth.OAuth2.ClientSecretFile, m.Auth.OAuth2.SharedSecretFile)
+	}
+	for _, f := range files {
+		if f == "" {
+			continue
+		}
+		if _, err := os.Stat(f); err != nil {
+			return err
+		}
+	}
+	for _, c := range m.Collectors {
+		if !knownCollectors[c] {
+			return fmt.Errorf("unknown collector %q", c)
+		}
+	}
+	for _, p := range append(append([]string{}, m.Options.IndicesInclude...), m.Options.IndicesExclude...) {
+		expr, ok := IndexPatternRegexp(p)
+		if !ok {
+			if p == "" || strings.ContainsAny(p, ", ") {
+				return fmt.Errorf("invalid index pattern %q", p)
+			}
+			continue
+		}
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("invalid index pattern %q: %w", p, err)
+		}
+	}
+	if m.Options.IndicesSeriesLimit < 0 {
+		return fmt.Errorf("indices_series_limit must not be negative, got %d", m.Options.IndicesSeriesLimit)
+	}
+	switch m.Options.IndicesSeriesLimitBy {
+	case "", SeriesLimitByStoreSize, SeriesLimitByDocs, SeriesLimitByIndexing, SeriesLimitBySearch:
+	default:
+		return fmt.Errorf("invalid indices_series_limit_by %q", m.Options.IndicesSeriesLimitBy)
+	}
+	for _, g := range m.Options.IndexGroups {
+		re, err := regexp.Compile(g.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid index group regex %q: %w", g.Regex, err)
+		}
+		if g.Group == "" && re.NumSubexp() == 0 {
+			return fmt.Errorf("index group regex %q needs a group or a capture group", g.Regex)
+		}
+	}
+	return nil
+}
+
+// Module returns the named module. The default module is always available.
+func (c *Config) Module(name string) (*Module, bool) {
+	if c != nil {
+		if m, ok := c.Modules[name]; ok {
+			return m, true
+		}
+	}
+	if name == DefaultModuleName {
+		m := DefaultModule
+		return &m, true
+	}
+	return nil, false
+}
+
+// Load reads and validates the configuration file at path.
+func Load(path string) (*Config, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if cfg.Elasticsearch != nil {
+		if err := cfg.Elasticsearch.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid elasticsearch section: %w", err)
+		}
+	}
+	for name, m := range cfg.Modules {
+		if m == nil {
+			return nil, fmt.Errorf("module %q is empty", name)
+		}
+		if err := m.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid module %q: %w", name, err)
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,197 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := ioutil.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write config: %s", err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeConfig(t, `
+modules:
+  prod:
+    timeout: 10s
+    auth:
+      username: elastic
+      password: changeme
+    collectors: [nodes, indices]
+    options:
+      all_nodes: true
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("failed to load config: %s", err)
+	}
+	m, ok := cfg.Module("prod")
+	if !ok {
+		t.Fatal("module prod is missing")
+	}
+	if m.Timeout != 10*time.Second {
+		t.Errorf("unexpected timeout %s", m.Timeout)
+	}
+	if !m.Enabled("indices") || m.Enabled("cluster-health") {
+		t.Errorf("unexpected collectors %v", m.Collectors)
+	}
+	if !m.Options.AllNodes || m.Options.Node != "_local" || !m.Options.Aliases {
+		t.Errorf("module defaults not applied: %+v", m.Options)
+	}
+	if _, ok := cfg.Module(DefaultModuleName); !ok {
+		t.Error("default module is missing")
+	}
+	if _, ok := cfg.Module("staging"); ok {
+		t.Error("unexpected module staging")
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"unknown field":     "modules:\n  prod:\n    timeot: 10s\n",
+		"negative timeout":  "modules:\n  prod:\n    timeout: -1s\n",
+		"unknown collector": "modules:\n  prod:\n    collectors: [foo]\n",
+		"api key and user":  "modules:\n  prod:\n    auth: {username: a, password: b, api_key: c}\n",
+		"bearer and key":    "modules:\n  prod:\n    auth: {bearer_token: a, api_key_file: /tmp/key}\n",
+		"password and file": "modules:\n  prod:\n    auth: {username: a, password: b, password_file: /tmp/pw}\n",
+		"password file":     "modules:\n  prod:\n    auth: {password_file: /tmp/pw}\n",
+		"oauth2 client":     "modules:\n  prod:\n    auth: {oauth2: {token_url: 'https://idp/token'}}\n",
+		"oauth2 and key":    "modules:\n  prod:\n    auth: {api_key: a, oauth2: {token_url: 'https://idp/token', client_id: b}}\n",
+		"cert without key":  "modules:\n  prod:\n    tls: {cert_file: /tmp/cert.pem}\n",
+		"tls version":       "modules:\n  prod:\n    tls: {min_version: TLS13, max_version: TLS12}\n",
+		"tls cipher suite":  "modules:\n  prod:\n    tls: {cipher_suites: [TLS_RSA_WITH_NULL]}\n",
+		"aws service":       "modules:\n  prod:\n    aws_service: s3\n",
+		"aws role region":   "modules:\n  prod:\n    aws_role_arn: arn:aws:iam::123456789012:role/exporter\n",
+		"index regexp":      "modules:\n  prod:\n    options: {indices_include: ['/logs-(/']}\n",
+		"index pattern":     "modules:\n  prod:\n    options: {indices_exclude: ['a,b']}\n",
+		"index group":       "modules:\n  prod:\n    options: {index_groups: [{regex: 'logs-.*'}]}\n",
+		"series limit by":   "modules:\n  prod:\n    options: {indices_series_limit: 100, indices_series_limit_by: name}\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Load(writeConfig(t, content)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestModuleValidate(t *testing.T) {
+	for name, m := range map[string]Module{
+		// no client timeout
+		"zero timeout": {},
+		// the username is not sent without a password
+		"api key and username": {Auth: Auth{Username: "a", APIKey: "b"}},
+		"bearer and username":  {Auth: Auth{Username: "a", BearerToken: "b"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := m.Validate(); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestLoadElasticsearch(t *testing.T) {
+	path := writeConfig(t, `
+elasticsearch:
+  uri: https://es-1:9200
+  auth:
+    api_key: secret
+  collectors: [cluster-health, snapshots]
+  refresh_intervals:
+    snapshots: 10m
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("failed to load config: %s", err)
+	}
+	es := cfg.Elasticsearch
+	if es.URI != "https://es-1:9200" || es.Module.Auth.APIKey != "secret" {
+		t.Errorf("unexpected elasticsearch section %+v", es)
+	}
+	if es.ClusterInfoInterval != 5*time.Minute || es.SniffInterval != 5*time.Minute || es.Module.Timeout != 5*time.Second {
+		t.Errorf("defaults not applied: %+v", es)
+	}
+	if !es.Module.Enabled("snapshots") || es.Module.Enabled("nodes") {
+		t.Errorf("unexpected collectors %v", es.Module.Collectors)
+	}
+	if es.RefreshIntervals["snapshots"] != 10*time.Minute {
+		t.Errorf("unexpected refresh intervals %v", es.RefreshIntervals)
+	}
+
+	if _, err := Load(writeConfig(t, "elasticsearch:\n  uri: es-1:9200\n")); err == nil {
+		t.Error("expected an error for an uri without scheme")
+	}
+	if _, err := Load(writeConfig(t, "elasticsearch:\n  refresh_intervals: {foo: 1m}\n")); err == nil {
+		t.Error("expected an error for a refresh interval of an unknown collector")
+	}
+	if _, err := Load(writeConfig(t, "elasticsearch:\n  sniff: true\n  resolve_dns: true\n")); err == nil {
+		t.Error("expected an error for sniffing with DNS resolution")
+	}
+
+	cfg, err = Load(writeConfig(t, "elasticsearch:\n  cloud_id: 'prod:ZWFzdHVzMi5henVyZS5lbGFzdGljLWNsb3VkLmNvbSRhYmM6OTQ0MyRkZWY='\n"))
+	if err != nil {
+		t.Fatalf("failed to load config: %s", err)
+	}
+	if uri := cfg.Elasticsearch.URI; uri != "https://abc.eastus2.azure.elastic-cloud.com:9443" {
+		t.Errorf("unexpected uri %q for the cloud ID", uri)
+	}
+	if _, err := Load(writeConfig(t, "elasticsearch:\n  uri: https://es-1:9200\n  cloud_id: 'prod:ZWFzdHVzMi5henVyZS5lbGFzdGljLWNsb3VkLmNvbSRhYmM6OTQ0MyRkZWY='\n")); err == nil {
+		t.Error("expected an error for a cloud ID with an uri")
+	}
+	cfg, err = Load(writeConfig(t, "elasticsearch:\n  timeout: 10s\n"))
+	if err != nil {
+		t.Fatalf("failed to load config: %s", err)
+	}
+	if cfg.Elasticsearch.URI != DefaultURI {
+		t.Errorf("expected the default uri, got %q", cfg.Elasticsearch.URI)
+	}
+}
+
+func TestCloudIDURL(t *testing.T) {
+	for _, tc := range []struct {
+		cloudID  string
+		expected string
+	}{
+		{"prod:dXMtZWFzdC0xLmF3cy5mb3VuZC5pbyRjZWM2ZjI2MWE3NGJmMjRjZTMzYmI4ODExYjg0Mjk0ZiRjNmYyNmY4YWE1YjQ4NzE=", "https://cec6f261a74bf24ce33bb8811b84294f.us-east-1.aws.found.io:443"},
+		// the port of the host applies to all components
+		{"prod:dXMtZWFzdC0xLmF3cy5mb3VuZC5pbzo5MjQzJGNlYzZmMjYxYTc0YmYyNGNlMzNiYjg4MTFiODQyOTRmJA==", "https://cec6f261a74bf24ce33bb8811b84294f.us-east-1.aws.found.io:9243"},
+		// the port of the Elasticsearch ID only to Elasticsearch
+		{"ZWFzdHVzMi5henVyZS5lbGFzdGljLWNsb3VkLmNvbSRhYmM6OTQ0MyRkZWY=", "https://abc.eastus2.azure.elastic-cloud.com:9443"},
+		{"prod:dXMtZWFzdC0xLmF3cy5mb3VuZC5pbw==", ""},
+		{"prod:not base64", ""},
+	} {
+		uri, err := CloudIDURL(tc.cloudID)
+		if tc.expected == "" {
+			if err == nil {
+				t.Errorf("expected an error for %q, got %q", tc.cloudID, uri)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("failed to decode %q: %s", tc.cloudID, err)
+		} else if uri != tc.expected {
+			t.Errorf("expected %q for %q, got %q", tc.expected, tc.cloudID, uri)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package esclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// ErrUnauthorized matches, using errors.Is, a StatusError for a response with
+// status 401 or 403.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// StatusError is returned for a response with a status other than 200 OK.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	// Type and Reason are taken from the Elasticsearch error body, if any.
+	Type   string
+	Reason string
+}
+
+func (e *StatusError) Error() string {
+	if e.Type == "" && e.Reason == "" {
+		return fmt.Sprintf("HTTP Request to %s failed with code %d", e.URL, e.StatusCode)
+	}
+	return fmt.Sprintf("HTTP Request to %s failed with code %d: %s: %s", e.URL, e.StatusCode, e.Type, e.Reason)
+}
+
+// Is reports whether the error matches ErrUnauthorized.
+func (e *StatusError) Is(target error) bool {
+	return target == ErrUnauthorized &&
+		(e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden)
+}
+
+// DecodeError is returned when the response body can not be decoded.
+type DecodeError struct {
+	URL string
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode response from %s: %s", e.URL, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// TimeoutError is returned when a request did not complete in time, either
+// because its context expired or the HTTP client timed out.
+type TimeoutError struct {
+	URL string
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("request to %s timed out: %s", e.URL, e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout implements the net.Error timeout check.
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// errorResponse is the body of an Elasticsearch error response. Very old
+// versions return the error as a plain string.
+type errorResponse struct {
+	Error json.RawMessage `json:"error"`
+}
+
+type errorCause struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// newStatusError creates a StatusError from the response status and body.
+func newStatusError(u string, statusCode int, body []byte) *StatusError {
+	e := &StatusError{URL: u, StatusCode: statusCode}
+
+	var res errorResponse
+	if err := json.Unmarshal(body, &res); err != nil || len(res.Error) == 0 {
+		return e
+	}
+	var cause errorCause
+	if err := json.Unmarshal(res.Error, &cause); err == nil {
+		e.Type, e.Reason = cause.Type, cause.Reason
+		return e
+	}
+	_ = json.Unmarshal(res.Error, &e.Reason)
+	return e
+}
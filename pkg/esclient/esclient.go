@@ -0,0 +1,123 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package esclient implements the requests to the Elasticsearch API shared by
+// all collectors.
+package esclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// maxErrorBodySize limits how much of an error response is read to parse the
+// Elasticsearch error.
+const maxErrorBodySize = 64 * 1024
+
+// Client sends requests to the Elasticsearch API below a base URL.
+type Client struct {
+	logger log.Logger
+	client *http.Client
+	url    *url.URL
+}
+
+// New creates a client for the Elasticsearch API at u.
+func New(logger log.Logger, client *http.Client, u *url.URL) *Client {
+	return &Client{
+		logger: logger,
+		client: client,
+		url:    u,
+	}
+}
+
+// URL returns the URL of the API path with the query parameters. The path is
+// relative to the path of the base URL, whose query parameters are kept
+// unless overridden by params.
+func (c *Client) URL(p string, params url.Values) *url.URL {
+	u := *c.url
+	u.Path = path.Join(u.Path, p)
+	if len(params) > 0 {
+		q := u.Query()
+		for k, v := range params {
+			q[k] = v
+		}
+		u.RawQuery = q.Encode()
+	}
+	return &u
+}
+
+// Get requests the API path with the query parameters and decodes the JSON
+// response into v.
+//
+// A response with a status other than 200 OK results in a *StatusError, an
+// undecodable body in a *DecodeError and an expired context or client timeout
+// in a *TimeoutError.
+func (c *Client) Get(ctx context.Context, p string, params url.Values, v interface{}) error {
+	_, err := c.GetWithURL(ctx, p, params, v)
+	return err
+}
+
+// GetWithURL is like Get, and also returns the URL which served the request.
+// It differs from the requested one if the requests are balanced over several
+// endpoints by the transport of the HTTP client.
+func (c *Client) GetWithURL(ctx context.Context, p string, params url.Values, v interface{}) (*url.URL, error) {
+	u := c.URL(p, params)
+	// the redacted URL is used in errors to not leak credentials
+	ru := u.Redacted()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		if isTimeout(err) {
+			return nil, &TimeoutError{URL: ru, Err: err}
+		}
+		return nil, fmt.Errorf("failed to get from %s: %w", ru, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			_ = level.Warn(c.logger).Log(
+				"msg", "failed to close http.Client",
+				"err", err,
+			)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBodySize))
+		return nil, newStatusError(ru, res.StatusCode, body)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		if isTimeout(err) {
+			return nil, &TimeoutError{URL: ru, Err: err}
+		}
+		return nil, &DecodeError{URL: ru, Err: err}
+	}
+	if res.Request != nil {
+		u = res.Request.URL
+	}
+	return u, nil
+}
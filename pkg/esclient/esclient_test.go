@@ -0,0 +1,162 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package esclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+func newTestClient(t *testing.T, h http.HandlerFunc, base string) *Client {
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+	u, err := url.Parse(ts.URL + base)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	return New(log.NewNopLogger(), http.DefaultClient, u)
+}
+
+func TestGet(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"path":%q,"query":%q}`, r.URL.Path, r.URL.RawQuery)
+	}, "/prefix?pretty=false")
+
+	var res struct {
+		Path  string `json:"path"`
+		Query string `json:"query"`
+	}
+	err := c.Get(context.Background(), "/_all/_stats", url.Values{"level": {"shards"}}, &res)
+	if err != nil {
+		t.Fatalf("Failed to get: %s", err)
+	}
+	if res.Path != "/prefix/_all/_stats" {
+		t.Errorf("Wrong path, expected %q, got %q", "/prefix/_all/_stats", res.Path)
+	}
+	if res.Query != "level=shards&pretty=false" {
+		t.Errorf("Wrong query, expected %q, got %q", "level=shards&pretty=false", res.Query)
+	}
+}
+
+func TestGetErrors(t *testing.T) {
+	tcs := []struct {
+		name   string
+		status int
+		body   string
+		check  func(t *testing.T, err error)
+	}{
+		{
+			name:   "error body",
+			status: http.StatusNotFound,
+			body:   `{"error":{"root_cause":[],"type":"index_not_found_exception","reason":"no such index [foo]"},"status":404}`,
+			check: func(t *testing.T, err error) {
+				var se *StatusError
+				if !errors.As(err, &se) {
+					t.Fatalf("expected StatusError, got %T", err)
+				}
+				if se.StatusCode != http.StatusNotFound || se.Type != "index_not_found_exception" || se.Reason != "no such index [foo]" {
+					t.Errorf("Wrong status error: %+v", se)
+				}
+				if errors.Is(err, ErrUnauthorized) {
+					t.Errorf("404 must not match ErrUnauthorized")
+				}
+			},
+		},
+		{
+			name:   "legacy error body",
+			status: http.StatusBadRequest,
+			body:   `{"error":"ElasticsearchIllegalArgumentException[bad]","status":400}`,
+			check: func(t *testing.T, err error) {
+				var se *StatusError
+				if !errors.As(err, &se) {
+					t.Fatalf("expected StatusError, got %T", err)
+				}
+				if se.Reason != "ElasticsearchIllegalArgumentException[bad]" {
+					t.Errorf("Wrong reason %q", se.Reason)
+				}
+			},
+		},
+		{
+			name:   "unauthorized",
+			status: http.StatusUnauthorized,
+			body:   `{"error":{"type":"security_exception","reason":"missing authentication credentials"},"status":401}`,
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, ErrUnauthorized) {
+					t.Errorf("expected ErrUnauthorized, got %s", err)
+				}
+			},
+		},
+		{
+			name:   "invalid json",
+			status: http.StatusOK,
+			body:   `{"cluster_name":`,
+			check: func(t *testing.T, err error) {
+				var de *DecodeError
+				if !errors.As(err, &de) {
+					t.Errorf("expected DecodeError, got %T", err)
+				}
+			},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				fmt.Fprint(w, tc.body)
+			}, "")
+			var v map[string]interface{}
+			tc.check(t, c.Get(context.Background(), "/", nil, &v))
+		})
+	}
+}
+
+func TestGetTimeout(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}, "")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var v map[string]interface{}
+	err := c.Get(ctx, "/", nil, &v)
+	var te *TimeoutError
+	if !errors.As(err, &te) {
+		t.Fatalf("expected TimeoutError, got %T: %s", err, err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected error to wrap context.DeadlineExceeded")
+	}
+}
+
+func TestGetRedactsCredentials(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}, "")
+	c.url.User = url.UserPassword("elastic", "secret")
+
+	var v map[string]interface{}
+	err := c.Get(context.Background(), "/", nil, &v)
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("expected error without password, got %v", err)
+	}
+}
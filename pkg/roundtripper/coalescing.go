@@ -0,0 +1,215 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roundtripper
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// CoalescingTransport shares the response of a GET request with all identical
+// requests made while it is in flight, e.g. by the concurrent scrapes of a
+// pair of Prometheus servers. With a TTL, successful responses are also
+// cached for that long.
+type CoalescingTransport struct {
+	t       http.RoundTripper
+	ttl     time.Duration
+	metrics *TransportMetrics
+
+	mu    sync.Mutex
+	calls map[string]*call
+	cache map[string]*sharedResponse
+}
+
+// call is a request in flight. It runs on a context detached from the
+// request which started it, so that it only fails for all waiters once none
+// of them is waiting anymore.
+type call struct {
+	done chan struct{}
+	res  *sharedResponse
+	err  error
+
+	// waiters is the number of requests waiting for the call, guarded by the
+	// mutex of the CoalescingTransport
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// detachedContext keeps the values of its parent but not its deadline and
+// cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// sharedResponse is a response whose body has been read, so that it can be
+// handed out multiple times.
+type sharedResponse struct {
+	// url is the URL which served the response
+	url        *url.URL
+	status     string
+	statusCode int
+	header     http.Header
+	body       []byte
+	expires    time.Time
+}
+
+// NewCoalescingTransport wraps transport to coalesce identical GET requests.
+// A ttl of 0 disables caching.
+func NewCoalescingTransport(transport http.RoundTripper, ttl time.Duration, metrics *TransportMetrics) *CoalescingTransport {
+	return &CoalescingTransport{
+		t:       transport,
+		ttl:     ttl,
+		metrics: metrics,
+		calls:   make(map[string]*call),
+		cache:   make(map[string]*sharedResponse),
+	}
+}
+
+func (c *CoalescingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return c.t.RoundTrip(req)
+	}
+	key := req.URL.String()
+	endpoint := Endpoint(req.URL.Path)
+
+	c.mu.Lock()
+	if r, ok := c.cache[key]; ok && time.Now().Before(r.expires) {
+		c.mu.Unlock()
+		c.metrics.cacheHits.WithLabelValues(endpoint).Inc()
+		return r.response(req), nil
+	}
+	if cl, ok := c.calls[key]; ok {
+		cl.waiters++
+		c.mu.Unlock()
+		c.metrics.coalesced.WithLabelValues(endpoint).Inc()
+		return c.wait(req, key, cl)
+	}
+	ctx, cancel := context.WithCancel(detachedContext{req.Context()})
+	cl := &call{done: make(chan struct{}), waiters: 1, cancel: cancel}
+	c.calls[key] = cl
+	c.mu.Unlock()
+	c.metrics.cacheMisses.WithLabelValues(endpoint).Inc()
+
+	go c.run(req.WithContext(ctx), key, cl)
+	return c.wait(req, key, cl)
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped transport.
+func (c *CoalescingTransport) CloseIdleConnections() {
+	closeIdleConnections(c.t)
+}
+
+// run sends the request of the call and caches its response.
+func (c *CoalescingTransport) run(req *http.Request, key string, cl *call) {
+	cl.res, cl.err = c.do(req)
+	cl.cancel()
+
+	c.mu.Lock()
+	if c.calls[key] == cl {
+		delete(c.calls, key)
+	}
+	if cl.err == nil && c.ttl > 0 && cl.res.statusCode == http.StatusOK {
+		c.purge()
+		cl.res.expires = time.Now().Add(c.ttl)
+		c.cache[key] = cl.res
+	}
+	c.mu.Unlock()
+	close(cl.done)
+}
+
+// wait waits for the response of the call until the context of req is done.
+// The call is cancelled once its last waiter has given up.
+func (c *CoalescingTransport) wait(req *http.Request, key string, cl *call) (*http.Response, error) {
+	select {
+	case <-cl.done:
+	case <-req.Context().Done():
+		c.mu.Lock()
+		cl.waiters--
+		if cl.waiters == 0 {
+			// new requests must not join the cancelled call
+			if c.calls[key] == cl {
+				delete(c.calls, key)
+			}
+			cl.cancel()
+		}
+		c.mu.Unlock()
+		return nil, req.Context().Err()
+	}
+	if cl.err != nil {
+		return nil, cl.err
+	}
+	return cl.res.response(req), nil
+}
+
+// do sends the request and reads the response body.
+func (c *CoalescingTransport) do(req *http.Request) (*sharedResponse, error) {
+	res, err := c.t.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	u := req.URL
+	if res.Request != nil {
+		u = res.Request.URL
+	}
+	return &sharedResponse{
+		url:        u,
+		status:     res.Status,
+		statusCode: res.StatusCode,
+		header:     res.Header,
+		body:       body,
+	}, nil
+}
+
+// purge removes the expired responses from the cache. It must be called with
+// c.mu held.
+func (c *CoalescingTransport) purge() {
+	now := time.Now()
+	for key, r := range c.cache {
+		if !now.Before(r.expires) {
+			delete(c.cache, key)
+		}
+	}
+}
+
+// response creates a response to req. Its request has the URL which served the
+// response, which differs from the one of req if it was balanced by a Pool.
+func (r *sharedResponse) response(req *http.Request) *http.Response {
+	served := req.Clone(req.Context())
+	served.URL = r.url
+	return &http.Response{
+		Status:        r.status,
+		StatusCode:    r.statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        r.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(r.body)),
+		ContentLength: int64(len(r.body)),
+		Request:       served,
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roundtripper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func get(t *testing.T, client *http.Client, u string) (int, string) {
+	t.Helper()
+	res, err := client.Get(u)
+	if err != nil {
+		t.Errorf("Failed to get %s: %s", u, err)
+		return 0, ""
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Errorf("Failed to read body: %s", err)
+	}
+	return res.StatusCode, string(body)
+}
+
+func TestCoalescingTransportInFlight(t *testing.T) {
+	var requests int32
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		<-release
+		fmt.Fprintf(w, `{"request":%d}`, n)
+	}))
+	defer ts.Close()
+
+	metrics := NewTransportMetrics()
+	client := &http.Client{Transport: NewCoalescingTransport(http.DefaultTransport, 0, metrics)}
+
+	const scrapes = 5
+	bodies := make([]string, scrapes)
+	var wg sync.WaitGroup
+	wg.Add(scrapes)
+	for i := 0; i < scrapes; i++ {
+		go func(i int) {
+			defer wg.Done()
+			_, bodies[i] = get(t, client, ts.URL+"/_all/_stats?level=shards")
+		}(i)
+	}
+	// wait until all requests joined the one in flight
+	for testutil.ToFloat64(metrics.coalesced.WithLabelValues("/_all/_stats")) < scrapes-1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("expected 1 request to Elasticsearch, got %d", n)
+	}
+	for _, body := range bodies {
+		if body != `{"request":1}` {
+			t.Errorf("unexpected body %q", body)
+		}
+	}
+	if misses := testutil.ToFloat64(metrics.cacheMisses.WithLabelValues("/_all/_stats")); misses != 1 {
+		t.Errorf("expected 1 miss, got %v", misses)
+	}
+	if hits := testutil.ToFloat64(metrics.cacheHits.WithLabelValues("/_all/_stats")); hits != 0 {
+		t.Errorf("expected no cache hits, got %v", hits)
+	}
+
+	// without a TTL, nothing is cached
+	if _, body := get(t, client, ts.URL+"/_all/_stats?level=shards"); body != `{"request":2}` {
+		t.Errorf("expected a new request without TTL, got %q", body)
+	}
+}
+
+func TestCoalescingTransportTTL(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		if r.URL.Path == "/_snapshot" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		fmt.Fprintf(w, `{"request":%d}`, n)
+	}))
+	defer ts.Close()
+
+	metrics := NewTransportMetrics()
+	client := &http.Client{Transport: NewCoalescingTransport(http.DefaultTransport, time.Hour, metrics)}
+
+	for i := 0; i < 3; i++ {
+		code, body := get(t, client, ts.URL+"/_cluster/health")
+		if code != http.StatusOK || body != `{"request":1}` {
+			t.Errorf("expected cached response, got %d %q", code, body)
+		}
+	}
+	if hits := testutil.ToFloat64(metrics.cacheHits.WithLabelValues("/_cluster/health")); hits != 2 {
+		t.Errorf("expected 2 hits, got %v", hits)
+	}
+
+	// errors are not cached
+	get(t, client, ts.URL+"/_snapshot")
+	code, body := get(t, client, ts.URL+"/_snapshot")
+	if code != http.StatusNotFound || body != `{"request":3}` {
+		t.Errorf("expected uncached error response, got %d %q", code, body)
+	}
+}
+
+func TestCoalescingTransportCancel(t *testing.T) {
+	release := make(chan struct{})
+	cancelled := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+			fmt.Fprint(w, `{"status":"green"}`)
+		case <-r.Context().Done():
+			close(cancelled)
+		}
+	}))
+	defer ts.Close()
+
+	metrics := NewTransportMetrics()
+	client := &http.Client{Transport: NewCoalescingTransport(http.DefaultTransport, 0, metrics)}
+	request := func(ctx context.Context) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/_cluster/health", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return client.Do(req)
+	}
+	joined := func(n float64) {
+		for testutil.ToFloat64(metrics.coalesced.WithLabelValues("/_cluster/health")) < n {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// the request which started the call gives up, the one which joined it
+	// still gets the response
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := request(leaderCtx)
+		leaderErr <- err
+	}()
+	for testutil.ToFloat64(metrics.cacheMisses.WithLabelValues("/_cluster/health")) < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	type result struct {
+		res *http.Response
+		err error
+	}
+	waiter := make(chan result, 1)
+	go func() {
+		res, err := request(context.Background())
+		waiter <- result{res, err}
+	}()
+	joined(1)
+	cancelLeader()
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the leader to be cancelled, got %v", err)
+	}
+	close(release)
+	r := <-waiter
+	if r.err != nil {
+		t.Fatalf("expected the waiter to get the response, got %s", r.err)
+	}
+	r.res.Body.Close()
+	if r.res.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status %d", r.res.StatusCode)
+	}
+
+	// the call is cancelled once all requests gave up
+	release = make(chan struct{})
+	defer close(release)
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := request(ctx)
+			errs <- err
+		}()
+	}
+	joined(2)
+	cancel()
+	for i := 0; i < 2; i++ {
+		if err := <-errs; !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the request to be cancelled, got %v", err)
+		}
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Error("the request to Elasticsearch was not cancelled")
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roundtripper
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Credentials are the credentials sent to Elasticsearch. Only one of the
+// password, the API key and the bearer token is used. The files are read again
+// when they change, e.g. when the credentials are rotated.
+type Credentials struct {
+	Username     string
+	Password     string
+	PasswordFile string
+
+	APIKey     string
+	APIKeyFile string
+
+	// BearerToken is e.g. the token of an Elasticsearch service account.
+	BearerToken     string
+	BearerTokenFile string
+}
+
+// CredentialMetrics holds the metrics of the credential files of all
+// CredentialsTransports and of the AWS credentials of all AWSSigningTransports,
+// so that they survive the recreation of HTTP clients on
+// configuration reloads.
+type CredentialMetrics struct {
+	reloadSuccess          *prometheus.GaugeVec
+	reloadSuccessTimestamp *prometheus.GaugeVec
+	awsExpiry              *prometheus.GaugeVec
+}
+
+// NewCredentialMetrics creates the metrics of the credential files.
+func NewCredentialMetrics() *CredentialMetrics {
+	return &CredentialMetrics{
+		reloadSuccess: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "credentials", "last_reload_successful"),
+				Help: "Whether the last reload of the credential file was successful.",
+			},
+			[]string{"file"},
+		),
+		reloadSuccessTimestamp: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "credentials", "last_reload_success_timestamp_seconds"),
+				Help: "Timestamp of the last successful reload of the credential file.",
+			},
+			[]string{"file"},
+		),
+		awsExpiry: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "aws", "credentials_expiry_timestamp_seconds"),
+				Help: "Timestamp when the AWS credentials used to sign the requests expire.",
+			},
+			[]string{"region", "role_arn"},
+		),
+	}
+}
+
+// Describe implements the prometheus.Collector interface.
+func (m *CredentialMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.reloadSuccess.Describe(ch)
+	m.reloadSuccessTimestamp.Describe(ch)
+	m.awsExpiry.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (m *CredentialMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.reloadSuccess.Collect(ch)
+	m.reloadSuccessTimestamp.Collect(ch)
+	m.awsExpiry.Collect(ch)
+}
+
+// credentialFile is a secret read from a file, which is read again when the
+// file has been modified or replaced.
+type credentialFile struct {
+	path    string
+	metrics *CredentialMetrics
+
+	mu    sync.Mutex
+	info  os.FileInfo
+	value string
+}
+
+// get returns the content of the file. If the file cannot be read anymore, the
+// last content is returned along with the error.
+func (f *credentialFile) get() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	info, err := os.Stat(f.path)
+	if err == nil && f.info != nil && os.SameFile(info, f.info) &&
+		info.ModTime().Equal(f.info.ModTime()) && info.Size() == f.info.Size() {
+		return f.value, nil
+	}
+	if err == nil {
+		var value string
+		value, err = f.read()
+		if err == nil {
+			f.info = info
+			f.value = value
+			f.metrics.reloadSuccess.WithLabelValues(f.path).Set(1)
+			f.metrics.reloadSuccessTimestamp.WithLabelValues(f.path).SetToCurrentTime()
+			return value, nil
+		}
+	}
+	f.metrics.reloadSuccess.WithLabelValues(f.path).Set(0)
+	return f.value, err
+}
+
+func (f *credentialFile) read() (string, error) {
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimSpace(string(b))
+	if value == "" {
+		return "", fmt.Errorf("credential file %s is empty", f.path)
+	}
+	return value, nil
+}
+
+// CredentialsTransport sets the Authorization header of the requests.
+type CredentialsTransport struct {
+	t        http.RoundTripper
+	username string
+	// scheme is the authentication scheme, either Basic, ApiKey or Bearer
+	scheme string
+	secret string
+	file   *credentialFile
+	log    log.Logger
+}
+
+// NewCredentialsTransport sends the credentials with the requests of transport.
+// The credential files are read once to check they are valid, a file which
+// changes later on but cannot be read is logged and its last content is used.
+func NewCredentialsTransport(transport http.RoundTripper, creds Credentials, metrics *CredentialMetrics, log log.Logger) (*CredentialsTransport, error) {
+	t := &CredentialsTransport{t: transport, username: creds.Username, log: log}
+	var path string
+	switch {
+	case creds.Password != "" || creds.PasswordFile != "":
+		t.scheme, t.secret, path = "Basic", creds.Password, creds.PasswordFile
+	case creds.APIKey != "" || creds.APIKeyFile != "":
+		t.scheme, t.secret, path = "ApiKey", creds.APIKey, creds.APIKeyFile
+	case creds.BearerToken != "" || creds.BearerTokenFile != "":
+		t.scheme, t.secret, path = "Bearer", creds.BearerToken, creds.BearerTokenFile
+	default:
+		return nil, fmt.Errorf("no credentials")
+	}
+	if path != "" {
+		t.file = &credentialFile{path: path, metrics: metrics}
+		if _, err := t.file.get(); err != nil {
+			return nil, fmt.Errorf("failed to read credential file: %w", err)
+		}
+	}
+	return t, nil
+}
+
+func (t *CredentialsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	secret := t.secret
+	if t.file != nil {
+		var err error
+		secret, err = t.file.get()
+		if err != nil {
+			_ = level.Warn(t.log).Log(
+				"msg", "failed to reload credential file, using the previous credentials",
+				"file", t.file.path,
+				"err", err,
+			)
+		}
+	}
+	req = req.Clone(req.Context())
+	switch t.scheme {
+	case "Basic":
+		req.SetBasicAuth(t.username, secret)
+	default:
+		req.Header.Set("Authorization", t.scheme+" "+secret)
+	}
+	return t.t.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped transport.
+func (t *CredentialsTransport) CloseIdleConnections() {
+	closeIdleConnections(t.t)
+}
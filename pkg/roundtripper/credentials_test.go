@@ -0,0 +1,106 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roundtripper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCredentialsTransport(t *testing.T) {
+	var authorization string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		// replace the file like a secret agent does
+		if err := os.WriteFile(path+".tmp", []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(path+".tmp", path); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	get := func(tr http.RoundTripper) string {
+		t.Helper()
+		res, err := (&http.Client{Transport: tr}).Get(ts.URL)
+		if err != nil {
+			t.Fatalf("request failed: %s", err)
+		}
+		res.Body.Close()
+		return authorization
+	}
+
+	for _, tc := range []struct {
+		name     string
+		creds    Credentials
+		expected string
+	}{
+		{"api key", Credentials{APIKey: "key"}, "ApiKey key"},
+		{"bearer token", Credentials{BearerToken: "token"}, "Bearer token"},
+		{"password file", Credentials{Username: "elastic", PasswordFile: write("password", "changeme\n")}, "Basic ZWxhc3RpYzpjaGFuZ2VtZQ=="},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tr, err := NewCredentialsTransport(http.DefaultTransport, tc.creds, NewCredentialMetrics(), log.NewNopLogger())
+			if err != nil {
+				t.Fatalf("failed to create transport: %s", err)
+			}
+			if auth := get(tr); auth != tc.expected {
+				t.Errorf("expected Authorization %q, got %q", tc.expected, auth)
+			}
+		})
+	}
+
+	metrics := NewCredentialMetrics()
+	path := write("token", "token-1")
+	tr, err := NewCredentialsTransport(http.DefaultTransport, Credentials{BearerTokenFile: path}, metrics, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("failed to create transport: %s", err)
+	}
+	if auth := get(tr); auth != "Bearer token-1" {
+		t.Errorf("expected the initial token, got %q", auth)
+	}
+
+	write("token", "token-2\n")
+	if auth := get(tr); auth != "Bearer token-2" {
+		t.Errorf("expected the rotated token, got %q", auth)
+	}
+	if v := testutil.ToFloat64(metrics.reloadSuccess.WithLabelValues(path)); v != 1 {
+		t.Errorf("expected a successful reload, got %v", v)
+	}
+
+	// the previous token is used until the file is valid again
+	write("token", "")
+	if auth := get(tr); auth != "Bearer token-2" {
+		t.Errorf("expected the previous token after a failed reload, got %q", auth)
+	}
+	if v := testutil.ToFloat64(metrics.reloadSuccess.WithLabelValues(path)); v != 0 {
+		t.Errorf("expected a failed reload, got %v", v)
+	}
+
+	if _, err := NewCredentialsTransport(http.DefaultTransport, Credentials{APIKeyFile: filepath.Join(dir, "missing")}, metrics, log.NewNopLogger()); err == nil {
+		t.Error("expected an error for a missing credential file")
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roundtripper
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "elasticsearch_exporter"
+
+// otherEndpoint is the endpoint label of requests which match no template.
+const otherEndpoint = "other"
+
+// endpointTemplates are the Elasticsearch API endpoints used as endpoint label.
+// A segment in braces matches any single path segment.
+var endpointTemplates = parseTemplates(
+	"/",
+	"/_alias",
+	"/{index}/_alias",
+	"/_all/_mappings",
+	"/{index}/_mappings",
+	"/_all/_settings",
+	"/{index}/_settings",
+	"/_all/_stats",
+	"/{index}/_stats",
+	"/_cat/shards",
+	"/_cat/shards/{index}",
+	"/_cluster/health",
+	"/_cluster/settings",
+	"/_data_stream/{name}/_stats",
+	"/_nodes/http",
+	"/_nodes/stats",
+	"/_nodes/{node}/stats",
+	"/_ilm/status",
+	"/{index}/_ilm/explain",
+	"/_plugins/_ism/explain",
+	"/_plugins/_sm/policies/{policy}/_explain",
+	"/_slm/stats",
+	"/_slm/status",
+	"/_snapshot",
+	"/_snapshot/{repo}/_all",
+)
+
+type endpointTemplate struct {
+	name     string
+	segments []string
+	literals int
+}
+
+func parseTemplates(templates ...string) []endpointTemplate {
+	ts := make([]endpointTemplate, 0, len(templates))
+	for _, t := range templates {
+		et := endpointTemplate{name: t, segments: splitPath(t)}
+		for _, s := range et.segments {
+			if !strings.HasPrefix(s, "{") {
+				et.literals++
+			}
+		}
+		ts = append(ts, et)
+	}
+	return ts
+}
+
+func splitPath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// Endpoint returns the template of the Elasticsearch API endpoint of the path,
+// e.g. /_snapshot/{repo}/_all for /_snapshot/backups/_all. Templates match the
+// end of the path, so that a path prefix of the Elasticsearch URL is ignored.
+// The longest matching template wins, and on a tie the one with most literal
+// segments.
+func Endpoint(p string) string {
+	segments := splitPath(p)
+	var best *endpointTemplate
+	for i := range endpointTemplates {
+		t := &endpointTemplates[i]
+		if !t.matches(segments) {
+			continue
+		}
+		if best == nil || len(t.segments) > len(best.segments) ||
+			(len(t.segments) == len(best.segments) && t.literals > best.literals) {
+			best = t
+		}
+	}
+	if best == nil {
+		return otherEndpoint
+	}
+	// the root template matches any path, which is only valid if no segment
+	// looks like an API call
+	if len(best.segments) == 0 {
+		for _, s := range segments {
+			if strings.HasPrefix(s, "_") {
+				return otherEndpoint
+			}
+		}
+	}
+	return best.name
+}
+
+func (t *endpointTemplate) matches(segments []string) bool {
+	if len(t.segments) > len(segments) {
+		return false
+	}
+	offset := len(segments) - len(t.segments)
+	for i, s := range t.segments {
+		if !strings.HasPrefix(s, "{") && s != segments[offset+i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TransportMetrics holds the metrics of all InstrumentedTransports and
+// CoalescingTransports, so that they survive the recreation of HTTP clients on
+// configuration reloads.
+type TransportMetrics struct {
+	duration     *prometheus.HistogramVec
+	responseSize *prometheus.HistogramVec
+	inFlight     *prometheus.GaugeVec
+	errors       *prometheus.CounterVec
+	coalesced    *prometheus.CounterVec
+	cacheHits    *prometheus.CounterVec
+	cacheMisses  *prometheus.CounterVec
+}
+
+// NewTransportMetrics creates the metrics for the transports.
+func NewTransportMetrics() *TransportMetrics {
+	return &TransportMetrics{
+		duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    prometheus.BuildFQName(namespace, "es", "request_duration_seconds"),
+				Help:    "Duration of requests to Elasticsearch until the response headers were received.",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"endpoint", "method", "code"},
+		),
+		responseSize: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    prometheus.BuildFQName(namespace, "es", "response_size_bytes"),
+				Help:    "Size of the response bodies read from Elasticsearch.",
+				Buckets: prometheus.ExponentialBuckets(256, 4, 10),
+			},
+			[]string{"endpoint", "method", "code"},
+		),
+		inFlight: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(namespace, "es", "requests_in_flight"),
+				Help: "Number of requests to Elasticsearch waiting for a response.",
+			},
+			[]string{"endpoint"},
+		),
+		errors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: prometheus.BuildFQName(namespace, "es", "request_errors_total"),
+				Help: "Number of requests to Elasticsearch which failed without a response.",
+			},
+			[]string{"endpoint", "method"},
+		),
+		coalesced: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: prometheus.BuildFQName(namespace, "es", "requests_coalesced_total"),
+				Help: "Number of requests to Elasticsearch which joined an identical request in flight.",
+			},
+			[]string{"endpoint"},
+		),
+		cacheHits: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: prometheus.BuildFQName(namespace, "es", "request_cache_hits_total"),
+				Help: "Number of requests to Elasticsearch served from the cache.",
+			},
+			[]string{"endpoint"},
+		),
+		cacheMisses: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: prometheus.BuildFQName(namespace, "es", "request_cache_misses_total"),
+				Help: "Number of requests to Elasticsearch which were not coalesced or cached.",
+			},
+			[]string{"endpoint"},
+		),
+	}
+}
+
+// Describe implements the prometheus.Collector interface.
+func (m *TransportMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.duration.Describe(ch)
+	m.responseSize.Describe(ch)
+	m.inFlight.Describe(ch)
+	m.errors.Describe(ch)
+	m.coalesced.Describe(ch)
+	m.cacheHits.Describe(ch)
+	m.cacheMisses.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (m *TransportMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.duration.Collect(ch)
+	m.responseSize.Collect(ch)
+	m.inFlight.Collect(ch)
+	m.errors.Collect(ch)
+	m.coalesced.Collect(ch)
+	m.cacheHits.Collect(ch)
+	m.cacheMisses.Collect(ch)
+}
+
+// InstrumentedTransport records the duration, response size and errors of the
+// requests to Elasticsearch per endpoint.
+type InstrumentedTransport struct {
+	t       http.RoundTripper
+	metrics *TransportMetrics
+}
+
+// NewInstrumentedTransport wraps transport to record its requests in metrics.
+func NewInstrumentedTransport(transport http.RoundTripper, metrics *TransportMetrics) *InstrumentedTransport {
+	return &InstrumentedTransport{
+		t:       transport,
+		metrics: metrics,
+	}
+}
+
+func (i *InstrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := Endpoint(req.URL.Path)
+	inFlight := i.metrics.inFlight.WithLabelValues(endpoint)
+	inFlight.Inc()
+	defer inFlight.Dec()
+
+	start := time.Now()
+	res, err := i.t.RoundTrip(req)
+	if err != nil {
+		i.metrics.errors.WithLabelValues(endpoint, req.Method).Inc()
+		return nil, err
+	}
+	code := strconv.Itoa(res.StatusCode)
+	i.metrics.duration.WithLabelValues(endpoint, req.Method, code).Observe(time.Since(start).Seconds())
+	res.Body = &countingBody{
+		ReadCloser: res.Body,
+		observer:   i.metrics.responseSize.WithLabelValues(endpoint, req.Method, code),
+	}
+	return res, nil
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped transport.
+func (i *InstrumentedTransport) CloseIdleConnections() {
+	closeIdleConnections(i.t)
+}
+
+// countingBody records the number of bytes read from a response body when it
+// is closed.
+type countingBody struct {
+	io.ReadCloser
+	observer prometheus.Observer
+
+	n    int64
+	once sync.Once
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	b.once.Do(func() {
+		b.observer.Observe(float64(b.n))
+	})
+	return b.ReadCloser.Close()
+}
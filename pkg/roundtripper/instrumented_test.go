@@ -0,0 +1,123 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roundtripper
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestEndpoint(t *testing.T) {
+	tcs := map[string]string{
+		"":                                "/",
+		"/":                               "/",
+		"/es":                             "/",
+		"/_cluster/health":                "/_cluster/health",
+		"/es/_cluster/health":             "/_cluster/health",
+		"/_nodes/_local/stats":            "/_nodes/{node}/stats",
+		"/_nodes/stats":                   "/_nodes/stats",
+		"/_all/_stats":                    "/_all/_stats",
+		"/logs-*/_stats":                  "/{index}/_stats",
+		"/_snapshot/backups/_all":         "/_snapshot/{repo}/_all",
+		"/es/_snapshot/backups/_all":      "/_snapshot/{repo}/_all",
+		"/_data_stream/*/_stats":          "/_data_stream/{name}/_stats",
+		"/_unknown/api":                   otherEndpoint,
+		"/es/_snapshot/backups/_all/more": otherEndpoint,
+	}
+	for p, want := range tcs {
+		if got := Endpoint(p); got != want {
+			t.Errorf("Endpoint(%q): expected %q, got %q", p, want, got)
+		}
+	}
+}
+
+func TestInstrumentedTransport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_cluster/health" {
+			fmt.Fprint(w, `{"status":"green"}`)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	metrics := NewTransportMetrics()
+	client := &http.Client{Transport: NewInstrumentedTransport(http.DefaultTransport, metrics)}
+
+	for _, p := range []string{"/_cluster/health", "/_snapshot/backups/_all"} {
+		res, err := client.Get(ts.URL + p)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %s", p, err)
+		}
+		_, _ = io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}
+	// nothing listens on the port of a closed server
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	if _, err := client.Get(closed.URL + "/_nodes/stats"); err == nil {
+		t.Fatal("expected request to closed server to fail")
+	}
+
+	if n := testutil.CollectAndCount(metrics.duration); n != 2 {
+		t.Errorf("expected 2 duration series, got %d", n)
+	}
+	expected := `
+# HELP elasticsearch_exporter_es_request_errors_total Number of requests to Elasticsearch which failed without a response.
+# TYPE elasticsearch_exporter_es_request_errors_total counter
+elasticsearch_exporter_es_request_errors_total{endpoint="/_nodes/stats",method="GET"} 1
+`
+	if err := testutil.CollectAndCompare(metrics.errors, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+	expected = `
+# HELP elasticsearch_exporter_es_response_size_bytes Size of the response bodies read from Elasticsearch.
+# TYPE elasticsearch_exporter_es_response_size_bytes histogram
+elasticsearch_exporter_es_response_size_bytes_bucket{code="200",endpoint="/_cluster/health",method="GET",le="256"} 1
+elasticsearch_exporter_es_response_size_bytes_bucket{code="200",endpoint="/_cluster/health",method="GET",le="1024"} 1
+elasticsearch_exporter_es_response_size_bytes_bucket{code="200",endpoint="/_cluster/health",method="GET",le="4096"} 1
+elasticsearch_exporter_es_response_size_bytes_bucket{code="200",endpoint="/_cluster/health",method="GET",le="16384"} 1
+elasticsearch_exporter_es_response_size_bytes_bucket{code="200",endpoint="/_cluster/health",method="GET",le="65536"} 1
+elasticsearch_exporter_es_response_size_bytes_bucket{code="200",endpoint="/_cluster/health",method="GET",le="262144"} 1
+elasticsearch_exporter_es_response_size_bytes_bucket{code="200",endpoint="/_cluster/health",method="GET",le="1.048576e+06"} 1
+elasticsearch_exporter_es_response_size_bytes_bucket{code="200",endpoint="/_cluster/health",method="GET",le="4.194304e+06"} 1
+elasticsearch_exporter_es_response_size_bytes_bucket{code="200",endpoint="/_cluster/health",method="GET",le="1.6777216e+07"} 1
+elasticsearch_exporter_es_response_size_bytes_bucket{code="200",endpoint="/_cluster/health",method="GET",le="6.7108864e+07"} 1
+elasticsearch_exporter_es_response_size_bytes_bucket{code="200",endpoint="/_cluster/health",method="GET",le="+Inf"} 1
+elasticsearch_exporter_es_response_size_bytes_sum{code="200",endpoint="/_cluster/health",method="GET"} 18
+elasticsearch_exporter_es_response_size_bytes_count{code="200",endpoint="/_cluster/health",method="GET"} 1
+elasticsearch_exporter_es_response_size_bytes_bucket{code="404",endpoint="/_snapshot/{repo}/_all",method="GET",le="256"} 1
+elasticsearch_exporter_es_response_size_bytes_bucket{code="404",endpoint="/_snapshot/{repo}/_all",method="GET",le="1024"} 1
+elasticsearch_exporter_es_response_size_bytes_bucket{code="404",endpoint="/_snapshot/{repo}/_all",method="GET",le="4096"} 1
+elasticsearch_exporter_es_response_size_bytes_bucket{code="404",endpoint="/_snapshot/{repo}/_all",method="GET",le="16384"} 1
+elasticsearch_exporter_es_response_size_bytes_bucket{code="404",endpoint="/_snapshot/{repo}/_all",method="GET",le="65536"} 1
+elasticsearch_exporter_es_response_size_bytes_bucket{code="404",endpoint="/_snapshot/{repo}/_all",method="GET",le="262144"} 1
+elasticsearch_exporter_es_response_size_bytes_bucket{code="404",endpoint="/_snapshot/{repo}/_all",method="GET",le="1.048576e+06"} 1
+elasticsearch_exporter_es_response_size_bytes_bucket{code="404",endpoint="/_snapshot/{repo}/_all",method="GET",le="4.194304e+06"} 1
+elasticsearch_exporter_es_response_size_bytes_bucket{code="404",endpoint="/_snapshot/{repo}/_all",method="GET",le="1.6777216e+07"} 1
+elasticsearch_exporter_es_response_size_bytes_bucket{code="404",endpoint="/_snapshot/{repo}/_all",method="GET",le="6.7108864e+07"} 1
+elasticsearch_exporter_es_response_size_bytes_bucket{code="404",endpoint="/_snapshot/{repo}/_all",method="GET",le="+Inf"} 1
+elasticsearch_exporter_es_response_size_bytes_sum{code="404",endpoint="/_snapshot/{repo}/_all",method="GET"} 0
+elasticsearch_exporter_es_response_size_bytes_count{code="404",endpoint="/_snapshot/{repo}/_all",method="GET"} 1
+`
+	if err := testutil.CollectAndCompare(metrics.responseSize, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
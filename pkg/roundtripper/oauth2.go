@@ -0,0 +1,192 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roundtripper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// OAuth2Config configures the client credentials grant the tokens sent to
+// Elasticsearch are requested with, e.g. for the JWT realm of Elasticsearch.
+type OAuth2Config struct {
+	TokenURL         string
+	ClientID         string
+	ClientSecret     string
+	ClientSecretFile string
+	Scopes           []string
+	EndpointParams   map[string]string
+
+	// SharedSecret is sent in the ES-Client-Authentication header, which the
+	// JWT realm may require in addition to the token.
+	SharedSecret     string
+	SharedSecretFile string
+
+	// Timeout bounds each token request, defaultTokenTimeout if zero.
+	Timeout time.Duration
+}
+
+// defaultTokenTimeout bounds the token requests without a configured timeout.
+const defaultTokenTimeout = 10 * time.Second
+
+// OAuth2Transport sends the tokens of the client credentials grant as bearer
+// tokens. The tokens are cached until they expire.
+type OAuth2Transport struct {
+	t            http.RoundTripper
+	client       *http.Client
+	tokens       oauth2.TokenSource
+	sharedSecret string
+	sharedFile   *credentialFile
+	log          log.Logger
+}
+
+// NewOAuth2Transport sends the tokens of cfg with the requests of transport.
+// The tokens are requested with client, which defaults to http.DefaultClient,
+// as the token endpoint is not Elasticsearch. The token requests are bounded by
+// cfg.Timeout.
+func NewOAuth2Transport(transport http.RoundTripper, cfg OAuth2Config, client *http.Client, metrics *CredentialMetrics, log log.Logger) (*OAuth2Transport, error) {
+	if cfg.TokenURL == "" || cfg.ClientID == "" {
+		return nil, fmt.Errorf("OAuth2 requires a token URL and a client ID")
+	}
+	src := &clientCredentialsSource{cfg: cfg, client: client, log: log}
+	if cfg.ClientSecretFile != "" {
+		src.secretFile = &credentialFile{path: cfg.ClientSecretFile, metrics: metrics}
+		if _, err := src.secretFile.get(); err != nil {
+			return nil, fmt.Errorf("failed to read OAuth2 client secret file: %w", err)
+		}
+	}
+	t := &OAuth2Transport{
+		t:            transport,
+		client:       client,
+		tokens:       oauth2.ReuseTokenSource(nil, src),
+		sharedSecret: cfg.SharedSecret,
+		log:          log,
+	}
+	if cfg.SharedSecretFile != "" {
+		t.sharedFile = &credentialFile{path: cfg.SharedSecretFile, metrics: metrics}
+		if _, err := t.sharedFile.get(); err != nil {
+			return nil, fmt.Errorf("failed to read shared secret file: %w", err)
+		}
+	}
+	return t, nil
+}
+
+func (t *OAuth2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.token(req.Context())
+	if err != nil {
+		_ = level.Error(t.log).Log("msg", "failed to get OAuth2 token", "err", err)
+		return nil, err
+	}
+	sharedSecret := t.sharedSecret
+	if t.sharedFile != nil {
+		sharedSecret, err = t.sharedFile.get()
+		if err != nil {
+			_ = level.Warn(t.log).Log(
+				"msg", "failed to reload credential file, using the previous credentials",
+				"file", t.sharedFile.path,
+				"err", err,
+			)
+		}
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	if sharedSecret != "" {
+		req.Header.Set("ES-Client-Authentication", "SharedSecret "+sharedSecret)
+	}
+	return t.t.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped transport
+// and of the client of the token endpoint.
+func (t *OAuth2Transport) CloseIdleConnections() {
+	closeIdleConnections(t.t)
+	if t.client != nil {
+		t.client.CloseIdleConnections()
+	}
+}
+
+// token returns the cached token or waits for a new one until ctx is done. The
+// token source serializes the token requests of all callers, so a caller does
+// not wait longer than its own context allows.
+func (t *OAuth2Transport) token(ctx context.Context) (*oauth2.Token, error) {
+	type result struct {
+		token *oauth2.Token
+		err   error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		token, err := t.tokens.Token()
+		ch <- result{token, err}
+	}()
+	select {
+	case r := <-ch:
+		return r.token, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// clientCredentialsSource requests a new token on each call. The client secret
+// file is read again when it changes.
+type clientCredentialsSource struct {
+	cfg        OAuth2Config
+	client     *http.Client
+	secretFile *credentialFile
+	log        log.Logger
+}
+
+func (s *clientCredentialsSource) Token() (*oauth2.Token, error) {
+	secret := s.cfg.ClientSecret
+	if s.secretFile != nil {
+		var err error
+		if secret, err = s.secretFile.get(); err != nil {
+			_ = level.Warn(s.log).Log(
+				"msg", "failed to reload credential file, using the previous credentials",
+				"file", s.secretFile.path,
+				"err", err,
+			)
+		}
+	}
+	params := url.Values{}
+	for k, v := range s.cfg.EndpointParams {
+		params.Set(k, v)
+	}
+	cc := clientcredentials.Config{
+		ClientID:       s.cfg.ClientID,
+		ClientSecret:   secret,
+		TokenURL:       s.cfg.TokenURL,
+		Scopes:         s.cfg.Scopes,
+		EndpointParams: params,
+	}
+	timeout := s.cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTokenTimeout
+	}
+	// the token is shared by all requests, so it is not bound to the context
+	// of the request which happens to request it
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if s.client != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, s.client)
+	}
+	return cc.Token(ctx)
+}
@@ -0,0 +1,147 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roundtripper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+func TestOAuth2Transport(t *testing.T) {
+	var issued int32
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "exporter" || secret != "s3cret" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("scope") != "es" {
+			http.Error(w, `{"error":"invalid_request"}`, http.StatusBadRequest)
+			return
+		}
+		n := atomic.AddInt32(&issued, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":%s}`, n, r.Form.Get("expires_in"))
+	}))
+	defer idp.Close()
+
+	var authorization, clientAuthentication string
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		clientAuthentication = r.Header.Get("ES-Client-Authentication")
+	}))
+	defer es.Close()
+
+	for _, tc := range []struct {
+		name      string
+		expiresIn string
+		expected  []string
+	}{
+		// the token is cached until it expires
+		{"cached", "3600", []string{"Bearer token-1", "Bearer token-1"}},
+		// tokens expiring within seconds are requested again
+		{"expired", "1", []string{"Bearer token-1", "Bearer token-2"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			atomic.StoreInt32(&issued, 0)
+			cfg := OAuth2Config{
+				TokenURL:       idp.URL,
+				ClientID:       "exporter",
+				ClientSecret:   "s3cret",
+				Scopes:         []string{"es"},
+				EndpointParams: map[string]string{"expires_in": tc.expiresIn},
+				SharedSecret:   "shared",
+			}
+			tr, err := NewOAuth2Transport(http.DefaultTransport, cfg, idp.Client(), NewCredentialMetrics(), log.NewNopLogger())
+			if err != nil {
+				t.Fatalf("failed to create transport: %s", err)
+			}
+			for _, expected := range tc.expected {
+				res, err := (&http.Client{Transport: tr}).Get(es.URL)
+				if err != nil {
+					t.Fatalf("request failed: %s", err)
+				}
+				res.Body.Close()
+				if authorization != expected {
+					t.Errorf("expected Authorization %q, got %q", expected, authorization)
+				}
+				if clientAuthentication != "SharedSecret shared" {
+					t.Errorf("expected the shared secret, got %q", clientAuthentication)
+				}
+			}
+		})
+	}
+
+	tr, err := NewOAuth2Transport(http.DefaultTransport, OAuth2Config{TokenURL: idp.URL, ClientID: "exporter", ClientSecret: "wrong"}, nil, NewCredentialMetrics(), log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("failed to create transport: %s", err)
+	}
+	if _, err := (&http.Client{Transport: tr}).Get(es.URL); err == nil {
+		t.Error("expected an error for invalid client credentials")
+	}
+}
+
+func TestOAuth2TransportHangingTokenEndpoint(t *testing.T) {
+	release := make(chan struct{})
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer idp.Close()
+	defer close(release)
+
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer es.Close()
+
+	for _, tc := range []struct {
+		name    string
+		timeout time.Duration
+		ctx     time.Duration
+	}{
+		// the token request is bounded by the timeout
+		{"timeout", 100 * time.Millisecond, time.Minute},
+		// the caller does not wait longer than its own context
+		{"context", time.Minute, 100 * time.Millisecond},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := OAuth2Config{TokenURL: idp.URL, ClientID: "exporter", ClientSecret: "s3cret", Timeout: tc.timeout}
+			tr, err := NewOAuth2Transport(http.DefaultTransport, cfg, idp.Client(), NewCredentialMetrics(), log.NewNopLogger())
+			if err != nil {
+				t.Fatalf("failed to create transport: %s", err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), tc.ctx)
+			defer cancel()
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, es.URL, nil)
+			if err != nil {
+				t.Fatalf("failed to create request: %s", err)
+			}
+			start := time.Now()
+			if _, err := tr.RoundTrip(req); err == nil {
+				t.Fatal("expected an error for a hanging token endpoint")
+			}
+			if d := time.Since(start); d > 5*time.Second {
+				t.Errorf("expected the request to fail within 5s, took %s", d)
+			}
+		})
+	}
+}
@@ -0,0 +1,396 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roundtripper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Load balancing strategies of a Pool.
+const (
+	// RoundRobin spreads the requests over all healthy endpoints.
+	RoundRobin = "round-robin"
+	// Failover sends the requests to the first healthy endpoint.
+	Failover = "failover"
+)
+
+// deadTimeout is how long an endpoint is skipped after a failed request,
+// unless an active health check finds it healthy again.
+const deadTimeout = 30 * time.Second
+
+var (
+	endpointHealthyDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "es", "endpoint_healthy"),
+		"Whether the Elasticsearch endpoint is considered healthy.",
+		[]string{"endpoint"}, nil,
+	)
+	endpointRequestsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "es", "endpoint_requests_total"),
+		"Number of requests sent to the Elasticsearch endpoint.",
+		[]string{"endpoint"}, nil,
+	)
+	endpointFailuresDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "es", "endpoint_failures_total"),
+		"Number of requests to the Elasticsearch endpoint which failed without a response or with status 502, 503 or 504.",
+		[]string{"endpoint"}, nil,
+	)
+)
+
+// poolEndpoint is an Elasticsearch node requests can be sent to.
+type poolEndpoint struct {
+	url *url.URL
+	// host is sent as Host header, it differs from the URL host for
+	// addresses resolved from a DNS name
+	host string
+
+	// deadUntil is the unix nano time until which the endpoint is skipped
+	deadUntil int64
+	requests  uint64
+	failures  uint64
+}
+
+func (e *poolEndpoint) healthy(now time.Time) bool {
+	return atomic.LoadInt64(&e.deadUntil) <= now.UnixNano()
+}
+
+func (e *poolEndpoint) label() string {
+	return e.url.Scheme + "://" + e.url.Host
+}
+
+// Pool balances the requests over several endpoints of an Elasticsearch
+// cluster. The scheme and host of each request are replaced by those of the
+// chosen endpoint. Endpoints which fail are skipped for a while and the
+// request is retried on the next one.
+type Pool struct {
+	t          http.RoundTripper
+	logger     log.Logger
+	strategy   string
+	resolveDNS bool
+
+	mu        sync.RWMutex
+	seeds     []*url.URL
+	endpoints []*poolEndpoint
+	// fallbacks are the endpoints of the seeds, which are tried when all
+	// endpoints set by SetEndpoints are unhealthy
+	fallbacks []*poolEndpoint
+	next      uint32
+}
+
+// NewPool creates a pool of the endpoints at urls. With resolveDNS, the host of
+// each URL is resolved to all its addresses, see Run.
+func NewPool(transport http.RoundTripper, urls []*url.URL, strategy string, resolveDNS bool, logger log.Logger) (*Pool, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("no endpoints")
+	}
+	if strategy != RoundRobin && strategy != Failover {
+		return nil, fmt.Errorf("unknown load balancing strategy %q", strategy)
+	}
+	p := &Pool{
+		t:          transport,
+		logger:     logger,
+		strategy:   strategy,
+		resolveDNS: resolveDNS,
+		seeds:      urls,
+	}
+	p.SetEndpoints(urls)
+	if resolveDNS {
+		p.resolve(context.Background())
+	} else {
+		p.fallbacks = p.endpoints
+	}
+	return p, nil
+}
+
+// SetEndpoints replaces the endpoints of the pool. The state of endpoints which
+// are kept is preserved.
+func (p *Pool) SetEndpoints(urls []*url.URL) {
+	p.setEndpoints(urls, nil)
+}
+
+func (p *Pool) setEndpoints(urls []*url.URL, hosts []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	old := make(map[string]*poolEndpoint, len(p.endpoints))
+	for _, e := range p.endpoints {
+		old[e.url.String()] = e
+	}
+	endpoints := make([]*poolEndpoint, 0, len(urls))
+	for i, u := range urls {
+		if e, ok := old[u.String()]; ok {
+			endpoints = append(endpoints, e)
+			continue
+		}
+		e := &poolEndpoint{url: u}
+		if hosts != nil {
+			e.host = hosts[i]
+		}
+		endpoints = append(endpoints, e)
+	}
+	p.endpoints = endpoints
+}
+
+// resolve replaces the endpoints by the addresses of the hosts of the seed
+// URLs. The endpoints are kept if no address could be resolved.
+func (p *Pool) resolve(ctx context.Context) {
+	var (
+		urls  []*url.URL
+		hosts []string
+	)
+	for _, seed := range p.seeds {
+		addrs, err := net.DefaultResolver.LookupHost(ctx, seed.Hostname())
+		if err != nil {
+			_ = level.Warn(p.logger).Log("msg", "failed to resolve endpoint", "host", seed.Hostname(), "err", err)
+			continue
+		}
+		for _, addr := range addrs {
+			u := *seed
+			u.Host = addr
+			if port := seed.Port(); port != "" {
+				u.Host = net.JoinHostPort(addr, port)
+			} else if ip := net.ParseIP(addr); ip != nil && ip.To4() == nil {
+				u.Host = "[" + addr + "]"
+			}
+			urls = append(urls, &u)
+			hosts = append(hosts, seed.Host)
+		}
+	}
+	if len(urls) == 0 {
+		return
+	}
+	p.setEndpoints(urls, hosts)
+}
+
+// Run checks the health of all endpoints every interval, by requesting the
+// root path, until ctx is cancelled. With DNS resolution, the hosts are
+// resolved again before each check.
+func (p *Pool) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if p.resolveDNS {
+				p.resolve(ctx)
+			}
+			p.checkHealth(ctx, interval)
+		}
+	}
+}
+
+func (p *Pool) checkHealth(ctx context.Context, timeout time.Duration) {
+	p.mu.RLock()
+	endpoints := p.endpoints
+	p.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, e := range endpoints {
+		wg.Add(1)
+		go func(e *poolEndpoint) {
+			defer wg.Done()
+			err := p.check(ctx, e, timeout)
+			if err != nil {
+				if e.healthy(time.Now()) {
+					_ = level.Warn(p.logger).Log("msg", "endpoint failed health check", "endpoint", e.label(), "err", err)
+				}
+				atomic.StoreInt64(&e.deadUntil, time.Now().Add(deadTimeout).UnixNano())
+				return
+			}
+			atomic.StoreInt64(&e.deadUntil, 0)
+		}(e)
+	}
+	wg.Wait()
+}
+
+func (p *Pool) check(ctx context.Context, e *poolEndpoint, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.url.String(), nil)
+	if err != nil {
+		return err
+	}
+	if e.host != "" {
+		req.Host = e.host
+	}
+	if e.url.User != nil {
+		password, _ := e.url.User.Password()
+		req.SetBasicAuth(e.url.User.Username(), password)
+	}
+	res, err := p.t.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+	}
+	return nil
+}
+
+// pick returns the endpoints in the order they should be tried.
+func (p *Pool) pick() []*poolEndpoint {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	now := time.Now()
+	var healthy, dead []*poolEndpoint
+	for _, e := range p.endpoints {
+		if e.healthy(now) {
+			healthy = append(healthy, e)
+		} else {
+			dead = append(dead, e)
+		}
+	}
+	endpoints := make([]*poolEndpoint, 0, len(p.endpoints))
+	if p.strategy == RoundRobin && len(healthy) > 1 {
+		n := int(atomic.AddUint32(&p.next, 1) % uint32(len(healthy)))
+		endpoints = append(endpoints, healthy[n:]...)
+		endpoints = append(endpoints, healthy[:n]...)
+	} else {
+		endpoints = append(endpoints, healthy...)
+	}
+	// the seeds replaced by SetEndpoints are tried once all endpoints failed,
+	// so that the pool recovers when e.g. all sniffed nodes have changed their
+	// addresses; healthy seeds are preferred over dead endpoints
+	var fallbacks, deadFallbacks []*poolEndpoint
+	for _, f := range p.fallbacks {
+		if contains(p.endpoints, f) {
+			continue
+		}
+		if f.healthy(now) {
+			fallbacks = append(fallbacks, f)
+		} else {
+			deadFallbacks = append(deadFallbacks, f)
+		}
+	}
+	if len(healthy) == 0 {
+		endpoints = append(endpoints, fallbacks...)
+		fallbacks = nil
+	}
+	// dead endpoints are the last resort
+	endpoints = append(endpoints, dead...)
+	endpoints = append(endpoints, fallbacks...)
+	return append(endpoints, deadFallbacks...)
+}
+
+func contains(endpoints []*poolEndpoint, e *poolEndpoint) bool {
+	for _, x := range endpoints {
+		if x == e {
+			return true
+		}
+	}
+	return false
+}
+
+// unavailable reports whether the status code means that the node cannot serve
+// requests, e.g. when it is behind a proxy.
+func unavailable(statusCode int) bool {
+	switch statusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func (p *Pool) RoundTrip(req *http.Request) (*http.Response, error) {
+	var (
+		lastRes *http.Response
+		lastErr error
+	)
+	for _, e := range p.pick() {
+		r := req.Clone(req.Context())
+		r.URL.Scheme = e.url.Scheme
+		r.URL.Host = e.url.Host
+		r.Host = e.host
+		if e.url.User != nil {
+			r.URL.User = e.url.User
+		}
+
+		atomic.AddUint64(&e.requests, 1)
+		res, err := p.t.RoundTrip(r)
+		if err == nil && !unavailable(res.StatusCode) {
+			if lastRes != nil {
+				lastRes.Body.Close()
+			}
+			return res, nil
+		}
+		// the request was cancelled, the endpoint is not to blame
+		if err != nil && req.Context().Err() != nil {
+			if lastRes != nil {
+				lastRes.Body.Close()
+			}
+			return nil, err
+		}
+		if lastRes != nil {
+			lastRes.Body.Close()
+		}
+		// the response of the last endpoint tried is returned if all fail
+		lastRes, lastErr = res, err
+		if err == nil {
+			err = fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+		}
+		atomic.AddUint64(&e.failures, 1)
+		atomic.StoreInt64(&e.deadUntil, time.Now().Add(deadTimeout).UnixNano())
+		_ = level.Warn(p.logger).Log("msg", "request to endpoint failed", "endpoint", e.label(), "err", err)
+		// requests with a body can not be replayed
+		if req.Body != nil && req.Body != http.NoBody {
+			break
+		}
+	}
+	if lastRes != nil {
+		return lastRes, nil
+	}
+	return nil, lastErr
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped transport.
+func (p *Pool) CloseIdleConnections() {
+	closeIdleConnections(p.t)
+}
+
+// Describe implements the prometheus.Collector interface.
+func (p *Pool) Describe(ch chan<- *prometheus.Desc) {
+	ch <- endpointHealthyDesc
+	ch <- endpointRequestsDesc
+	ch <- endpointFailuresDesc
+}
+
+// Collect implements the prometheus.Collector interface.
+func (p *Pool) Collect(ch chan<- prometheus.Metric) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	now := time.Now()
+	for _, e := range p.endpoints {
+		var healthy float64
+		if e.healthy(now) {
+			healthy = 1
+		}
+		ch <- prometheus.MustNewConstMetric(endpointHealthyDesc, prometheus.GaugeValue, healthy, e.label())
+		ch <- prometheus.MustNewConstMetric(endpointRequestsDesc, prometheus.CounterValue, float64(atomic.LoadUint64(&e.requests)), e.label())
+		ch <- prometheus.MustNewConstMetric(endpointFailuresDesc, prometheus.CounterValue, float64(atomic.LoadUint64(&e.failures)), e.label())
+	}
+}
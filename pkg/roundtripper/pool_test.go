@@ -0,0 +1,225 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roundtripper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newNamedServer(name string, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		fmt.Fprint(w, name)
+	}))
+}
+
+func mustParseURLs(t *testing.T, rawURLs ...string) []*url.URL {
+	t.Helper()
+	urls := make([]*url.URL, 0, len(rawURLs))
+	for _, raw := range rawURLs {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatalf("Failed to parse URL %s: %s", raw, err)
+		}
+		urls = append(urls, u)
+	}
+	return urls
+}
+
+func TestPoolFailover(t *testing.T) {
+	var requests int32
+	ts := newNamedServer("up", &requests)
+	defer ts.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	downURL := down.URL
+	down.Close()
+
+	pool, err := NewPool(http.DefaultTransport, mustParseURLs(t, downURL, ts.URL), Failover, false, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Failed to create pool: %s", err)
+	}
+	client := &http.Client{Transport: pool}
+
+	for i := 0; i < 3; i++ {
+		res, err := client.Get(downURL + "/_cluster/health")
+		if err != nil {
+			t.Fatalf("Failed to get: %s", err)
+		}
+		res.Body.Close()
+		if got := res.Request.URL.Host; got != strings.TrimPrefix(ts.URL, "http://") {
+			t.Errorf("expected request to be served by %s, got %s", ts.URL, got)
+		}
+	}
+	if requests != 3 {
+		t.Errorf("expected 3 requests to the healthy endpoint, got %d", requests)
+	}
+
+	expected := fmt.Sprintf(`
+# HELP elasticsearch_exporter_es_endpoint_failures_total Number of requests to the Elasticsearch endpoint which failed without a response or with status 502, 503 or 504.
+# TYPE elasticsearch_exporter_es_endpoint_failures_total counter
+elasticsearch_exporter_es_endpoint_failures_total{endpoint="%[1]s"} 1
+elasticsearch_exporter_es_endpoint_failures_total{endpoint="%[2]s"} 0
+# HELP elasticsearch_exporter_es_endpoint_healthy Whether the Elasticsearch endpoint is considered healthy.
+# TYPE elasticsearch_exporter_es_endpoint_healthy gauge
+elasticsearch_exporter_es_endpoint_healthy{endpoint="%[1]s"} 0
+elasticsearch_exporter_es_endpoint_healthy{endpoint="%[2]s"} 1
+# HELP elasticsearch_exporter_es_endpoint_requests_total Number of requests sent to the Elasticsearch endpoint.
+# TYPE elasticsearch_exporter_es_endpoint_requests_total counter
+elasticsearch_exporter_es_endpoint_requests_total{endpoint="%[1]s"} 1
+elasticsearch_exporter_es_endpoint_requests_total{endpoint="%[2]s"} 3
+`, downURL, ts.URL)
+	if err := testutil.CollectAndCompare(pool, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPoolUnavailableStatus(t *testing.T) {
+	var requests, unavailableRequests int32
+	ts := newNamedServer("up", &requests)
+	defer ts.Close()
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&unavailableRequests, 1)
+		http.Error(w, "no healthy upstream", http.StatusServiceUnavailable)
+	}))
+	defer proxy.Close()
+
+	pool, err := NewPool(http.DefaultTransport, mustParseURLs(t, proxy.URL, ts.URL), Failover, false, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Failed to create pool: %s", err)
+	}
+	client := &http.Client{Transport: pool}
+	for i := 0; i < 3; i++ {
+		if code, body := get(t, client, proxy.URL+"/_cluster/health"); code != http.StatusOK || body != "up" {
+			t.Errorf("expected the healthy endpoint to serve the request, got %d %q", code, body)
+		}
+	}
+	if unavailableRequests != 1 || requests != 3 {
+		t.Errorf("expected the unavailable endpoint to be skipped, got %d and %d requests", unavailableRequests, requests)
+	}
+
+	// without another endpoint, the response is returned
+	pool, err = NewPool(http.DefaultTransport, mustParseURLs(t, proxy.URL), Failover, false, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Failed to create pool: %s", err)
+	}
+	client = &http.Client{Transport: pool}
+	if code, _ := get(t, client, proxy.URL+"/_cluster/health"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected the unavailable response, got %d", code)
+	}
+}
+
+func TestPoolRoundRobin(t *testing.T) {
+	var first, second int32
+	ts1 := newNamedServer("first", &first)
+	defer ts1.Close()
+	ts2 := newNamedServer("second", &second)
+	defer ts2.Close()
+
+	pool, err := NewPool(http.DefaultTransport, mustParseURLs(t, ts1.URL, ts2.URL), RoundRobin, false, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Failed to create pool: %s", err)
+	}
+	client := &http.Client{Transport: pool}
+
+	for i := 0; i < 10; i++ {
+		get(t, client, ts1.URL+"/_nodes/stats")
+	}
+	if first != 5 || second != 5 {
+		t.Errorf("expected requests to be spread evenly, got %d and %d", first, second)
+	}
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+	var healthy int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	pool, err := NewPool(http.DefaultTransport, mustParseURLs(t, ts.URL), Failover, false, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Failed to create pool: %s", err)
+	}
+	e := pool.endpoints[0]
+
+	pool.checkHealth(context.Background(), time.Second)
+	if e.healthy(time.Now()) {
+		t.Error("expected endpoint to be unhealthy after failed health check")
+	}
+
+	atomic.StoreInt32(&healthy, 1)
+	pool.checkHealth(context.Background(), time.Second)
+	if !e.healthy(time.Now()) {
+		t.Error("expected endpoint to recover after successful health check")
+	}
+}
+
+func TestPoolSetEndpoints(t *testing.T) {
+	pool, err := NewPool(http.DefaultTransport, mustParseURLs(t, "http://a:9200", "http://b:9200"), Failover, false, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Failed to create pool: %s", err)
+	}
+	kept := pool.endpoints[1]
+	atomic.StoreUint64(&kept.requests, 7)
+
+	pool.SetEndpoints(mustParseURLs(t, "http://b:9200", "http://c:9200"))
+	if len(pool.endpoints) != 2 {
+		t.Fatalf("expected 2 endpoints, got %d", len(pool.endpoints))
+	}
+	if pool.endpoints[0] != kept {
+		t.Error("expected the state of a kept endpoint to be preserved")
+	}
+	if got := pool.endpoints[1].label(); got != "http://c:9200" {
+		t.Errorf("expected new endpoint http://c:9200, got %s", got)
+	}
+}
+
+func TestPoolFallback(t *testing.T) {
+	var requests int32
+	seed := newNamedServer("seed", &requests)
+	defer seed.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	downURL := down.URL
+	down.Close()
+
+	pool, err := NewPool(http.DefaultTransport, mustParseURLs(t, seed.URL), Failover, false, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Failed to create pool: %s", err)
+	}
+	// e.g. sniffed nodes which have changed their addresses since
+	pool.SetEndpoints(mustParseURLs(t, downURL))
+	client := &http.Client{Transport: pool}
+
+	for i := 0; i < 2; i++ {
+		if _, body := get(t, client, downURL+"/_nodes/http"); body != "seed" {
+			t.Errorf("expected the seed to serve the request, got %q", body)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 requests to the seed, got %d", requests)
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -26,51 +27,159 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 )
 
+// AWS services requests can be signed for.
 const (
-	service = "es"
+	// AWSServiceES is Amazon OpenSearch Service, formerly Amazon Elasticsearch Service.
+	AWSServiceES = "es"
+	// AWSServiceServerless is Amazon OpenSearch Serverless.
+	AWSServiceServerless = "aoss"
 )
 
+// awsCredentialsExpiryWindow is how long before their expiry the AWS
+// credentials are refreshed, so that no request is signed with credentials
+// which expire in flight.
+const awsCredentialsExpiryWindow = 5 * time.Minute
+
+// awsSessionName is the session name of assumed roles.
+const awsSessionName = "elasticsearch_exporter"
+
+// closeIdleConnections closes the idle connections of the transport if it
+// supports it, like http.Client.CloseIdleConnections does.
+func closeIdleConnections(t http.RoundTripper) {
+	type closeIdler interface {
+		CloseIdleConnections()
+	}
+	if c, ok := t.(closeIdler); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// AWSConfig configures the signing of the requests for AWS.
+type AWSConfig struct {
+	Region string
+	// Service defaults to AWSServiceES.
+	Service string
+	// RoleARN is the role to assume, with the default credentials or, if
+	// WebIdentityTokenFile is set, with the web identity token in the file.
+	RoleARN              string
+	WebIdentityTokenFile string
+}
+
 type AWSSigningTransport struct {
-	t      http.RoundTripper
-	creds  aws.Credentials
-	region string
-	log    log.Logger
+	t       http.RoundTripper
+	creds   aws.CredentialsProvider
+	region  string
+	service string
+	roleARN string
+	metrics *CredentialMetrics
+	log     log.Logger
 }
 
-func NewAWSSigningTransport(transport http.RoundTripper, region string, log log.Logger) (*AWSSigningTransport, error) {
-	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(region))
+// NewAWSSigningTransport signs the requests with the AWS credentials of the
+// default credential chain or of the role of cfg. The credentials are cached
+// and refreshed before they expire.
+func NewAWSSigningTransport(transport http.RoundTripper, cfg AWSConfig, metrics *CredentialMetrics, log log.Logger) (*AWSSigningTransport, error) {
+	awsCfg, err := config.LoadDefaultConfig(context.Background(),
+		config.WithRegion(cfg.Region),
+		config.WithCredentialsCacheOptions(func(o *aws.CredentialsCacheOptions) {
+			o.ExpiryWindow = awsCredentialsExpiryWindow
+		}),
+	)
 	if err != nil {
 		_ = level.Error(log).Log("msg", "fail to load aws default config", "err", err)
 		return nil, err
 	}
 
-	creds, err := cfg.Credentials.Retrieve(context.Background())
-	if err != nil {
-		_ = level.Error(log).Log("msg", "fail to retrive aws credentials", "err", err)
+	var provider aws.CredentialsProvider = awsCfg.Credentials
+	switch {
+	case cfg.RoleARN != "" && cfg.WebIdentityTokenFile != "":
+		provider = stscreds.NewWebIdentityRoleProvider(sts.NewFromConfig(awsCfg), cfg.RoleARN, stscreds.IdentityTokenFile(cfg.WebIdentityTokenFile),
+			func(o *stscreds.WebIdentityRoleOptions) {
+				o.RoleSessionName = awsSessionName
+			})
+	case cfg.RoleARN != "":
+		provider = stscreds.NewAssumeRoleProvider(sts.NewFromConfig(awsCfg), cfg.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = awsSessionName
+		})
+	case cfg.WebIdentityTokenFile != "":
+		return nil, fmt.Errorf("AWS web identity token file requires a role ARN")
+	}
+	return newAWSSigningTransport(transport, cfg, provider, metrics, log)
+}
+
+// newAWSSigningTransport signs the requests for the AWS service with the
+// credentials of provider.
+func newAWSSigningTransport(transport http.RoundTripper, cfg AWSConfig, provider aws.CredentialsProvider, metrics *CredentialMetrics, log log.Logger) (*AWSSigningTransport, error) {
+	service := cfg.Service
+	switch service {
+	case "":
+		service = AWSServiceES
+	case AWSServiceES, AWSServiceServerless:
+	default:
+		return nil, fmt.Errorf("unknown AWS service %q", service)
+	}
+	// the credentials of the default chain are cached already
+	if _, ok := provider.(*aws.CredentialsCache); !ok {
+		provider = aws.NewCredentialsCache(provider, func(o *aws.CredentialsCacheOptions) {
+			o.ExpiryWindow = awsCredentialsExpiryWindow
+		})
+	}
+
+	a := &AWSSigningTransport{
+		t:       transport,
+		creds:   provider,
+		region:  cfg.Region,
+		service: service,
+		roleARN: cfg.RoleARN,
+		metrics: metrics,
+		log:     log,
+	}
+	if _, err := a.credentials(context.Background()); err != nil {
 		return nil, err
 	}
+	return a, nil
+}
 
-	return &AWSSigningTransport{
-		t:      transport,
-		region: region,
-		creds:  creds,
-		log:    log,
-	}, err
+// credentials returns the cached credentials, which are refreshed when they
+// are about to expire.
+func (a *AWSSigningTransport) credentials(ctx context.Context) (aws.Credentials, error) {
+	creds, err := a.creds.Retrieve(ctx)
+	if err != nil {
+		_ = level.Error(a.log).Log("msg", "fail to retrieve aws credentials", "role_arn", a.roleARN, "err", err)
+		return creds, err
+	}
+	if creds.CanExpire {
+		// the cache brings the expiry forward by the expiry window
+		expires := creds.Expires.Add(awsCredentialsExpiryWindow)
+		a.metrics.awsExpiry.WithLabelValues(a.region, a.roleARN).Set(float64(expires.Unix()))
+	}
+	return creds, nil
 }
 
 func (a *AWSSigningTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	creds, err := a.credentials(req.Context())
+	if err != nil {
+		return nil, err
+	}
 	signer := v4.NewSigner()
 	payloadHash, newReader, err := hashPayload(req.Body)
 	if err != nil {
 		_ = level.Error(a.log).Log("msg", "fail to hash request body", "err", err)
 		return nil, err
 	}
+	req = req.Clone(req.Context())
 	req.Body = newReader
-	err = signer.SignHTTP(context.Background(), a.creds, req, payloadHash, service, a.region, time.Now())
+	// OpenSearch Serverless requires the payload hash to be sent
+	if a.service == AWSServiceServerless {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+	err = signer.SignHTTP(req.Context(), creds, req, payloadHash, a.service, a.region, time.Now())
 	if err != nil {
 		_ = level.Error(a.log).Log("msg", "fail to sign request body", "err", err)
 		return nil, err
@@ -78,12 +187,18 @@ func (a *AWSSigningTransport) RoundTrip(req *http.Request) (*http.Response, erro
 	return a.t.RoundTrip(req)
 }
 
+// CloseIdleConnections closes the idle connections of the wrapped transport.
+func (a *AWSSigningTransport) CloseIdleConnections() {
+	closeIdleConnections(a.t)
+}
+
 func hashPayload(r io.ReadCloser) (string, io.ReadCloser, error) {
 	var newReader io.ReadCloser
 	payload := []byte("")
 	if r != nil {
 		defer r.Close()
-		payload, err := ioutil.ReadAll(r)
+		var err error
+		payload, err = ioutil.ReadAll(r)
 		if err != nil {
 			return "", newReader, err
 		}
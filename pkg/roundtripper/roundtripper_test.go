@@ -0,0 +1,196 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roundtripper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAWSSigningTransportService(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	var req *http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+	}))
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		service     string
+		scope       string
+		contentHash bool
+	}{
+		{"", "/us-east-1/es/aws4_request", false},
+		{AWSServiceES, "/us-east-1/es/aws4_request", false},
+		{AWSServiceServerless, "/us-east-1/aoss/aws4_request", true},
+	} {
+		t.Run(tc.service, func(t *testing.T) {
+			rt, err := NewAWSSigningTransport(http.DefaultTransport, AWSConfig{Region: "us-east-1", Service: tc.service}, NewCredentialMetrics(), log.NewNopLogger())
+			if err != nil {
+				t.Fatalf("Failed to create transport: %s", err)
+			}
+			res, err := (&http.Client{Transport: rt}).Get(ts.URL + "/_cluster/health")
+			if err != nil {
+				t.Fatalf("Failed to request: %s", err)
+			}
+			res.Body.Close()
+
+			if auth := req.Header.Get("Authorization"); !strings.Contains(auth, tc.scope) {
+				t.Errorf("expected credential scope %s, got %q", tc.scope, auth)
+			}
+			if hash := req.Header.Get("X-Amz-Content-Sha256"); (hash != "") != tc.contentHash {
+				t.Errorf("unexpected X-Amz-Content-Sha256 header %q", hash)
+			}
+		})
+	}
+
+	if _, err := NewAWSSigningTransport(http.DefaultTransport, AWSConfig{Region: "us-east-1", Service: "s3"}, NewCredentialMetrics(), log.NewNopLogger()); err == nil {
+		t.Error("expected an error for an unknown service")
+	}
+}
+
+// fakeCredentialsProvider returns new credentials on each retrieval, which
+// expire after ttl.
+type fakeCredentialsProvider struct {
+	ttl        time.Duration
+	retrievals int
+	expires    time.Time
+}
+
+func (p *fakeCredentialsProvider) Retrieve(context.Context) (aws.Credentials, error) {
+	p.retrievals++
+	p.expires = time.Now().Add(p.ttl).Truncate(time.Second)
+	return aws.Credentials{
+		AccessKeyID:     fmt.Sprintf("AKID%d", p.retrievals),
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		CanExpire:       true,
+		Expires:         p.expires,
+	}, nil
+}
+
+func TestAWSSigningTransportRefresh(t *testing.T) {
+	var auth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+	}))
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		name       string
+		ttl        time.Duration
+		retrievals int
+	}{
+		{"valid", time.Hour, 1},
+		// credentials are refreshed before they expire
+		{"expiring", awsCredentialsExpiryWindow - time.Minute, 4},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			provider := &fakeCredentialsProvider{ttl: tc.ttl}
+			metrics := NewCredentialMetrics()
+			cfg := AWSConfig{Region: "us-east-1", RoleARN: "arn:aws:iam::123456789012:role/exporter"}
+			rt, err := newAWSSigningTransport(http.DefaultTransport, cfg, provider, metrics, log.NewNopLogger())
+			if err != nil {
+				t.Fatalf("Failed to create transport: %s", err)
+			}
+			for i := 0; i < 3; i++ {
+				res, err := (&http.Client{Transport: rt}).Get(ts.URL + "/_cluster/health")
+				if err != nil {
+					t.Fatalf("Failed to request: %s", err)
+				}
+				res.Body.Close()
+			}
+
+			if provider.retrievals != tc.retrievals {
+				t.Errorf("expected %d retrievals, got %d", tc.retrievals, provider.retrievals)
+			}
+			if key := fmt.Sprintf("Credential=AKID%d/", provider.retrievals); !strings.Contains(auth, key) {
+				t.Errorf("expected the request to be signed with %s, got %q", key, auth)
+			}
+			expiry := testutil.ToFloat64(metrics.awsExpiry.WithLabelValues(cfg.Region, cfg.RoleARN))
+			if expiry != float64(provider.expires.Unix()) {
+				t.Errorf("expected expiry %d, got %v", provider.expires.Unix(), expiry)
+			}
+		})
+	}
+}
+
+func TestHashPayload(t *testing.T) {
+	hash, body, err := hashPayload(io.NopCloser(strings.NewReader(`{"query":{}}`)))
+	if err != nil {
+		t.Fatalf("Failed to hash payload: %s", err)
+	}
+	expected := sha256.Sum256([]byte(`{"query":{}}`))
+	if hash != hex.EncodeToString(expected[:]) {
+		t.Errorf("expected the hash of the payload, got %s", hash)
+	}
+	if b, _ := io.ReadAll(body); string(b) != `{"query":{}}` {
+		t.Errorf("expected the payload to be readable again, got %q", b)
+	}
+}
+
+// idleTransport counts the calls of CloseIdleConnections.
+type idleTransport struct {
+	http.RoundTripper
+	closed int
+}
+
+func (t *idleTransport) CloseIdleConnections() {
+	t.closed++
+}
+
+func TestCloseIdleConnections(t *testing.T) {
+	base := &idleTransport{RoundTripper: http.DefaultTransport}
+	metrics := NewCredentialMetrics()
+	var rt http.RoundTripper = base
+	var err error
+	rt, err = NewCredentialsTransport(rt, Credentials{APIKey: "key"}, metrics, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Failed to create credentials transport: %s", err)
+	}
+	rt, err = NewOAuth2Transport(rt, OAuth2Config{TokenURL: "http://localhost", ClientID: "exporter"}, nil, metrics, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Failed to create OAuth2 transport: %s", err)
+	}
+	rt, err = newAWSSigningTransport(rt, AWSConfig{Region: "us-east-1"}, &fakeCredentialsProvider{ttl: time.Hour}, metrics, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Failed to create AWS transport: %s", err)
+	}
+	rt, err = NewPool(rt, mustParseURLs(t, "http://localhost:9200"), Failover, false, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Failed to create pool: %s", err)
+	}
+	rt = NewInstrumentedTransport(rt, NewTransportMetrics())
+	rt = NewCoalescingTransport(rt, 0, NewTransportMetrics())
+
+	(&http.Client{Transport: rt}).CloseIdleConnections()
+	if base.closed != 1 {
+		t.Errorf("expected the idle connections of the transport to be closed once, got %d", base.closed)
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roundtripper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/esclient"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CoordinatingOnly is the sniffer role of the nodes without any role.
+const CoordinatingOnly = "coordinating_only"
+
+var (
+	sniffedNodeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "es", "sniffed_node"),
+		"Node of the Elasticsearch cluster discovered by the sniffer and used as endpoint.",
+		[]string{"endpoint", "node", "name", "roles"}, nil,
+	)
+	sniffLastSuccessDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "es", "sniff_last_success_timestamp_seconds"),
+		"Timestamp of the last successful discovery of the Elasticsearch nodes.",
+		nil, nil,
+	)
+	sniffErrorsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "es", "sniff_errors_total"),
+		"Number of failed discoveries of the Elasticsearch nodes.",
+		nil, nil,
+	)
+)
+
+type nodesHTTPResponse struct {
+	Nodes map[string]struct {
+		Name  string   `json:"name"`
+		Roles []string `json:"roles"`
+		HTTP  struct {
+			PublishAddress string `json:"publish_address"`
+		} `json:"http"`
+	} `json:"nodes"`
+}
+
+// sniffedNode is a node used as endpoint of the pool.
+type sniffedNode struct {
+	id       string
+	name     string
+	roles    string
+	host     string
+	endpoint string
+}
+
+// Sniffer discovers the nodes of the cluster and makes their HTTP publish
+// addresses the endpoints of a Pool.
+type Sniffer struct {
+	client *esclient.Client
+	pool   *Pool
+	roles  []string
+	logger log.Logger
+
+	errors      uint64
+	mu          sync.RWMutex
+	nodes       []sniffedNode
+	lastSuccess time.Time
+}
+
+// NewSniffer creates a sniffer for the endpoints of pool. The nodes are
+// requested with client, which should send its requests through pool. Only
+// nodes with one of roles are used, unless roles is empty. A role prefixed
+// with "!" excludes the nodes with that role, CoordinatingOnly matches the
+// nodes without roles.
+func NewSniffer(client *esclient.Client, pool *Pool, roles []string, logger log.Logger) *Sniffer {
+	return &Sniffer{
+		client: client,
+		pool:   pool,
+		roles:  roles,
+		logger: logger,
+	}
+}
+
+// Run discovers the nodes now and then every interval until ctx is cancelled.
+func (s *Sniffer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Sniff(ctx); err != nil && ctx.Err() == nil {
+			_ = level.Warn(s.logger).Log("msg", "failed to sniff nodes", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sniff discovers the nodes and replaces the endpoints of the pool. The
+// endpoints are kept if no node matches. The seeds of the pool remain its
+// fallback, so the nodes can be discovered again when all of them failed.
+func (s *Sniffer) Sniff(ctx context.Context) error {
+	var res nodesHTTPResponse
+	if err := s.client.Get(ctx, "/_nodes/http", nil, &res); err != nil {
+		atomic.AddUint64(&s.errors, 1)
+		return err
+	}
+
+	seed := s.pool.seeds[0]
+	var nodes []sniffedNode
+	for id, n := range res.Nodes {
+		if n.HTTP.PublishAddress == "" || !s.matches(n.Roles) {
+			continue
+		}
+		host, err := publishHost(n.HTTP.PublishAddress)
+		if err != nil {
+			_ = level.Warn(s.logger).Log("msg", "invalid publish address", "node", n.Name, "err", err)
+			continue
+		}
+		nodes = append(nodes, sniffedNode{
+			id:       id,
+			name:     n.Name,
+			roles:    strings.Join(n.Roles, ","),
+			host:     host,
+			endpoint: seed.Scheme + "://" + host,
+		})
+	}
+	if len(nodes) == 0 {
+		atomic.AddUint64(&s.errors, 1)
+		return errors.New("no node with a publish address matches the roles")
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].endpoint < nodes[j].endpoint })
+
+	urls := make([]*url.URL, 0, len(nodes))
+	for _, n := range nodes {
+		u := *seed
+		u.Host = n.host
+		urls = append(urls, &u)
+	}
+	s.pool.SetEndpoints(urls)
+
+	s.mu.Lock()
+	s.nodes = nodes
+	s.lastSuccess = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+// matches reports whether a node with roles is selected.
+func (s *Sniffer) matches(roles []string) bool {
+	has := func(role string) bool {
+		if role == CoordinatingOnly {
+			return len(roles) == 0
+		}
+		for _, r := range roles {
+			if r == role {
+				return true
+			}
+		}
+		return false
+	}
+	included, includes := false, false
+	for _, role := range s.roles {
+		if strings.HasPrefix(role, "!") {
+			if has(role[1:]) {
+				return false
+			}
+			continue
+		}
+		includes = true
+		included = included || has(role)
+	}
+	return included || !includes
+}
+
+// publishHost returns the host and port of a publish address, which is either
+// ip:port or hostname/ip:port. The host name is preferred, so that the TLS
+// certificate of the node can be verified.
+func publishHost(address string) (string, error) {
+	hostname, address := "", address
+	if i := strings.Index(address, "/"); i >= 0 {
+		hostname, address = address[:i], address[i+1:]
+	}
+	ip, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse publish address %q: %w", address, err)
+	}
+	if hostname != "" {
+		return net.JoinHostPort(hostname, port), nil
+	}
+	return net.JoinHostPort(ip, port), nil
+}
+
+// Describe implements the prometheus.Collector interface.
+func (s *Sniffer) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sniffedNodeDesc
+	ch <- sniffLastSuccessDesc
+	ch <- sniffErrorsDesc
+}
+
+// Collect implements the prometheus.Collector interface.
+func (s *Sniffer) Collect(ch chan<- prometheus.Metric) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, n := range s.nodes {
+		ch <- prometheus.MustNewConstMetric(sniffedNodeDesc, prometheus.GaugeValue, 1, n.endpoint, n.id, n.name, n.roles)
+	}
+	var lastSuccess float64
+	if !s.lastSuccess.IsZero() {
+		lastSuccess = float64(s.lastSuccess.UnixNano()) / 1e9
+	}
+	ch <- prometheus.MustNewConstMetric(sniffLastSuccessDesc, prometheus.GaugeValue, lastSuccess)
+	ch <- prometheus.MustNewConstMetric(sniffErrorsDesc, prometheus.CounterValue, float64(atomic.LoadUint64(&s.errors)))
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roundtripper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/esclient"
+)
+
+func TestSnifferSniff(t *testing.T) {
+	var coordinating int32
+	node := newNamedServer("coordinating", &coordinating)
+	defer node.Close()
+	nodeHost := strings.TrimPrefix(node.URL, "http://")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_nodes/http" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"nodes": {
+			"m1": {"name": "master-1", "roles": ["master"], "http": {"publish_address": "10.0.0.1:9200"}},
+			"d1": {"name": "data-1", "roles": ["data", "ingest"], "http": {"publish_address": "es-data-1/10.0.0.2:9200"}},
+			"c1": {"name": "coordinating-1", "roles": [], "http": {"publish_address": %q}},
+			"x1": {"name": "no-http", "roles": []}
+		}}`, nodeHost)
+	}))
+	defer ts.Close()
+
+	pool, err := NewPool(http.DefaultTransport, mustParseURLs(t, ts.URL), Failover, false, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Failed to create pool: %s", err)
+	}
+	client := esclient.New(log.NewNopLogger(), &http.Client{Transport: pool}, mustParseURLs(t, ts.URL)[0])
+
+	for _, tc := range []struct {
+		roles    []string
+		expected []string
+	}{
+		{nil, []string{"http://10.0.0.1:9200", node.URL, "http://es-data-1:9200"}},
+		{[]string{"!master"}, []string{node.URL, "http://es-data-1:9200"}},
+		{[]string{"data", "master"}, []string{"http://10.0.0.1:9200", "http://es-data-1:9200"}},
+		{[]string{CoordinatingOnly}, []string{node.URL}},
+	} {
+		t.Run(strings.Join(tc.roles, ","), func(t *testing.T) {
+			pool.SetEndpoints(mustParseURLs(t, ts.URL))
+			sniffer := NewSniffer(client, pool, tc.roles, log.NewNopLogger())
+			if err := sniffer.Sniff(context.Background()); err != nil {
+				t.Fatalf("Failed to sniff: %s", err)
+			}
+			var endpoints []string
+			for _, e := range pool.endpoints {
+				endpoints = append(endpoints, e.label())
+			}
+			if strings.Join(endpoints, " ") != strings.Join(tc.expected, " ") {
+				t.Errorf("expected endpoints %v, got %v", tc.expected, endpoints)
+			}
+		})
+	}
+
+	// requests go to the sniffed node
+	if _, body := get(t, &http.Client{Transport: pool}, ts.URL+"/"); body != "coordinating" {
+		t.Errorf("expected request to be served by the sniffed node, got %q", body)
+	}
+
+	// the endpoints are kept if no node matches
+	sniffer := NewSniffer(client, pool, []string{"ml"}, log.NewNopLogger())
+	if err := sniffer.Sniff(context.Background()); err == nil {
+		t.Error("expected an error without matching nodes")
+	}
+	if len(pool.endpoints) != 1 || pool.endpoints[0].label() != node.URL {
+		t.Errorf("expected endpoints to be kept, got %d", len(pool.endpoints))
+	}
+}
+
+func TestPublishHost(t *testing.T) {
+	for address, expected := range map[string]string{
+		"10.0.0.1:9200":                  "10.0.0.1:9200",
+		"es-1.example.com/10.0.0.1:9200": "es-1.example.com:9200",
+		"[::1]:9200":                     "[::1]:9200",
+	} {
+		host, err := publishHost(address)
+		if err != nil {
+			t.Errorf("Failed to parse %s: %s", address, err)
+			continue
+		}
+		if host != expected {
+			t.Errorf("expected %s for %s, got %s", expected, address, host)
+		}
+	}
+	if _, err := publishHost("10.0.0.1"); err == nil {
+		t.Error("expected an error for an address without port")
+	}
+}
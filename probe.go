@@ -0,0 +1,185 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/clusterinfo"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var errUnknownModule = errors.New("unknown module")
+
+// prober scrapes the target given as URL parameter with the collectors of the
+// requested module, e.g. /probe?target=https://es:9200&module=prod.
+type prober struct {
+	cfg           *config.Config
+	logger        log.Logger
+	timeoutOffset time.Duration
+
+	// HTTP clients do not depend on the target, so they are shared by all
+	// probes of a module to reuse connections
+	mu      sync.Mutex
+	clients map[string]*http.Client
+}
+
+func newProber(logger log.Logger, timeoutOffset time.Duration) *prober {
+	return &prober{
+		logger:        logger,
+		timeoutOffset: timeoutOffset,
+		clients:       make(map[string]*http.Client),
+	}
+}
+
+// PrepareConfig creates the clients of the modules, which replace the current
+// modules and their clients on commit.
+func (p *prober) PrepareConfig(cfg *config.Config) (*pendingConfig, error) {
+	names := []string{config.DefaultModuleName}
+	if cfg != nil {
+		for name := range cfg.Modules {
+			names = append(names, name)
+		}
+	}
+	clients := make(map[string]*http.Client)
+	for _, name := range names {
+		module, _ := cfg.Module(name)
+		c, err := newHTTPClient(module, p.logger, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the http client of module %q: %w", name, err)
+		}
+		clients[name] = c
+	}
+	closeClients := func(clients map[string]*http.Client) {
+		for _, c := range clients {
+			c.CloseIdleConnections()
+		}
+	}
+	return &pendingConfig{
+		commit: func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			closeClients(p.clients)
+			p.cfg = cfg
+			p.clients = clients
+		},
+		abort: func() { closeClients(clients) },
+	}, nil
+}
+
+// module returns the named module and the HTTP client shared by its probes.
+func (p *prober) module(name string) (*config.Module, *http.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	module, ok := p.cfg.Module(name)
+	if !ok {
+		return nil, nil, errUnknownModule
+	}
+	if c, ok := p.clients[name]; ok {
+		return module, c, nil
+	}
+	c, err := newHTTPClient(module, p.logger, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.clients[name] = c
+	return module, c, nil
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (p *prober) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	target := params.Get("target")
+	if target == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+	if !strings.Contains(target, "://") {
+		target = "http://" + target
+	}
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse target: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	moduleName := params.Get("module")
+	if moduleName == "" {
+		moduleName = config.DefaultModuleName
+	}
+	module, httpClient, err := p.module(moduleName)
+	if err == errUnknownModule {
+		http.Error(w, fmt.Sprintf("unknown module %q", moduleName), http.StatusBadRequest)
+		return
+	}
+	logger := log.With(p.logger, "module", moduleName, "target", targetURL.Host)
+	if err != nil {
+		_ = level.Error(logger).Log("msg", "failed to create http client", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if module.Auth.Username != "" && module.Auth.Password != "" {
+		targetURL.User = url.UserPassword(module.Auth.Username, module.Auth.Password)
+	}
+
+	ctx, cancel, err := scrapeContext(r, p.timeoutOffset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+
+	registry, err := newProbeRegistry(ctx, targetURL, module, httpClient, logger)
+	if err != nil {
+		_ = level.Error(logger).Log("msg", "failed to set up probe", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// newProbeRegistry creates a registry with fresh collectors for the given target.
+func newProbeRegistry(ctx context.Context, targetURL *url.URL, module *config.Module, httpClient *http.Client, logger log.Logger) (*prometheus.Registry, error) {
+	exporter, err := newCollector(targetURL, module, httpClient, logger)
+	if err != nil {
+		return nil, err
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter.WithContext(ctx))
+
+	// the probe lives for a single request, so the cluster info is fetched
+	// once instead of running the periodic retriever
+	clusterInfoRetriever := clusterinfo.New(logger, httpClient, targetURL, 0)
+	registry.MustRegister(clusterInfoRetriever)
+	ci, err := clusterInfoRetriever.Fetch(ctx)
+	if err != nil {
+		_ = level.Warn(logger).Log("msg", "failed to retrieve cluster info", "err", err)
+	}
+	exporter.SetClusterInfo(ci)
+
+	return registry, nil
+}
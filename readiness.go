@@ -0,0 +1,134 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus-community/elasticsearch_exporter/collector"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/clusterinfo"
+)
+
+// readiness is the body of the readiness endpoint.
+type readiness struct {
+	Ready       bool                       `json:"ready"`
+	Reason      string                     `json:"reason,omitempty"`
+	ClusterInfo componentStatus            `json:"cluster_info"`
+	Collectors  map[string]componentStatus `json:"collectors"`
+}
+
+// componentStatus is the outcome of the last Elasticsearch requests of the
+// cluster info retriever or of a collector.
+type componentStatus struct {
+	LastSuccess   *time.Time `json:"last_success,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+}
+
+func newComponentStatus(lastSuccess time.Time, lastErr error, lastErrorTime time.Time) componentStatus {
+	var s componentStatus
+	if !lastSuccess.IsZero() {
+		s.LastSuccess = &lastSuccess
+	}
+	if lastErr != nil {
+		s.LastError = lastErr.Error()
+	}
+	if !lastErrorTime.IsZero() {
+		s.LastErrorTime = &lastErrorTime
+	}
+	return s
+}
+
+// readiness reports whether the exporter can reach Elasticsearch, see
+// newReadiness.
+func (e *clusterExporter) readiness() readiness {
+	e.mu.RLock()
+	exporter, clusterInfo, carried := e.collector, e.clusterInfo, e.clusterInfoSuccess
+	e.mu.RUnlock()
+
+	if clusterInfo == nil {
+		return readiness{
+			Reason:     "the collectors have not been created yet",
+			Collectors: make(map[string]componentStatus),
+		}
+	}
+	status := clusterInfo.Status()
+	// the retriever of a reloaded configuration has not succeeded yet
+	if status.LastSuccess.IsZero() {
+		status.LastSuccess = carried
+	}
+	return newReadiness(status, exporter.Statuses(), e.readinessWindow, time.Now())
+}
+
+// newReadiness returns the readiness of the statuses of the cluster info and
+// of the collectors. The exporter is not ready until the cluster info has been
+// retrieved, when neither the cluster info retrieval nor a collector
+// succeeded within the window, and when all collectors failed in their last
+// scrape.
+func newReadiness(clusterInfo clusterinfo.Status, statuses map[string]collector.Status, window time.Duration, now time.Time) readiness {
+	r := readiness{
+		ClusterInfo: newComponentStatus(clusterInfo.LastSuccess, clusterInfo.LastError, clusterInfo.LastErrorTime),
+		Collectors:  make(map[string]componentStatus),
+	}
+	if clusterInfo.LastSuccess.IsZero() {
+		r.Reason = "the cluster info has not been retrieved yet"
+		return r
+	}
+
+	lastSuccess := clusterInfo.LastSuccess
+	failed, noData := 0, 0
+	for name, s := range statuses {
+		r.Collectors[name] = newComponentStatus(s.LastSuccess, s.LastError, s.LastErrorTime)
+		if s.LastSuccess.After(lastSuccess) {
+			lastSuccess = s.LastSuccess
+		}
+		switch {
+		case collector.IsNoDataError(s.LastError):
+			// e.g. a polled collector before its first refresh
+			noData++
+		case s.LastError != nil:
+			failed++
+		}
+	}
+	if window > 0 && now.Sub(lastSuccess) > window {
+		r.Reason = fmt.Sprintf("no request to Elasticsearch succeeded in the last %s", window)
+		return r
+	}
+	if failed > 0 && failed == len(statuses)-noData {
+		r.Reason = "all collectors failed in their last scrape"
+		return r
+	}
+	r.Ready = true
+	return r
+}
+
+// ServeReady serves the readiness of the exporter as JSON, with the status 503
+// if it is not ready.
+func (e *clusterExporter) ServeReady(w http.ResponseWriter, _ *http.Request) {
+	r := e.readiness()
+	w.Header().Set("Content-Type", "application/json")
+	if !r.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(r); err != nil {
+		_ = level.Error(e.logger).Log(
+			"msg", "failed handling writer",
+			"err", err,
+		)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus-community/elasticsearch_exporter/collector"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/clusterinfo"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+)
+
+func TestNewReadiness(t *testing.T) {
+	now := time.Now()
+	window := 10 * time.Minute
+	recent, old := now.Add(-time.Minute), now.Add(-time.Hour)
+	errDown := errors.New("connection refused")
+
+	for _, tc := range []struct {
+		name        string
+		clusterInfo clusterinfo.Status
+		statuses    map[string]collector.Status
+		ready       bool
+	}{
+		{
+			name:        "never fetched",
+			clusterInfo: clusterinfo.Status{LastError: errDown, LastErrorTime: recent},
+		},
+		{
+			name:        "fetched",
+			clusterInfo: clusterinfo.Status{LastSuccess: recent},
+			ready:       true,
+		},
+		{
+			name:        "success outside the window",
+			clusterInfo: clusterinfo.Status{LastSuccess: old, LastError: errDown, LastErrorTime: recent},
+			statuses: map[string]collector.Status{
+				"cluster-health": {LastSuccess: old, LastError: errDown, LastErrorTime: recent},
+			},
+		},
+		{
+			name:        "collector success within the window",
+			clusterInfo: clusterinfo.Status{LastSuccess: old, LastError: errDown, LastErrorTime: recent},
+			statuses: map[string]collector.Status{
+				"cluster-health": {LastSuccess: recent},
+			},
+			ready: true,
+		},
+		{
+			name:        "all collectors failed",
+			clusterInfo: clusterinfo.Status{LastSuccess: recent},
+			statuses: map[string]collector.Status{
+				"cluster-health": {LastSuccess: old, LastError: errDown, LastErrorTime: recent},
+				"nodes":          {LastError: errDown, LastErrorTime: recent},
+			},
+		},
+		{
+			name:        "some collectors failed",
+			clusterInfo: clusterinfo.Status{LastSuccess: recent},
+			statuses: map[string]collector.Status{
+				"cluster-health": {LastSuccess: recent},
+				"nodes":          {LastError: errDown, LastErrorTime: recent},
+			},
+			ready: true,
+		},
+		{
+			name:        "only no data",
+			clusterInfo: clusterinfo.Status{LastSuccess: recent},
+			statuses: map[string]collector.Status{
+				"slm": {LastError: collector.ErrNoData, LastErrorTime: recent},
+			},
+			ready: true,
+		},
+		{
+			name:        "failed and no data",
+			clusterInfo: clusterinfo.Status{LastSuccess: recent},
+			statuses: map[string]collector.Status{
+				"nodes": {LastError: errDown, LastErrorTime: recent},
+				"slm":   {LastError: collector.ErrNoData, LastErrorTime: recent},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newReadiness(tc.clusterInfo, tc.statuses, window, now)
+			if r.Ready != tc.ready {
+				t.Errorf("expected ready %t, got %+v", tc.ready, r)
+			}
+			if r.Ready != (r.Reason == "") {
+				t.Errorf("expected a reason only when not ready, got %q", r.Reason)
+			}
+			if len(r.Collectors) != len(tc.statuses) {
+				t.Errorf("expected %d collectors, got %d", len(tc.statuses), len(r.Collectors))
+			}
+		})
+	}
+
+	// without a window, an old success counts
+	if r := newReadiness(clusterinfo.Status{LastSuccess: old}, nil, 0, now); !r.Ready {
+		t.Errorf("expected ready without a window, got %+v", r)
+	}
+}
+
+func TestClusterExporterReadinessReload(t *testing.T) {
+	var down int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"cluster_name":"test","cluster_uuid":"uuid","version":{"number":"8.5.0"}}`)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e := newClusterExporter(ctx, &config.Elasticsearch{URI: ts.URL, Module: config.DefaultModule}, time.Hour, log.NewNopLogger())
+	apply := func() {
+		p, err := e.PrepareConfig(nil)
+		if err != nil {
+			t.Fatalf("Failed to prepare config: %s", err)
+		}
+		p.commit()
+	}
+
+	apply()
+	deadline := time.Now().Add(5 * time.Second)
+	for !e.readiness().Ready && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if r := e.readiness(); !r.Ready {
+		t.Fatalf("expected ready after the cluster info was retrieved, got %+v", r)
+	}
+
+	// the last success of the replaced retriever counts until the new one
+	// succeeds
+	atomic.StoreInt32(&down, 1)
+	apply()
+	if r := e.readiness(); !r.Ready {
+		t.Errorf("expected ready after the reload, got %+v", r)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// pendingConfig is a configuration prepared by a receiver of the reloader.
+// It takes effect on commit; abort releases it when another receiver failed
+// to prepare the configuration.
+type pendingConfig struct {
+	commit func()
+	abort  func()
+}
+
+// receiver prepares a configuration without changing the current one.
+type receiver func(*config.Config) (*pendingConfig, error)
+
+// reloader loads the configuration file and hands it to its receivers.
+type reloader struct {
+	path      string
+	logger    log.Logger
+	receivers []receiver
+
+	mu                   sync.Mutex
+	lastReloadSuccessful prometheus.Gauge
+	lastReloadSuccessTs  prometheus.Gauge
+}
+
+func newReloader(path string, logger log.Logger, receivers ...receiver) *reloader {
+	return &reloader{
+		path:      path,
+		logger:    logger,
+		receivers: receivers,
+		lastReloadSuccessful: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(name, "config", "last_reload_successful"),
+			Help: "Whether the last configuration reload attempt was successful.",
+		}),
+		lastReloadSuccessTs: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(name, "config", "last_reload_success_timestamp_seconds"),
+			Help: "Timestamp of the last successful configuration reload.",
+		}),
+	}
+}
+
+// Describe implements the prometheus.Collector interface.
+func (r *reloader) Describe(ch chan<- *prometheus.Desc) {
+	r.lastReloadSuccessful.Describe(ch)
+	r.lastReloadSuccessTs.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (r *reloader) Collect(ch chan<- prometheus.Metric) {
+	r.lastReloadSuccessful.Collect(ch)
+	r.lastReloadSuccessTs.Collect(ch)
+}
+
+// Reload loads and validates the configuration file before passing it to the
+// receivers. Without a configuration file, the receivers get a nil config. The
+// configuration is only applied if all receivers accept it.
+func (r *reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.reload()
+	if err != nil {
+		r.lastReloadSuccessful.Set(0)
+		return err
+	}
+	r.lastReloadSuccessful.Set(1)
+	r.lastReloadSuccessTs.Set(float64(time.Now().Unix()))
+	return nil
+}
+
+func (r *reloader) reload() error {
+	var cfg *config.Config
+	if r.path != "" {
+		var err error
+		cfg, err = config.Load(r.path)
+		if err != nil {
+			return fmt.Errorf("failed to load config file: %w", err)
+		}
+	}
+	pending := make([]*pendingConfig, 0, len(r.receivers))
+	for _, prepare := range r.receivers {
+		p, err := prepare(cfg)
+		if err != nil {
+			for _, p := range pending {
+				if p.abort != nil {
+					p.abort()
+				}
+			}
+			return fmt.Errorf("failed to apply config: %w", err)
+		}
+		pending = append(pending, p)
+	}
+	for _, p := range pending {
+		p.commit()
+	}
+	return nil
+}
+
+// Run reloads the configuration on SIGHUP until ctx is cancelled.
+func (r *reloader) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.logReload(r.Reload())
+		}
+	}
+}
+
+// ServeHTTP implements the http.Handler interface for the reload endpoint.
+func (r *reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost && req.Method != http.MethodPut {
+		w.Header().Set("Allow", "POST, PUT")
+		http.Error(w, "Only POST or PUT requests allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	err := r.Reload()
+	r.logReload(err)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (r *reloader) logReload(err error) {
+	if err != nil {
+		_ = level.Error(r.logger).Log("msg", "failed to reload config", "err", err)
+		return
+	}
+	_ = level.Info(r.logger).Log("msg", "reloaded config", "file", r.path)
+}
@@ -0,0 +1,135 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testReceiver records the configurations it prepared, committed and aborted.
+type testReceiver struct {
+	err                          error
+	prepared, committed, aborted int
+}
+
+func (r *testReceiver) prepare(*config.Config) (*pendingConfig, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	r.prepared++
+	return &pendingConfig{
+		commit: func() { r.committed++ },
+		abort:  func() { r.aborted++ },
+	}, nil
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %s", err)
+	}
+	return path
+}
+
+func TestReloaderAllOrNothing(t *testing.T) {
+	path := writeConfigFile(t, "modules:\n  prod:\n    timeout: 10s\n")
+	first, second := &testReceiver{}, &testReceiver{err: errors.New("invalid module")}
+	r := newReloader(path, log.NewNopLogger(), first.prepare, second.prepare)
+
+	// a receiver failing to prepare the config aborts the others
+	if err := r.Reload(); err == nil {
+		t.Fatal("expected an error")
+	}
+	if first.prepared != 1 || first.committed != 0 || first.aborted != 1 {
+		t.Errorf("expected the first receiver to be aborted, got %+v", first)
+	}
+	if v := testutil.ToFloat64(r.lastReloadSuccessful); v != 0 {
+		t.Errorf("expected last_reload_successful 0, got %v", v)
+	}
+	if v := testutil.ToFloat64(r.lastReloadSuccessTs); v != 0 {
+		t.Errorf("expected no last_reload_success_timestamp_seconds, got %v", v)
+	}
+
+	second.err = nil
+	if err := r.Reload(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if first.committed != 1 || second.committed != 1 {
+		t.Errorf("expected both receivers to commit, got %+v and %+v", first, second)
+	}
+	if v := testutil.ToFloat64(r.lastReloadSuccessful); v != 1 {
+		t.Errorf("expected last_reload_successful 1, got %v", v)
+	}
+	success := testutil.ToFloat64(r.lastReloadSuccessTs)
+	if success <= 0 {
+		t.Errorf("expected last_reload_success_timestamp_seconds, got %v", success)
+	}
+
+	// an invalid file is not passed to the receivers
+	if err := os.WriteFile(path, []byte("modules:\n  prod:\n    timeot: 10s\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %s", err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Fatal("expected an error")
+	}
+	if first.prepared != 2 || second.prepared != 1 {
+		t.Errorf("expected no receiver to prepare an invalid config, got %+v and %+v", first, second)
+	}
+	if v := testutil.ToFloat64(r.lastReloadSuccessful); v != 0 {
+		t.Errorf("expected last_reload_successful 0, got %v", v)
+	}
+	if v := testutil.ToFloat64(r.lastReloadSuccessTs); v != success {
+		t.Errorf("expected last_reload_success_timestamp_seconds %v, got %v", success, v)
+	}
+}
+
+func TestReloaderServeHTTP(t *testing.T) {
+	receiver := &testReceiver{}
+	r := newReloader("", log.NewNopLogger(), receiver.prepare)
+
+	for _, tc := range []struct {
+		method   string
+		err      error
+		expected int
+	}{
+		{http.MethodGet, nil, http.StatusMethodNotAllowed},
+		{http.MethodDelete, nil, http.StatusMethodNotAllowed},
+		{http.MethodPost, nil, http.StatusOK},
+		{http.MethodPut, nil, http.StatusOK},
+		{http.MethodPost, errors.New("invalid module"), http.StatusInternalServerError},
+	} {
+		receiver.err = tc.err
+		committed := receiver.committed
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tc.method, "/-/reload", nil))
+		if w.Code != tc.expected {
+			t.Errorf("%s: expected status %d, got %d", tc.method, tc.expected, w.Code)
+		}
+		if reloaded := receiver.committed > committed; reloaded != (tc.expected == http.StatusOK) {
+			t.Errorf("%s: expected reload %t, got %t", tc.method, tc.expected == http.StatusOK, reloaded)
+		}
+		if tc.expected == http.StatusMethodNotAllowed && w.Header().Get("Allow") != "POST, PUT" {
+			t.Errorf("%s: expected the allowed methods, got %q", tc.method, w.Header().Get("Allow"))
+		}
+	}
+}
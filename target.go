@@ -0,0 +1,243 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus-community/elasticsearch_exporter/collector"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/clusterinfo"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/esclient"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/roundtripper"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newCollector creates the collectors enabled by module for the target.
+func newCollector(targetURL *url.URL, module *config.Module, httpClient *http.Client, logger log.Logger, options ...collector.Option) (*collector.ElasticsearchCollector, error) {
+	options = append([]collector.Option{
+		collector.WithElasticsearchURL(targetURL),
+		collector.WithHTTPClient(httpClient),
+		collector.WithModule(module),
+	}, options...)
+	exporter, err := collector.NewElasticsearchCollector(logger, []string{}, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Elasticsearch collector: %w", err)
+	}
+	return exporter, nil
+}
+
+// clusterExporter exposes the cluster configured by the es.* flags or the
+// elasticsearch section of the configuration file. It provides the gatherer
+// of the metrics endpoint, and its collectors are replaced when the
+// configuration is reloaded.
+type clusterExporter struct {
+	ctx         context.Context
+	flagsConfig *config.Elasticsearch
+	// readinessWindow is the time without successful requests to
+	// Elasticsearch after which the exporter is not ready.
+	readinessWindow time.Duration
+	logger          log.Logger
+
+	mu          sync.RWMutex
+	collector   *collector.ElasticsearchCollector
+	clusterInfo *clusterinfo.Retriever
+	// clusterInfoSuccess is the last successful retrieval of the replaced
+	// cluster info retrievers, which counts for the readiness until the
+	// current one succeeds.
+	clusterInfoSuccess time.Time
+	registry           *prometheus.Registry
+	httpClient         *http.Client
+	cancel             context.CancelFunc
+}
+
+func newClusterExporter(ctx context.Context, flagsConfig *config.Elasticsearch, readinessWindow time.Duration, logger log.Logger) *clusterExporter {
+	return &clusterExporter{
+		ctx:             ctx,
+		flagsConfig:     flagsConfig,
+		readinessWindow: readinessWindow,
+		logger:          logger,
+		registry:        prometheus.NewRegistry(),
+	}
+}
+
+// Gatherer returns a gatherer for a single scrape. The Elasticsearch requests
+// of the collectors are cancelled when ctx is done. If filters is not empty,
+// only the named collectors are scraped.
+func (e *clusterExporter) Gatherer(ctx context.Context, filters []string) (prometheus.Gatherer, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.collector == nil {
+		return e.registry, nil
+	}
+	exporter := e.collector
+	if len(filters) > 0 {
+		var err error
+		exporter, err = collector.NewElasticsearchCollector(e.logger, filters, collector.WithCollectorsOf(e.collector))
+		if err != nil {
+			return nil, err
+		}
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter.WithContext(ctx))
+	return prometheus.Gatherers{e.registry, registry}, nil
+}
+
+// PrepareConfig creates the collectors for the given configuration, which
+// replace the current ones on commit.
+func (e *clusterExporter) PrepareConfig(cfg *config.Config) (*pendingConfig, error) {
+	esConfig := e.flagsConfig
+	if cfg != nil && cfg.Elasticsearch != nil {
+		esConfig = cfg.Elasticsearch
+	}
+
+	esURL, err := url.Parse(esConfig.URI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse es.uri: %w", err)
+	}
+	if esConfig.Module.Auth.Username != "" && esConfig.Module.Auth.Password != "" {
+		esURL.User = url.UserPassword(esConfig.Module.Auth.Username, esConfig.Module.Auth.Password)
+	}
+
+	module := esConfig.Module
+	var (
+		pool    *roundtripper.Pool
+		balance func(http.RoundTripper) (http.RoundTripper, error)
+	)
+	if esConfig.Balanced() {
+		var urls []*url.URL
+		for _, uri := range esConfig.URIs() {
+			u, err := url.Parse(uri)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse es.uri: %w", err)
+			}
+			if u.User == nil {
+				u.User = esURL.User
+			}
+			urls = append(urls, u)
+		}
+		// certificates are issued for the host name, not the resolved addresses
+		if esConfig.ResolveDNS && module.TLS.ServerName == "" {
+			module.TLS.ServerName = esURL.Hostname()
+		}
+		balance = func(t http.RoundTripper) (http.RoundTripper, error) {
+			var err error
+			pool, err = roundtripper.NewPool(t, urls, esConfig.LoadBalancing, esConfig.ResolveDNS, e.logger)
+			return pool, err
+		}
+	}
+
+	httpClient, err := newHTTPClient(&module, e.logger, balance)
+	if err != nil {
+		return nil, err
+	}
+
+	// the cluster info retriever passes the cluster name, UUID and version to
+	// the collectors
+	clusterInfoRetriever := clusterinfo.New(e.logger, httpClient, esURL, esConfig.ClusterInfoInterval)
+	clusterInfo, err := clusterInfoRetriever.Subscribe("collectors")
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe collectors to cluster info: %w", err)
+	}
+
+	exporter, err := newCollector(esURL, &module, httpClient, e.logger,
+		collector.WithRefreshIntervals(esConfig.RefreshIntervals),
+		collector.WithClusterInfo(clusterInfo),
+	)
+	if err != nil {
+		clusterInfo.Unsubscribe()
+		return nil, err
+	}
+
+	// register cluster info retriever as prometheus collector
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(clusterInfoRetriever)
+
+	var sniffer *roundtripper.Sniffer
+	if pool != nil {
+		registry.MustRegister(pool)
+		if esConfig.Sniff {
+			sniffer = roundtripper.NewSniffer(esclient.New(e.logger, httpClient, esURL), pool, esConfig.SniffRoles, e.logger)
+			registry.MustRegister(sniffer)
+		}
+	}
+
+	commit := func() {
+		ctx, cancel := context.WithCancel(e.ctx)
+
+		// start polling the collectors with a refresh interval and receiving
+		// the cluster info, until the collectors are replaced
+		exporter.Run(ctx)
+		// the initial cluster info call must not block the reload, the
+		// readiness endpoint reports whether it succeeded
+		go e.runClusterInfo(ctx, clusterInfoRetriever, esConfig.ClusterInfoInterval)
+		if pool != nil && esConfig.HealthCheckInterval > 0 {
+			go pool.Run(ctx, esConfig.HealthCheckInterval)
+		}
+		if sniffer != nil {
+			go sniffer.Run(ctx, esConfig.SniffInterval)
+		}
+
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if e.cancel != nil {
+			e.cancel()
+		}
+		// the connections in use by scrapes in flight are closed once they
+		// are idle for the IdleConnTimeout of the transport
+		if e.httpClient != nil {
+			e.httpClient.CloseIdleConnections()
+		}
+		if e.clusterInfo != nil {
+			if s := e.clusterInfo.Status(); s.LastSuccess.After(e.clusterInfoSuccess) {
+				e.clusterInfoSuccess = s.LastSuccess
+			}
+		}
+		e.collector = exporter
+		e.clusterInfo = clusterInfoRetriever
+		e.registry = registry
+		e.httpClient = httpClient
+		e.cancel = cancel
+	}
+	abort := func() {
+		clusterInfo.Unsubscribe()
+		httpClient.CloseIdleConnections()
+	}
+	return &pendingConfig{commit: commit, abort: abort}, nil
+}
+
+// runClusterInfo starts the cluster info retriever and logs the outcome of its
+// initial call.
+func (e *clusterExporter) runClusterInfo(ctx context.Context, r *clusterinfo.Retriever, interval time.Duration) {
+	err := r.Run(ctx)
+	switch {
+	case ctx.Err() != nil:
+	case err == nil:
+		_ = level.Info(e.logger).Log(
+			"msg", "started cluster info retriever",
+			"interval", interval.String(),
+		)
+	case err == clusterinfo.ErrInitialCallTimeout:
+		_ = level.Info(e.logger).Log("msg", "initial cluster info call timed out")
+	default:
+		_ = level.Error(e.logger).Log("msg", "failed to run cluster info retriever", "err", err)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+func TestScrapeContext(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		header   string
+		offset   time.Duration
+		err      bool
+		deadline time.Duration
+	}{
+		{name: "no header", offset: time.Second},
+		{name: "invalid", header: "ten", err: true},
+		{name: "not positive", header: "0", err: true},
+		{name: "offset", header: "10", offset: 500 * time.Millisecond, deadline: 9500 * time.Millisecond},
+		{name: "fraction", header: "2.5", offset: 500 * time.Millisecond, deadline: 2 * time.Second},
+		// an offset which exceeds the timeout is ignored
+		{name: "offset exceeds timeout", header: "1", offset: 2 * time.Second, deadline: time.Second},
+		{name: "offset equals timeout", header: "1", offset: time.Second, deadline: time.Second},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tc.header != "" {
+				r.Header.Set(scrapeTimeoutHeader, tc.header)
+			}
+			start := time.Now()
+			ctx, cancel, err := scrapeContext(r, tc.offset)
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			defer cancel()
+			deadline, ok := ctx.Deadline()
+			if ok != (tc.deadline > 0) {
+				t.Fatalf("expected a deadline %t, got %t", tc.deadline > 0, ok)
+			}
+			if !ok {
+				return
+			}
+			if d := deadline.Sub(start); d < tc.deadline-100*time.Millisecond || d > tc.deadline+100*time.Millisecond {
+				t.Errorf("expected a deadline in %s, got %s", tc.deadline, d)
+			}
+		})
+	}
+}
+
+func TestProbeScrapeTimeout(t *testing.T) {
+	// Elasticsearch answers the cluster info only, the collectors hang until
+	// their requests are cancelled
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `{"cluster_name":"test","cluster_uuid":"uuid","version":{"number":"8.5.0"}}`)
+			return
+		}
+		<-r.Context().Done()
+	}))
+	defer es.Close()
+
+	p := newProber(log.NewNopLogger(), 100*time.Millisecond)
+	pending, err := p.PrepareConfig(nil)
+	if err != nil {
+		t.Fatalf("Failed to prepare config: %s", err)
+	}
+	pending.commit()
+
+	r := httptest.NewRequest(http.MethodGet, "/probe?target="+es.URL, nil)
+	r.Header.Set(scrapeTimeoutHeader, "0.5")
+	w := httptest.NewRecorder()
+	start := time.Now()
+	p.ServeHTTP(w, r)
+	if d := time.Since(start); d > 3*time.Second {
+		t.Errorf("expected the scrape to end at the deadline, took %s", d)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+	body := w.Body.String()
+	// the collectors which are done still make it into the response
+	for _, metric := range []string{
+		`elasticsearch_scrape_success{collector="cluster-health"} 0`,
+		`elasticsearch_scrape_success{collector="nodes"} 0`,
+		`elasticsearch_scrape_success{collector="cluster-info"} 1`,
+	} {
+		if !strings.Contains(body, metric) {
+			t.Errorf("expected %s in the probe, got\n%s", metric, body)
+		}
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/probe?target="+es.URL, nil)
+	r.Header.Set(scrapeTimeoutHeader, "ten")
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid scrape timeout, got %d", w.Code)
+	}
+}
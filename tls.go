@@ -16,38 +16,250 @@ package main
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"fmt"
 	"io/ioutil"
-	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-func createTLSConfig(pemFile, pemCertFile, pemPrivateKeyFile string, insecureSkipVerify bool) *tls.Config {
-	tlsConfig := tls.Config{}
-	if insecureSkipVerify {
-		// pem settings are irrelevant if we're skipping verification anyway
-		tlsConfig.InsecureSkipVerify = true
+// tlsMetrics are shared by the TLS configurations of all targets.
+var tlsMetrics = newTLSCertMetrics()
+
+type tlsCertMetrics struct {
+	clientCertExpiry  *prometheus.GaugeVec
+	serverChainExpiry *prometheus.GaugeVec
+}
+
+func newTLSCertMetrics() *tlsCertMetrics {
+	return &tlsCertMetrics{
+		clientCertExpiry: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(name, "tls", "client_cert_expiry_timestamp_seconds"),
+				Help: "Timestamp when the client certificate used to connect to Elasticsearch expires.",
+			},
+			[]string{"file"},
+		),
+		serverChainExpiry: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: prometheus.BuildFQName(name, "tls", "server_cert_chain_expiry_timestamp_seconds"),
+				Help: "Timestamp when the first certificate of the chain presented by Elasticsearch expires.",
+			},
+			[]string{"server_name"},
+		),
+	}
+}
+
+// Describe implements the prometheus.Collector interface.
+func (m *tlsCertMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.clientCertExpiry.Describe(ch)
+	m.serverChainExpiry.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (m *tlsCertMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.clientCertExpiry.Collect(ch)
+	m.serverChainExpiry.Collect(ch)
+}
+
+// idleConnTimeout is how long the connections to Elasticsearch are kept idle,
+// so that the connections of replaced clients are closed eventually.
+const idleConnTimeout = 90 * time.Second
+
+// createTransport creates the transport of the module to Elasticsearch. If a
+// CA file is given, the transport is rebuilt when the file changes, so that the
+// certificate of Elasticsearch is verified against the latest certificate
+// authorities.
+func createTransport(t config.TLS, logger log.Logger) (http.RoundTripper, error) {
+	tlsConfig, err := createTLSConfig(t, logger)
+	if err != nil {
+		return nil, err
+	}
+	tr := &tlsTransport{
+		serverName: t.ServerName,
+		logger:     logger,
+		newTransport: func(roots *x509.CertPool) *http.Transport {
+			tlsConfig := tlsConfig.Clone()
+			tlsConfig.RootCAs = roots
+			return &http.Transport{
+				TLSClientConfig: tlsConfig,
+				Proxy:           http.ProxyFromEnvironment,
+				IdleConnTimeout: idleConnTimeout,
+			}
+		},
 	}
-	if len(pemFile) > 0 {
-		rootCerts, err := loadCertificatesFrom(pemFile)
-		if err != nil {
-			log.Fatalf("Couldn't load root certificate from %s. Got %s.", pemFile, err)
-			return nil
+	if !t.InsecureSkipVerify && len(t.CAFile) > 0 {
+		tr.roots = &caPool{path: t.CAFile, logger: logger}
+		// Load the file once to catch configuration errors early.
+		if _, err := tr.roots.get(); err != nil {
+			return nil, fmt.Errorf("couldn't load root certificate from %s: %w", t.CAFile, err)
 		}
-		tlsConfig.RootCAs = rootCerts
 	}
-	if len(pemCertFile) > 0 && len(pemPrivateKeyFile) > 0 {
+	return tr, nil
+}
+
+// createTLSConfig creates the TLS configuration of the module, without the
+// certificate authorities of the CA file. The client certificate is read
+// again when it changes, e.g. when it has been rotated.
+func createTLSConfig(t config.TLS, logger log.Logger) (*tls.Config, error) {
+	minVersion, err := config.TLSVersion(t.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	maxVersion, err := config.TLSVersion(t.MaxVersion)
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := config.TLSCipherSuites(t.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := tls.Config{
+		ServerName:   t.ServerName,
+		MinVersion:   minVersion,
+		MaxVersion:   maxVersion,
+		CipherSuites: cipherSuites,
+	}
+	if t.InsecureSkipVerify {
+		// pem settings are irrelevant if we're skipping verification anyway
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	if len(t.CertFile) > 0 && len(t.KeyFile) > 0 {
 		// Load files once to catch configuration error early.
-		_, err := loadPrivateKeyFrom(pemCertFile, pemPrivateKeyFile)
-		if err != nil {
-			log.Fatalf("Couldn't setup client authentication. Got %s.", err)
-			return nil
+		if _, err := loadPrivateKeyFrom(t.CertFile, t.KeyFile); err != nil {
+			return nil, fmt.Errorf("couldn't setup client authentication: %w", err)
 		}
 		// Define a function to load certificate and key lazily at TLS handshake to
 		// ensure that the latest files are used in case they have been rotated.
 		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
-			return loadPrivateKeyFrom(pemCertFile, pemPrivateKeyFile)
+			cert, err := loadPrivateKeyFrom(t.CertFile, t.KeyFile)
+			if err != nil {
+				_ = level.Error(logger).Log("msg", "failed to load client certificate", "file", t.CertFile, "err", err)
+				return nil, err
+			}
+			return cert, nil
 		}
 	}
-	return &tlsConfig
+	return &tlsConfig, nil
+}
+
+// tlsTransport is the transport to Elasticsearch of a module. It is replaced
+// by a new one when the certificate authorities of the CA file change, so
+// that the certificates are verified by crypto/tls for the host of the request
+// or the configured server name.
+type tlsTransport struct {
+	serverName   string
+	roots        *caPool
+	newTransport func(*x509.CertPool) *http.Transport
+	logger       log.Logger
+
+	mu        sync.Mutex
+	pool      *x509.CertPool
+	transport *http.Transport
+	// rootsErr is the error of the last failed read of the CA file, which is
+	// only logged once.
+	rootsErr error
+}
+
+// RoundTrip implements the http.RoundTripper interface and records the expiry
+// of the certificate chain presented by Elasticsearch.
+func (t *tlsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.get().RoundTrip(req)
+	if err != nil || res.TLS == nil || len(res.TLS.PeerCertificates) == 0 {
+		return res, err
+	}
+	expiry := res.TLS.PeerCertificates[0].NotAfter
+	for _, cert := range res.TLS.PeerCertificates[1:] {
+		if cert.NotAfter.Before(expiry) {
+			expiry = cert.NotAfter
+		}
+	}
+	serverName := t.serverName
+	if serverName == "" {
+		serverName = req.URL.Hostname()
+	}
+	tlsMetrics.serverChainExpiry.WithLabelValues(serverName).Set(float64(expiry.Unix()))
+	return res, nil
+}
+
+// CloseIdleConnections closes the idle connections of the current transport.
+func (t *tlsTransport) CloseIdleConnections() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.transport != nil {
+		t.transport.CloseIdleConnections()
+	}
+}
+
+// get returns the transport with the latest certificate authorities.
+func (t *tlsTransport) get() *http.Transport {
+	var pool *x509.CertPool
+	var err error
+	if t.roots != nil {
+		pool, err = t.roots.get()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil && t.rootsErr == nil {
+		_ = level.Warn(t.logger).Log(
+			"msg", "failed to reload root certificates, using the previous ones",
+			"file", t.roots.path,
+			"err", err,
+		)
+	}
+	t.rootsErr = err
+	if t.transport == nil || pool != t.pool {
+		if t.transport != nil {
+			t.transport.CloseIdleConnections()
+		}
+		t.pool = pool
+		t.transport = t.newTransport(pool)
+	}
+	return t.transport
+}
+
+// caPool is the pool of the certificate authorities of a file, which is read
+// again when the file has been modified or replaced.
+type caPool struct {
+	path   string
+	logger log.Logger
+
+	mu   sync.Mutex
+	info os.FileInfo
+	pool *x509.CertPool
+}
+
+// get returns the certificate authorities of the file. If the file cannot be
+// read anymore, the previous ones are returned along with the error.
+func (c *caPool) get() (*x509.CertPool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return c.pool, err
+	}
+	if c.info != nil && os.SameFile(info, c.info) &&
+		info.ModTime().Equal(c.info.ModTime()) && info.Size() == c.info.Size() {
+		return c.pool, nil
+	}
+	pool, err := loadCertificatesFrom(c.path)
+	if err != nil {
+		return c.pool, err
+	}
+	if c.pool != nil {
+		_ = level.Info(c.logger).Log("msg", "reloaded root certificates", "file", c.path)
+	}
+	c.info = info
+	c.pool = pool
+	return pool, nil
 }
 
 func loadCertificatesFrom(pemFile string) (*x509.CertPool, error) {
@@ -56,7 +268,9 @@ func loadCertificatesFrom(pemFile string) (*x509.CertPool, error) {
 		return nil, err
 	}
 	certificates := x509.NewCertPool()
-	certificates.AppendCertsFromPEM(caCert)
+	if !certificates.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("no certificates found in %s", pemFile)
+	}
 	return certificates, nil
 }
 
@@ -65,5 +279,14 @@ func loadPrivateKeyFrom(pemCertFile, pemPrivateKeyFile string) (*tls.Certificate
 	if err != nil {
 		return nil, err
 	}
+	leaf := privateKey.Leaf
+	if leaf == nil && len(privateKey.Certificate) > 0 {
+		if leaf, err = x509.ParseCertificate(privateKey.Certificate[0]); err != nil {
+			return nil, err
+		}
+	}
+	if leaf != nil {
+		tlsMetrics.clientCertExpiry.WithLabelValues(pemCertFile).Set(float64(leaf.NotAfter.Unix()))
+	}
 	return &privateKey, nil
 }
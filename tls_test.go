@@ -0,0 +1,248 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus-community/elasticsearch_exporter/pkg/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testCA is a certificate authority issuing the server certificates of the
+// tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create CA certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse CA certificate: %s", err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a server certificate for the DNS names and IP addresses.
+func (ca *testCA) issue(t *testing.T, dnsNames []string, ips []net.IP) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "server"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(30 * time.Minute),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %s", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// newTLSServer starts a server on 127.0.0.1 presenting the certificate.
+func newTLSServer(t *testing.T, cert tls.Certificate, configure func(*tls.Config)) *httptest.Server {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	if configure != nil {
+		configure(ts.TLS)
+	}
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func writeCA(t *testing.T, path string, ca *testCA, modTime time.Time) {
+	if err := os.WriteFile(path, ca.pem, 0o600); err != nil {
+		t.Fatalf("Failed to write CA file: %s", err)
+	}
+	// the certificates of both CAs have the same size
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Failed to set the modification time: %s", err)
+	}
+}
+
+func get(t *testing.T, tlsConfig config.TLS, url string) (*http.Response, error) {
+	tr, err := createTransport(tlsConfig, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Failed to create transport: %s", err)
+	}
+	res, err := (&http.Client{Transport: tr}).Get(url)
+	if err == nil {
+		res.Body.Close()
+	}
+	return res, err
+}
+
+func TestTLSServerName(t *testing.T) {
+	ca := newTestCA(t)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeCA(t, caFile, ca, time.Now())
+
+	wrongSAN := newTLSServer(t, ca.issue(t, []string{"es.example"}, nil), nil)
+	ipSAN := newTLSServer(t, ca.issue(t, nil, []net.IP{net.ParseIP("127.0.0.1")}), nil)
+
+	for _, tc := range []struct {
+		name       string
+		url        string
+		serverName string
+		ok         bool
+		label      string
+	}{
+		// the certificate is verified for the IP address of the target
+		{"wrong SAN", wrongSAN.URL, "", false, ""},
+		{"IP SAN", ipSAN.URL, "", true, "127.0.0.1"},
+		{"server name", wrongSAN.URL, "es.example", true, "es.example"},
+		{"wrong server name", ipSAN.URL, "es.example", false, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tlsMetrics.serverChainExpiry.Reset()
+			_, err := get(t, config.TLS{CAFile: caFile, ServerName: tc.serverName}, tc.url)
+			if tc.ok != (err == nil) {
+				t.Fatalf("expected success %t, got %v", tc.ok, err)
+			}
+			if !tc.ok {
+				return
+			}
+			if n := testutil.CollectAndCount(tlsMetrics.serverChainExpiry); n != 1 {
+				t.Fatalf("expected 1 chain expiry, got %d", n)
+			}
+			if v := testutil.ToFloat64(tlsMetrics.serverChainExpiry.WithLabelValues(tc.label)); v <= 0 {
+				t.Errorf("expected the chain expiry of %q, got %v", tc.label, v)
+			}
+		})
+	}
+}
+
+func TestTLSCAReload(t *testing.T) {
+	ca, other := newTestCA(t), newTestCA(t)
+	ts := newTLSServer(t, ca.issue(t, nil, []net.IP{net.ParseIP("127.0.0.1")}), nil)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeCA(t, caFile, other, time.Now().Add(-time.Minute))
+
+	tr, err := createTransport(config.TLS{CAFile: caFile}, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("Failed to create transport: %s", err)
+	}
+	client := &http.Client{Transport: tr}
+	if _, err := client.Get(ts.URL); err == nil {
+		t.Fatal("expected an error for a certificate of another CA")
+	}
+
+	writeCA(t, caFile, ca, time.Now())
+	res, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("expected the reloaded CA to be used, got %s", err)
+	}
+	res.Body.Close()
+
+	// the previous CAs are used if the file cannot be read
+	if err := os.Remove(caFile); err != nil {
+		t.Fatalf("Failed to remove CA file: %s", err)
+	}
+	tr.(*tlsTransport).CloseIdleConnections()
+	res, err = client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("expected the previous CA to be used, got %s", err)
+	}
+	res.Body.Close()
+}
+
+func TestTLSVersions(t *testing.T) {
+	ca := newTestCA(t)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeCA(t, caFile, ca, time.Now())
+	ts := newTLSServer(t, ca.issue(t, nil, []net.IP{net.ParseIP("127.0.0.1")}), func(c *tls.Config) {
+		c.MaxVersion = tls.VersionTLS12
+	})
+
+	if _, err := get(t, config.TLS{CAFile: caFile, MinVersion: "TLS13"}, ts.URL); err == nil {
+		t.Error("expected an error for a server below the min version")
+	}
+	res, err := get(t, config.TLS{CAFile: caFile, MinVersion: "TLS12", MaxVersion: "TLS12"}, ts.URL)
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	if res.TLS.Version != tls.VersionTLS12 {
+		t.Errorf("expected TLS 1.2, got %x", res.TLS.Version)
+	}
+
+	ts13 := newTLSServer(t, ca.issue(t, nil, []net.IP{net.ParseIP("127.0.0.1")}), func(c *tls.Config) {
+		c.MinVersion = tls.VersionTLS13
+	})
+	if _, err := get(t, config.TLS{CAFile: caFile, MaxVersion: "TLS12"}, ts13.URL); err == nil {
+		t.Error("expected an error for a server above the max version")
+	}
+}
+
+func TestTLSCipherSuites(t *testing.T) {
+	ca := newTestCA(t)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeCA(t, caFile, ca, time.Now())
+	ts := newTLSServer(t, ca.issue(t, nil, []net.IP{net.ParseIP("127.0.0.1")}), func(c *tls.Config) {
+		c.MaxVersion = tls.VersionTLS12
+		c.CipherSuites = []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}
+	})
+
+	if _, err := get(t, config.TLS{CAFile: caFile, CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}}, ts.URL); err == nil {
+		t.Error("expected an error without a common cipher suite")
+	}
+	res, err := get(t, config.TLS{CAFile: caFile, CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384"}}, ts.URL)
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	if res.TLS.CipherSuite != tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384 {
+		t.Errorf("expected TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, got %s", tls.CipherSuiteName(res.TLS.CipherSuite))
+	}
+}